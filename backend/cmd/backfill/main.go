@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/database"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/services"
+	"github.com/guatom999/self-boardcast/internal/utils"
+)
+
+// checkpoint records how far a backfill got so an interrupted run can resume
+type checkpoint struct {
+	LocationID int64     `json:"location_id"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Resolution string    `json:"resolution"`
+	DoneUntil  time.Time `json:"done_until"`
+}
+
+func main() {
+	var (
+		locationID = flag.Int64("location", 0, "location id to backfill")
+		stationID  = flag.Int64("station", 0, "ThaiWater tele-station id to backfill (alternative to -location)")
+		fromFlag   = flag.String("from", "", "start date, YYYY-MM-DD (Asia/Bangkok)")
+		toFlag     = flag.String("to", "", "end date, YYYY-MM-DD (Asia/Bangkok, exclusive)")
+		resolution = flag.String("resolution", "10m", "keep one reading per bucket, e.g. 10m, 1h, 24h; 0 keeps every reading")
+		chunkDays  = flag.Int("chunk-days", 1, "days fetched per request")
+		dryRun     = flag.Bool("dry-run", false, "print the readings instead of writing them")
+		statePath  = flag.String("state", "backfill_state.json", "checkpoint file used to resume an interrupted run")
+		envPath    = flag.String("env", "../../.env", "path of the env file")
+	)
+	flag.Parse()
+
+	if (*locationID == 0) == (*stationID == 0) {
+		log.Fatal("exactly one of -location or -station is required")
+	}
+
+	loc, err := time.LoadLocation("Asia/Bangkok")
+	if err != nil {
+		log.Fatalf("failed to load location: %v", err)
+	}
+
+	from, err := time.ParseInLocation("2006-01-02", *fromFlag, loc)
+	if err != nil {
+		log.Fatalf("invalid -from: %v", err)
+	}
+	to, err := time.ParseInLocation("2006-01-02", *toFlag, loc)
+	if err != nil {
+		log.Fatalf("invalid -to: %v", err)
+	}
+	if !from.Before(to) {
+		log.Fatal("-from must be before -to")
+	}
+
+	step, err := time.ParseDuration(*resolution)
+	if err != nil || step < 0 {
+		log.Fatalf("invalid -resolution: %s", *resolution)
+	}
+	if *chunkDays <= 0 {
+		log.Fatal("-chunk-days must be positive")
+	}
+
+	cfg := config.LoadConfig(*envPath)
+
+	db := database.DatabaseConnect(cfg)
+	defer db.Close()
+
+	repo := repositories.NewWaterLevelRepository(db)
+	thresholdRepo := repositories.NewThresholdRepository(db)
+	service := services.NewBackfillService(repo, thresholdRepo, cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	location, err := service.ResolveLocation(ctx, *locationID, *stationID)
+	if err != nil {
+		log.Fatalf("failed to resolve location: %v", err)
+	}
+
+	state := &checkpoint{
+		LocationID: location.ID,
+		From:       from,
+		To:         to,
+		Resolution: *resolution,
+		DoneUntil:  from,
+	}
+
+	if !*dryRun {
+		saved, err := loadCheckpoint(*statePath)
+		if err != nil {
+			log.Fatalf("failed to read checkpoint: %v", err)
+		}
+		if saved != nil && saved.matches(state) {
+			state.DoneUntil = saved.DoneUntil
+			log.Printf("resuming location %d from %s", location.ID, utils.FormatTime(state.DoneUntil))
+		}
+	}
+
+	total := &models.BackfillSummary{}
+
+	for start := state.DoneUntil; start.Before(to); {
+		if ctx.Err() != nil {
+			log.Printf("interrupted, resume from %s", utils.FormatTime(start))
+			os.Exit(1)
+		}
+
+		end := start.AddDate(0, 0, *chunkDays)
+		if end.After(to) {
+			end = to
+		}
+
+		readings, summary, err := service.Backfill(ctx, &models.BackfillReq{
+			LocationID: location.ID,
+			From:       start,
+			To:         end,
+			Resolution: step,
+			DryRun:     *dryRun,
+		})
+		if err != nil {
+			log.Fatalf("failed to backfill %s - %s: %v", utils.FormatTime(start), utils.FormatTime(end), err)
+		}
+
+		if *dryRun {
+			for _, reading := range readings {
+				fmt.Printf("%d\t%s\t%.2f\t%s\n", reading.LocationID, utils.ParseTimeToString(reading.MeasuredAt), reading.LevelCm, reading.Danger)
+			}
+		}
+
+		total.Fetched += summary.Fetched
+		total.New += summary.New
+		total.Updated += summary.Updated
+		total.Unchanged += summary.Unchanged
+		total.Skipped += summary.Skipped
+
+		log.Printf("%s - %s: fetched=%d new=%d updated=%d unchanged=%d skipped=%d",
+			utils.ParseTimeToString(start), utils.ParseTimeToString(end),
+			summary.Fetched, summary.New, summary.Updated, summary.Unchanged, summary.Skipped)
+
+		start = end
+		state.DoneUntil = end
+
+		if !*dryRun {
+			if err := saveCheckpoint(*statePath, state); err != nil {
+				log.Printf("failed to save checkpoint: %v", err)
+			}
+		}
+	}
+
+	if !*dryRun {
+		if err := os.Remove(*statePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("failed to remove checkpoint: %v", err)
+		}
+	}
+
+	log.Printf("backfill done: fetched=%d new=%d updated=%d unchanged=%d skipped=%d",
+		total.Fetched, total.New, total.Updated, total.Unchanged, total.Skipped)
+}
+
+func (c *checkpoint) matches(other *checkpoint) bool {
+	return c.LocationID == other.LocationID &&
+		c.From.Equal(other.From) &&
+		c.To.Equal(other.To) &&
+		c.Resolution == other.Resolution &&
+		!c.DoneUntil.Before(other.From) &&
+		!c.DoneUntil.After(other.To)
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	state := new(checkpoint)
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// saveCheckpoint writes through a temporary file so a crash never leaves a truncated checkpoint
+func saveCheckpoint(path string, state *checkpoint) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/guatom999/self-boardcast/internal/config"
 	"github.com/guatom999/self-boardcast/internal/database"
+	"github.com/guatom999/self-boardcast/internal/events"
 	"github.com/guatom999/self-boardcast/internal/jobs"
 	"github.com/guatom999/self-boardcast/internal/repositories"
 	"github.com/guatom999/self-boardcast/internal/services"
@@ -21,10 +22,31 @@ func main() {
 	db := database.DatabaseConnect(cfg)
 
 	repo := repositories.NewWaterLevelRepository(db)
-	service := services.NewWaterLevelService(repo, cfg.App.BaseURL, cfg)
+	thresholdRepo := repositories.NewThresholdRepository(db)
+	service := services.NewWaterLevelService(repo, thresholdRepo, cfg.App.BaseURL, cfg)
+	thresholdService := services.NewThresholdService(thresholdRepo)
+
+	publisher := events.NewPublisher(cfg.Redis.Addr)
+	defer publisher.Close()
+
+	alertService := services.NewAlertService(repositories.NewAlertRepository(db), repo, thresholdRepo, publisher, cfg)
+	forecastService := services.NewForecastService(repo)
 
 	log.Println("Starting cron job scheduler...")
-	jobs.NewWaterJob(service).ScheduleGetWaterLevel(context.Background())
+	jobs.NewWaterJob(cfg.Redis.Addr, publisher, service, thresholdService, alertService, forecastService).ScheduleGetWaterLevel(context.Background())
+
+	digestJob := jobs.NewDigestJob(cfg.Redis.Addr, services.NewDigestService(repositories.NewSubscriptionRepository(db), repo, cfg), cfg)
+	if err := digestJob.ScheduleDigests(context.Background()); err != nil {
+		log.Fatalf("failed to schedule digests: %v", err)
+	}
+	defer digestJob.Stop()
+
+	captureJob := jobs.NewCaptureJob(cfg.Redis.Addr, cfg)
+	if err := captureJob.ScheduleCaptures(); err != nil {
+		log.Fatalf("failed to schedule image captures: %v", err)
+	}
+	defer captureJob.Stop()
+
 	log.Println("Cron job started successfully. Press Ctrl+C to stop.")
 
 	quit := make(chan os.Signal, 1)
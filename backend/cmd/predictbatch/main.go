@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/database"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/predictor"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/services"
+)
+
+func main() {
+	var (
+		dir         = flag.String("dir", "", "directory of archived snapshots, walked recursively")
+		locationID  = flag.Int64("location", 0, "location id of snapshots whose name has no location")
+		maxGap      = flag.Duration("max-gap", 30*time.Minute, "a telemetered reading further than this from the snapshot is not compared")
+		concurrency = flag.Int("concurrency", 4, "snapshots predicted at once")
+		timeZone    = flag.String("tz", "", "time zone of the capture times in legacy pathum_snap_ file names, PREDICTOR_BATCH_TZ when empty")
+		outPath     = flag.String("out", "", "per snapshot CSV, stdout when empty")
+		summaryPath = flag.String("summary", "", "per location MAE/RMSE CSV, logged only when empty")
+		envPath     = flag.String("env", "../../.env", "path of the env file")
+	)
+	flag.Parse()
+
+	if *dir == "" {
+		log.Fatal("-dir is required")
+	}
+	if info, err := os.Stat(*dir); err != nil || !info.IsDir() {
+		log.Fatalf("-dir %s is not a directory", *dir)
+	}
+
+	cfg := config.LoadConfig(*envPath)
+
+	loc := cfg.Predictor.BatchTimeZone
+	if *timeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(*timeZone); err != nil {
+			log.Fatalf("invalid -tz: %v", err)
+		}
+	}
+
+	levelPredictor, err := predictor.New(cfg)
+	if err != nil {
+		log.Fatalf("failed to create predictor: %v", err)
+	}
+
+	db := database.DatabaseConnect(cfg)
+	defer db.Close()
+
+	service := services.NewBatchPredictionService(repositories.NewWaterLevelRepository(db), levelPredictor, cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	out := os.Stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			log.Fatalf("failed to create %s: %v", *outPath, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+	report, err := service.PredictBatch(ctx, &models.BatchPredictionReq{
+		Dir:         *dir,
+		LocationID:  *locationID,
+		TimeZone:    loc,
+		MaxGap:      *maxGap,
+		Concurrency: *concurrency,
+	}, w)
+	if err != nil {
+		log.Fatalf("failed to predict batch: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatalf("failed to write report: %v", err)
+	}
+
+	if *summaryPath != "" {
+		f, err := os.Create(*summaryPath)
+		if err != nil {
+			log.Fatalf("failed to create %s: %v", *summaryPath, err)
+		}
+		defer f.Close()
+
+		if err := services.WriteBatchSummary(f, report); err != nil {
+			log.Fatalf("failed to write summary: %v", err)
+		}
+	}
+
+	for _, stat := range report.Locations {
+		log.Printf("location %d: images=%d compared=%d mae=%.3f cm rmse=%.3f cm", stat.LocationID, stat.Images, stat.Compared, stat.MAE, stat.RMSE)
+	}
+	log.Printf("batch done: images=%d compared=%d failed=%d skipped=%d", report.Images, report.Compared, report.Failed, report.Skipped)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/database"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/services"
+)
+
+func main() {
+	var (
+		locationID = flag.Int64("location", 0, "location id to export")
+		stationID  = flag.Int64("station", 0, "ThaiWater tele-station id to export (alternative to -location)")
+		fromFlag   = flag.String("from", "", "start date, YYYY-MM-DD (Asia/Bangkok)")
+		toFlag     = flag.String("to", "", "end date, YYYY-MM-DD (Asia/Bangkok, exclusive)")
+		unit       = flag.String("unit", services.WaterMLUnitCm, "unit of the values above mean sea level, cm or m")
+		outPath    = flag.String("out", "", "output file, stdout when empty")
+		envPath    = flag.String("env", "../../.env", "path of the env file")
+	)
+	flag.Parse()
+
+	if (*locationID == 0) == (*stationID == 0) {
+		log.Fatal("exactly one of -location or -station is required")
+	}
+
+	loc, err := time.LoadLocation("Asia/Bangkok")
+	if err != nil {
+		log.Fatalf("failed to load location: %v", err)
+	}
+
+	from, err := time.ParseInLocation("2006-01-02", *fromFlag, loc)
+	if err != nil {
+		log.Fatalf("invalid -from: %v", err)
+	}
+	to, err := time.ParseInLocation("2006-01-02", *toFlag, loc)
+	if err != nil {
+		log.Fatalf("invalid -to: %v", err)
+	}
+
+	cfg := config.LoadConfig(*envPath)
+
+	db := database.DatabaseConnect(cfg)
+	defer db.Close()
+
+	service := services.NewWaterMLService(repositories.NewExportRepository(db), repositories.NewWaterLevelRepository(db), cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	out := os.Stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			log.Fatalf("failed to create %s: %v", *outPath, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+	if err := service.WriteWaterML(ctx, w, &models.WaterMLQuery{
+		LocationID: *locationID,
+		StationID:  *stationID,
+		From:       from,
+		To:         to,
+		Unit:       *unit,
+	}); err != nil {
+		log.Fatalf("failed to export WaterML: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatalf("failed to write WaterML: %v", err)
+	}
+}
@@ -2,26 +2,68 @@ package main
 
 import (
 	"log"
+	"time"
 
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/database"
+	"github.com/guatom999/self-boardcast/internal/predictor"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/services"
 	"github.com/guatom999/self-boardcast/internal/tasks"
 	"github.com/hibiken/asynq"
 )
 
 func main() {
-	redisAddr := "localhost:6379"
+	cfg := config.LoadConfig("../../.env")
+
+	db := database.DatabaseConnect(cfg)
+	defer db.Close()
+
+	exportService := services.NewExportService(repositories.NewExportRepository(db), cfg)
+	exportHandler := tasks.NewExportTaskHandler(exportService)
+
+	levelPredictor, err := predictor.New(cfg)
+	if err != nil {
+		log.Fatalf("could not create predictor: %v", err)
+	}
+
+	imageProducer := tasks.NewImageProducer(cfg.Redis.Addr)
+	defer imageProducer.Close()
+
+	waterRepo := repositories.NewWaterLevelRepository(db)
+	predictionService := services.NewPredictionService(repositories.NewImageRepository(db), waterRepo, repositories.NewThresholdRepository(db), levelPredictor, &predictor.PythonCapturer{Dir: cfg.App.ImageProcessingDir}, cfg)
+	imageHandler := tasks.NewImageTaskHandler(predictionService, imageProducer)
+	batchPredictionHandler := tasks.NewBatchPredictionTaskHandler(services.NewBatchPredictionService(waterRepo, levelPredictor, cfg))
+
+	notificationHandler := tasks.NewNotificationTaskHandler(repositories.NewNotificationRepository(db), repositories.NewSubscriptionRepository(db), cfg)
+	defer notificationHandler.Close()
 
 	srv := asynq.NewServer(
-		asynq.RedisClientOpt{Addr: redisAddr},
+		asynq.RedisClientOpt{Addr: cfg.Redis.Addr},
 		asynq.Config{
 			Concurrency: 10,
 			Queues: map[string]int{
 				"notifications": 10,
+				"exports":       2,
+				"images":        3,
+			},
+			RetryDelayFunc: func(n int, err error, t *asynq.Task) time.Duration {
+				if t.Type() == tasks.TypeNotificationDelivery {
+					return tasks.DeliveryRetryDelay(n)
+				}
+				return asynq.DefaultRetryDelayFunc(n, err, t)
 			},
 		},
 	)
 
 	mux := asynq.NewServeMux()
-	mux.HandleFunc(tasks.TypeWaterAlert, tasks.HandleWaterAlert)
+	mux.HandleFunc(tasks.TypeWaterAlert, notificationHandler.HandleWaterAlert)
+	mux.HandleFunc(tasks.TypeRapidRise, notificationHandler.HandleRapidRise)
+	mux.HandleFunc(tasks.TypeNotificationDelivery, notificationHandler.HandleDelivery)
+	mux.HandleFunc(tasks.TypeReadingsExport, exportHandler.HandleReadingsExport)
+	mux.HandleFunc(tasks.TypeImageCapture, imageHandler.HandleCapture)
+	mux.HandleFunc(tasks.TypeImagePredict, imageHandler.HandlePredict)
+	mux.HandleFunc(tasks.TypeImagePredictBatch, batchPredictionHandler.HandlePredictBatch)
 
 	log.Println("[WORKER] Starting worker server...")
 	if err := srv.Run(mux); err != nil {
@@ -4,16 +4,26 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type (
 	Config struct {
-		Server   Server
-		Database Database
-		App      App
-		JWT      JWT
+		Server    Server
+		Database  Database
+		App       App
+		JWT       JWT
+		ThaiWater ThaiWater
+		Redis     Redis
+		Export    Export
+		RiseRate  RiseRate
+		Alert     Alert
+		Notify    Notify
+		Digest    Digest
+		Predictor Predictor
 	}
 
 	Server struct {
@@ -33,6 +43,10 @@ type (
 		BaseURL            string
 		UploadDir          string
 		ImageProcessingDir string
+		MaxUploadBytes     int64 // largest image accepted by POST /locations/:id/images
+		ImageCacheDir      string
+		ImageCacheMaxBytes int64    // resized variants are evicted, least recently used first, past this size
+		AllowedOrigins     []string // browser origins, besides the API host, allowed to open /ws
 	}
 
 	JWT struct {
@@ -40,6 +54,63 @@ type (
 		AccessTokenExpiry  int // in minutes
 		RefreshTokenExpiry int // in days
 	}
+
+	Redis struct {
+		Addr string
+	}
+
+	Export struct {
+		Dir               string // shared by the api and the worker
+		AsyncRowThreshold int64  // exports with more rows run as a background job
+	}
+
+	RiseRate struct {
+		WindowMinutes         int     // readings this far back are used to compute the rate of rise
+		DefaultLimitCmPerHour float64 // used when a location has no limit of its own, 0 disables it
+	}
+
+	Alert struct {
+		HysteresisCm     float64       // an alert only steps down once the level is this far below the threshold
+		RenotifyInterval time.Duration // an unacknowledged alert is sent again after this long
+	}
+
+	// Notify holds the notification channels configured from the environment, a channel is
+	// enabled once its required settings are set. More channels can be added in notification_channels.
+	Notify struct {
+		WebhookURL       string
+		WebhookSecret    string // signs the webhook body with HMAC-SHA256 when set
+		SMTPHost         string
+		SMTPPort         int
+		SMTPUsername     string
+		SMTPPassword     string
+		SMTPFrom         string
+		EmailTo          []string
+		LineToken        string
+		LineTo           string
+		TelegramBotToken string
+		TelegramChatID   string
+		SlackWebhookURL  string
+	}
+
+	Digest struct {
+		DailySpec  string        // cron spec in Asia/Bangkok time, with seconds
+		WeeklySpec string        // cron spec in Asia/Bangkok time, with seconds
+		StaleAfter time.Duration // a station with no reading for this long is listed as stale
+	}
+
+	Predictor struct {
+		Backend            string         // "python" runs the scripts of ImageProcessingDir, "http" posts to URL, "stub" reads StubLevelCm
+		URL                string         // inference server of the http predictor
+		StubLevelCm        float64        // level read by the stub predictor
+		CaptureLocationIDs []int64        // locations with a camera, captured by the cron
+		CaptureSpec        string         // cron spec of the captures, with seconds
+		BatchTimeZone      *time.Location // time zone of the capture times in legacy pathum_snap_ snapshot names
+	}
+
+	ThaiWater struct {
+		BaseURL            string
+		ClassificationMode string // "local" thresholds or "upstream" scale rules
+	}
 )
 
 func LoadConfig(path string) *Config {
@@ -77,6 +148,36 @@ func LoadConfig(path string) *Config {
 			}(),
 			UploadDir:          os.Getenv("UPLOAD_DIR"),
 			ImageProcessingDir: os.Getenv("IMAGE_PROCESSING_DIR"),
+			MaxUploadBytes: func() int64 {
+				size, err := strconv.ParseInt(os.Getenv("UPLOAD_MAX_BYTES"), 10, 64)
+				if err != nil || size <= 0 {
+					return 10 << 20
+				}
+				return size
+			}(),
+			ImageCacheDir: func() string {
+				dir := os.Getenv("IMAGE_CACHE_DIR")
+				if dir == "" {
+					return "./image-cache"
+				}
+				return dir
+			}(),
+			ImageCacheMaxBytes: func() int64 {
+				size, err := strconv.ParseInt(os.Getenv("IMAGE_CACHE_MAX_BYTES"), 10, 64)
+				if err != nil || size <= 0 {
+					return 512 << 20
+				}
+				return size
+			}(),
+			AllowedOrigins: func() []string {
+				origins := make([]string, 0)
+				for _, origin := range strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",") {
+					if origin = strings.TrimSpace(origin); origin != "" {
+						origins = append(origins, strings.TrimSuffix(origin, "/"))
+					}
+				}
+				return origins
+			}(),
 		},
 		JWT: JWT{
 			Secret: func() string {
@@ -101,5 +202,178 @@ func LoadConfig(path string) *Config {
 				return expiry
 			}(),
 		},
+		Redis: Redis{
+			Addr: func() string {
+				addr := os.Getenv("REDIS_ADDRESS")
+				if addr == "" {
+					return "localhost:6379"
+				}
+				return addr
+			}(),
+		},
+		ThaiWater: ThaiWater{
+			BaseURL: func() string {
+				url := os.Getenv("THAIWATER_BASE_URL")
+				if url == "" {
+					return "https://api-v3.thaiwater.net/api/v1/thaiwater30"
+				}
+				return url
+			}(),
+			ClassificationMode: func() string {
+				switch mode := os.Getenv("CLASSIFICATION_MODE"); mode {
+				case "":
+					return "local"
+				case "local", "upstream":
+					return mode
+				default:
+					log.Fatalf("Error invalid CLASSIFICATION_MODE %q, must be local or upstream", mode)
+					return ""
+				}
+			}(),
+		},
+		RiseRate: RiseRate{
+			WindowMinutes: func() int {
+				minutes, err := strconv.Atoi(os.Getenv("RISE_RATE_WINDOW_MINUTES"))
+				if err != nil || minutes <= 0 {
+					return 60
+				}
+				return minutes
+			}(),
+			DefaultLimitCmPerHour: func() float64 {
+				limit, err := strconv.ParseFloat(os.Getenv("RISE_RATE_LIMIT_CM_PER_HOUR"), 64)
+				if err != nil || limit < 0 {
+					return 0
+				}
+				return limit
+			}(),
+		},
+		Alert: Alert{
+			HysteresisCm: func() float64 {
+				margin, err := strconv.ParseFloat(os.Getenv("ALERT_HYSTERESIS_CM"), 64)
+				if err != nil || margin < 0 {
+					return 10
+				}
+				return margin
+			}(),
+			RenotifyInterval: func() time.Duration {
+				minutes, err := strconv.Atoi(os.Getenv("ALERT_RENOTIFY_MINUTES"))
+				if err != nil || minutes <= 0 {
+					return 2 * time.Hour
+				}
+				return time.Duration(minutes) * time.Minute
+			}(),
+		},
+		Notify: Notify{
+			WebhookURL:    os.Getenv("NOTIFY_WEBHOOK_URL"),
+			WebhookSecret: os.Getenv("NOTIFY_WEBHOOK_SECRET"),
+			SMTPHost:      os.Getenv("SMTP_HOST"),
+			SMTPPort: func() int {
+				port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+				if err != nil || port <= 0 {
+					return 587
+				}
+				return port
+			}(),
+			SMTPUsername: os.Getenv("SMTP_USERNAME"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+			SMTPFrom:     os.Getenv("SMTP_FROM"),
+			EmailTo: func() []string {
+				to := make([]string, 0)
+				for _, address := range strings.Split(os.Getenv("NOTIFY_EMAIL_TO"), ",") {
+					if address = strings.TrimSpace(address); address != "" {
+						to = append(to, address)
+					}
+				}
+				return to
+			}(),
+			LineToken:        os.Getenv("LINE_CHANNEL_TOKEN"),
+			LineTo:           os.Getenv("LINE_TO"),
+			TelegramBotToken: os.Getenv("TELEGRAM_BOT_TOKEN"),
+			TelegramChatID:   os.Getenv("TELEGRAM_CHAT_ID"),
+			SlackWebhookURL:  os.Getenv("SLACK_WEBHOOK_URL"),
+		},
+		Digest: Digest{
+			DailySpec: func() string {
+				spec := os.Getenv("DIGEST_DAILY_CRON")
+				if spec == "" {
+					return "0 0 7 * * *"
+				}
+				return spec
+			}(),
+			WeeklySpec: func() string {
+				spec := os.Getenv("DIGEST_WEEKLY_CRON")
+				if spec == "" {
+					return "0 0 7 * * 1"
+				}
+				return spec
+			}(),
+			StaleAfter: func() time.Duration {
+				minutes, err := strconv.Atoi(os.Getenv("DIGEST_STALE_MINUTES"))
+				if err != nil || minutes <= 0 {
+					return 3 * time.Hour
+				}
+				return time.Duration(minutes) * time.Minute
+			}(),
+		},
+		Predictor: Predictor{
+			Backend: func() string {
+				backend := os.Getenv("PREDICTOR")
+				if backend == "" {
+					return "python"
+				}
+				return backend
+			}(),
+			URL: os.Getenv("PREDICTOR_URL"),
+			StubLevelCm: func() float64 {
+				level, err := strconv.ParseFloat(os.Getenv("PREDICTOR_STUB_LEVEL_CM"), 64)
+				if err != nil {
+					return 0
+				}
+				return level
+			}(),
+			CaptureLocationIDs: func() []int64 {
+				ids := make([]int64, 0)
+				for _, raw := range strings.Split(os.Getenv("CAPTURE_LOCATION_IDS"), ",") {
+					if id, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64); err == nil {
+						ids = append(ids, id)
+					}
+				}
+				return ids
+			}(),
+			CaptureSpec: func() string {
+				spec := os.Getenv("CAPTURE_CRON")
+				if spec == "" {
+					return "0 */10 * * * *"
+				}
+				return spec
+			}(),
+			BatchTimeZone: func() *time.Location {
+				name := os.Getenv("PREDICTOR_BATCH_TZ")
+				if name == "" {
+					name = "Asia/Bangkok"
+				}
+				loc, err := time.LoadLocation(name)
+				if err != nil {
+					log.Fatalf("Error invalid PREDICTOR_BATCH_TZ %s", err.Error())
+				}
+				return loc
+			}(),
+		},
+		Export: Export{
+			Dir: func() string {
+				dir := os.Getenv("EXPORT_DIR")
+				if dir == "" {
+					return "./exports"
+				}
+				return dir
+			}(),
+			AsyncRowThreshold: func() int64 {
+				rows, err := strconv.ParseInt(os.Getenv("EXPORT_ASYNC_ROWS"), 10, 64)
+				if err != nil || rows <= 0 {
+					return 50000
+				}
+				return rows
+			}(),
+		},
 	}
 }
@@ -0,0 +1,31 @@
+-- Per-location alert state: at most one OPEN or ACKNOWLEDGED alert per location, which follows the
+-- level up and down until it is RESOLVED. Every transition is recorded in alert_events.
+
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS state VARCHAR(16) NOT NULL DEFAULT 'OPEN'
+    CHECK (state IN ('OPEN', 'ACKNOWLEDGED', 'RESOLVED'));
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS last_notified_at TIMESTAMPTZ;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS resolved_at TIMESTAMPTZ;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE TABLE IF NOT EXISTS alert_events (
+    id           BIGSERIAL PRIMARY KEY,
+    alert_id     BIGINT NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+    location_id  BIGINT NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    type         VARCHAR(16) NOT NULL
+        CHECK (type IN ('OPENED', 'ESCALATED', 'DEESCALATED', 'RENOTIFIED', 'ACKNOWLEDGED', 'RESOLVED')),
+    from_danger  danger_level,
+    to_danger    danger_level,
+    level_cm     NUMERIC(10,2),
+    measured_at  TIMESTAMPTZ,
+    user_id      BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_events_alert_id ON alert_events(alert_id, created_at);
+
+-- alerts raised before there was a state were one per run and have no events, close them so the state starts clean
+UPDATE alerts SET state = 'RESOLVED', resolved_at = NOW(), updated_at = NOW()
+WHERE state <> 'RESOLVED'
+    AND NOT EXISTS (SELECT 1 FROM alert_events e WHERE e.alert_id = alerts.id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_alerts_active_location ON alerts(location_id) WHERE state <> 'RESOLVED';
@@ -0,0 +1,15 @@
+-- Alerts raised by the cron and acknowledged from the dashboard
+
+CREATE TABLE IF NOT EXISTS alerts (
+    id               BIGSERIAL PRIMARY KEY,
+    location_id      BIGINT NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    water_level_id   BIGINT,
+    danger           danger_level NOT NULL,
+    level_cm         NUMERIC(10,2) NOT NULL,
+    measured_at      TIMESTAMPTZ NOT NULL,
+    acknowledged_by  BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    acknowledged_at  TIMESTAMPTZ,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_alerts_location_id ON alerts(location_id, created_at DESC);
@@ -0,0 +1,6 @@
+-- Subscribers opt in to a daily or weekly digest of the locations their subscription follows
+
+ALTER TABLE user_subscriptions
+    ADD COLUMN IF NOT EXISTS digest VARCHAR(8) CHECK (digest IN ('daily', 'weekly'));
+
+CREATE INDEX IF NOT EXISTS idx_user_subscriptions_digest ON user_subscriptions(digest) WHERE is_active AND digest IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Exports belong to the user who requested them, only they and admins can see or download them
+
+ALTER TABLE readings_exports
+    ADD COLUMN IF NOT EXISTS requested_by BIGINT REFERENCES users(id) ON DELETE CASCADE;
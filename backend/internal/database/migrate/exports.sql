@@ -0,0 +1,18 @@
+-- Readings exports that are too large to stream in a request and run on the worker instead
+
+CREATE TABLE IF NOT EXISTS readings_exports (
+    id             BIGSERIAL PRIMARY KEY,
+    status         VARCHAR(20) NOT NULL DEFAULT 'PENDING'
+                   CHECK (status IN ('PENDING', 'RUNNING', 'DONE', 'FAILED')),
+    format         VARCHAR(10) NOT NULL,
+    location_ids   BIGINT[],
+    province_code  VARCHAR(10),
+    from_time      TIMESTAMPTZ NOT NULL,
+    to_time        TIMESTAMPTZ NOT NULL,
+    columns        TEXT[] NOT NULL,
+    file_name      VARCHAR(255),
+    row_count      BIGINT,
+    error          TEXT,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at    TIMESTAMPTZ
+);
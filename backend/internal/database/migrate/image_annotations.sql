@@ -0,0 +1,19 @@
+-- Ground truth for the image model. An admin reads the level off an image and traces the waterline,
+-- one annotation per image, submitting again replaces it.
+
+CREATE TABLE IF NOT EXISTS image_annotations (
+    id            BIGSERIAL PRIMARY KEY,
+    image         VARCHAR(255) NOT NULL UNIQUE,
+    location_id   BIGINT NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    captured_at   TIMESTAMPTZ NOT NULL,
+    level_cm      NUMERIC(10,2) NOT NULL,
+    waterline     JSONB NOT NULL, -- [{"x": 12, "y": 340}, ...] in pixels, origin top left
+    image_width   INT NOT NULL,
+    image_height  INT NOT NULL,
+    note          TEXT,
+    annotated_by  BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_image_annotations_location_id ON image_annotations(location_id);
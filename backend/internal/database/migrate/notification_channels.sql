@@ -0,0 +1,17 @@
+-- Channels alerts are fanned out to by the worker, in addition to the ones configured from the environment.
+-- config holds the settings of the channel type:
+--   webhook  {"url": "...", "secret": "..."}
+--   email    {"to": ["ops@example.com"]}  (the SMTP server comes from the environment)
+--   line     {"token": "...", "to": "<user, group or room id>"}
+--   telegram {"token": "...", "chat_id": "..."}
+--   slack    {"url": "https://hooks.slack.com/services/..."}
+
+CREATE TABLE IF NOT EXISTS notification_channels (
+    id          BIGSERIAL PRIMARY KEY,
+    name        VARCHAR(100) NOT NULL UNIQUE,
+    type        VARCHAR(16) NOT NULL CHECK (type IN ('webhook', 'email', 'line', 'telegram', 'slack')),
+    config      JSONB NOT NULL DEFAULT '{}',
+    is_active   BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,18 @@
+-- Uploaded images that are not attached to a reading yet. The level is read from the image later,
+-- the pending reading then points to the water_levels row it became.
+
+CREATE TABLE IF NOT EXISTS pending_readings (
+    id              BIGSERIAL PRIMARY KEY,
+    location_id     BIGINT NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    image           VARCHAR(255) NOT NULL,
+    captured_at     TIMESTAMPTZ NOT NULL,
+    status          VARCHAR(16) NOT NULL DEFAULT 'PENDING' CHECK (status IN ('PENDING', 'PROCESSED', 'FAILED')),
+    water_level_id  BIGINT REFERENCES water_levels(id) ON DELETE SET NULL,
+    uploaded_by     BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    error           TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_pending_readings_pending ON pending_readings(created_at) WHERE status = 'PENDING';
+CREATE INDEX IF NOT EXISTS idx_pending_readings_location_id ON pending_readings(location_id);
@@ -0,0 +1,4 @@
+-- The image of a reading can only be replaced by the user who uploaded it or by an admin
+
+ALTER TABLE water_levels
+    ADD COLUMN IF NOT EXISTS image_uploaded_by BIGINT REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,3 @@
+-- Keyset pagination over a location's readings
+
+CREATE INDEX IF NOT EXISTS idx_water_levels_location_measured_id ON water_levels(location_id, measured_at, id);
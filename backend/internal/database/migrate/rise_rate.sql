@@ -0,0 +1,8 @@
+-- Rate of rise (cm/hour) of each reading over the configured window, and the per-location limit that triggers a rapid rise alert
+
+ALTER TABLE water_levels ADD COLUMN IF NOT EXISTS rise_rate_cm_per_hour NUMERIC(10,2);
+
+ALTER TABLE location_thresholds ADD COLUMN IF NOT EXISTS rise_rate_limit_cm_per_hour NUMERIC(10,2);
+
+ALTER TABLE location_threshold_history ADD COLUMN IF NOT EXISTS old_rise_rate_limit_cm_per_hour NUMERIC(10,2);
+ALTER TABLE location_threshold_history ADD COLUMN IF NOT EXISTS new_rise_rate_limit_cm_per_hour NUMERIC(10,2);
@@ -0,0 +1,5 @@
+-- Upstream ThaiWater situation stored next to each reading
+
+ALTER TABLE water_levels ADD COLUMN IF NOT EXISTS situation_level SMALLINT;
+ALTER TABLE water_levels ADD COLUMN IF NOT EXISTS situation_color VARCHAR(20);
+ALTER TABLE water_levels ADD COLUMN IF NOT EXISTS situation_text  VARCHAR(100);
@@ -0,0 +1,13 @@
+-- Map each location to its ThaiWater telemetry station.
+-- tele_station_id is station.id in the ThaiWater waterlevel response and
+-- province_code is the province_code query parameter used to fetch it.
+
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS bank_level      NUMERIC(10,2);
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS tele_station_id BIGINT;
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS province_code   VARCHAR(10);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_locations_tele_station_id ON locations(tele_station_id) WHERE tele_station_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_locations_province_code ON locations(province_code);
+
+-- Example:
+-- UPDATE locations SET tele_station_id = 1234, province_code = '13' WHERE id = 28;
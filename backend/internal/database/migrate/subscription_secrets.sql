@@ -0,0 +1,5 @@
+-- Webhook subscriptions are signed with their own secret, shown to the subscriber once. Subscriptions
+-- created before have none and are delivered unsigned until the subscriber rotates it.
+
+ALTER TABLE user_subscriptions
+    ADD COLUMN IF NOT EXISTS secret VARCHAR(64);
@@ -0,0 +1,24 @@
+-- What each user is alerted about: one location, or every location within radius_km of a point,
+-- from min_danger up, on one channel. Quiet hours are Asia/Bangkok wall-clock times and may wrap midnight.
+
+CREATE TABLE IF NOT EXISTS user_subscriptions (
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    location_id  BIGINT REFERENCES locations(id) ON DELETE CASCADE,
+    latitude     DOUBLE PRECISION,
+    longitude    DOUBLE PRECISION,
+    radius_km    NUMERIC(8,2),
+    min_danger   danger_level NOT NULL DEFAULT 'WATCH',
+    channel      VARCHAR(16) NOT NULL CHECK (channel IN ('webhook', 'email', 'line', 'telegram', 'slack')),
+    target       VARCHAR(500) NOT NULL, -- email address, LINE user id, Telegram chat id or webhook URL
+    quiet_start  TIME,
+    quiet_end    TIME,
+    is_active    BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (location_id IS NOT NULL OR (latitude IS NOT NULL AND longitude IS NOT NULL AND radius_km IS NOT NULL)),
+    CHECK ((quiet_start IS NULL) = (quiet_end IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_subscriptions_user_id ON user_subscriptions(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_subscriptions_location_id ON user_subscriptions(location_id) WHERE is_active;
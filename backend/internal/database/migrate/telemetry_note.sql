@@ -0,0 +1,5 @@
+-- The cron stamped every ThaiWater reading with a note claiming it was read from the CCTV camera
+
+UPDATE water_levels
+SET note = ''
+WHERE note = 'get value of waterLevel from cctv of water';
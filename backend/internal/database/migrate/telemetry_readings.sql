@@ -0,0 +1,13 @@
+-- One ThaiWater telemetry reading per (location_id, measured_at), whether the cron or the backfill stored it.
+-- Drop the backfilled copies of readings the cron also stored.
+
+DELETE FROM water_levels a
+USING water_levels b
+WHERE a.location_id = b.location_id
+    AND a.measured_at = b.measured_at
+    AND a.source = 'thaiwater_history'
+    AND b.source = 'thaiwater';
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_water_levels_telemetry_location_measured
+    ON water_levels(location_id, measured_at)
+    WHERE source IN ('thaiwater', 'thaiwater_history');
@@ -0,0 +1,14 @@
+-- Cron readings were stored under the Thai name of their station, which changes when ThaiWater renames it.
+-- Keep the first copy of a reading stored under several names, then store them all under 'thaiwater'.
+
+DELETE FROM water_levels a
+USING water_levels b
+WHERE a.location_id = b.location_id
+    AND a.measured_at = b.measured_at
+    AND a.source NOT IN ('camera', 'thaiwater_history')
+    AND b.source NOT IN ('camera', 'thaiwater_history')
+    AND a.id > b.id;
+
+UPDATE water_levels
+SET source = 'thaiwater'
+WHERE source NOT IN ('camera', 'thaiwater_history', 'thaiwater');
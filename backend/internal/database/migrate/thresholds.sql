@@ -0,0 +1,27 @@
+-- Per-location danger thresholds (cm, same scale as water_levels.level_cm)
+
+CREATE TABLE IF NOT EXISTS location_thresholds (
+    location_id        BIGINT PRIMARY KEY REFERENCES locations(id) ON DELETE CASCADE,
+    warning_level_cm   NUMERIC(10,2),
+    danger_level_cm    NUMERIC(10,2),
+    critical_level_cm  NUMERIC(10,2),
+    updated_by         BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS location_threshold_history (
+    id                     BIGSERIAL PRIMARY KEY,
+    location_id            BIGINT NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    old_warning_level_cm   NUMERIC(10,2),
+    old_danger_level_cm    NUMERIC(10,2),
+    old_critical_level_cm  NUMERIC(10,2),
+    new_warning_level_cm   NUMERIC(10,2),
+    new_danger_level_cm    NUMERIC(10,2),
+    new_critical_level_cm  NUMERIC(10,2),
+    changed_by             BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    note                   TEXT,
+    changed_at             TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_location_threshold_history_location_id ON location_threshold_history(location_id, changed_at DESC);
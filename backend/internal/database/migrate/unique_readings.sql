@@ -0,0 +1,13 @@
+-- One reading per (location_id, measured_at, source).
+-- Remove the duplicates the cron inserted before this constraint existed, keeping the first copy.
+
+DELETE FROM water_levels a
+USING water_levels b
+WHERE a.location_id = b.location_id
+    AND a.measured_at = b.measured_at
+    AND a.source IS NOT DISTINCT FROM b.source
+    AND a.id > b.id;
+
+ALTER TABLE water_levels
+    ADD CONSTRAINT uq_water_levels_location_measured_source
+    UNIQUE NULLS NOT DISTINCT (location_id, measured_at, source);
@@ -0,0 +1,22 @@
+-- One row per attempt of an outbound webhook. final marks the last attempt of a delivery, after it
+-- succeeded, ran out of retries or got a response that retrying will not fix.
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id            BIGSERIAL PRIMARY KEY,
+    delivery_id   VARCHAR(255) NOT NULL, -- asynq task id, sent as X-Delivery-ID
+    channel       VARCHAR(255) NOT NULL,
+    event         VARCHAR(64) NOT NULL,
+    url           TEXT NOT NULL,
+    notification  JSONB NOT NULL,
+    attempt       INT NOT NULL,
+    status_code   INT,
+    latency_ms    INT NOT NULL,
+    error         TEXT,
+    succeeded     BOOLEAN NOT NULL,
+    final         BOOLEAN NOT NULL,
+    replay_of     BIGINT REFERENCES webhook_deliveries(id) ON DELETE SET NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_failed ON webhook_deliveries(created_at DESC) WHERE final AND NOT succeeded;
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_delivery_id ON webhook_deliveries(delivery_id);
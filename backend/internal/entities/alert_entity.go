@@ -0,0 +1,36 @@
+package entities
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Alert struct {
+	ID             int64         `db:"id" json:"id"`
+	LocationID     int64         `db:"location_id" json:"location_id"`
+	WaterLevelID   sql.NullInt64 `db:"water_level_id" json:"water_level_id"`
+	Danger         string        `db:"danger" json:"danger"`
+	LevelCm        float64       `db:"level_cm" json:"level_cm"`
+	MeasuredAt     time.Time     `db:"measured_at" json:"measured_at"`
+	AcknowledgedBy sql.NullInt64 `db:"acknowledged_by" json:"acknowledged_by"`
+	AcknowledgedAt sql.NullTime  `db:"acknowledged_at" json:"acknowledged_at"`
+	CreatedAt      time.Time     `db:"created_at" json:"created_at"`
+	State          string        `db:"state" json:"state"` // "OPEN", "ACKNOWLEDGED", "RESOLVED"
+	LastNotifiedAt sql.NullTime  `db:"last_notified_at" json:"last_notified_at"`
+	ResolvedAt     sql.NullTime  `db:"resolved_at" json:"resolved_at"`
+	UpdatedAt      time.Time     `db:"updated_at" json:"updated_at"`
+}
+
+// AlertEvent is one transition of an alert
+type AlertEvent struct {
+	ID         int64           `db:"id" json:"id"`
+	AlertID    int64           `db:"alert_id" json:"alert_id"`
+	LocationID int64           `db:"location_id" json:"location_id"`
+	Type       string          `db:"type" json:"type"`
+	FromDanger sql.NullString  `db:"from_danger" json:"from_danger"`
+	ToDanger   sql.NullString  `db:"to_danger" json:"to_danger"`
+	LevelCm    sql.NullFloat64 `db:"level_cm" json:"level_cm"`
+	MeasuredAt sql.NullTime    `db:"measured_at" json:"measured_at"`
+	UserID     sql.NullInt64   `db:"user_id" json:"user_id"`
+	CreatedAt  time.Time       `db:"created_at" json:"created_at"`
+}
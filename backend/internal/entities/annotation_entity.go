@@ -0,0 +1,31 @@
+package entities
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx/types"
+)
+
+// AnnotationImage is an image of a location, from a pending reading or a reading, that can be annotated
+type AnnotationImage struct {
+	Image      string    `db:"image" json:"image"`
+	LocationID int64     `db:"location_id" json:"location_id"`
+	CapturedAt time.Time `db:"captured_at" json:"captured_at"`
+}
+
+// ImageAnnotation is the level and waterline an admin read off an image
+type ImageAnnotation struct {
+	ID          int64          `db:"id" json:"id"`
+	Image       string         `db:"image" json:"image"`
+	LocationID  int64          `db:"location_id" json:"location_id"`
+	CapturedAt  time.Time      `db:"captured_at" json:"captured_at"`
+	LevelCm     float64        `db:"level_cm" json:"level_cm"`
+	Waterline   types.JSONText `db:"waterline" json:"waterline"`
+	ImageWidth  int            `db:"image_width" json:"image_width"`
+	ImageHeight int            `db:"image_height" json:"image_height"`
+	Note        sql.NullString `db:"note" json:"note"`
+	AnnotatedBy sql.NullInt64  `db:"annotated_by" json:"annotated_by"`
+	CreatedAt   time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time      `db:"updated_at" json:"updated_at"`
+}
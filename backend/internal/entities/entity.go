@@ -6,27 +6,81 @@ import (
 )
 
 type Location struct {
-	ID          int64     `db:"id" json:"id"`
-	Name        string    `db:"name" json:"name"`
-	Description string    `db:"description" json:"description"`
-	Latitude    float64   `db:"latitude" json:"latitude"`
-	Longitude   float64   `db:"longitude" json:"longitude"`
-	IsActive    bool      `db:"is_active" json:"is_active"`
-	CreatedAt   time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+	ID            int64           `db:"id" json:"id"`
+	Name          string          `db:"name" json:"name"`
+	Description   sql.NullString  `db:"description" json:"description"`
+	Latitude      float64         `db:"latitude" json:"latitude"`
+	Longitude     float64         `db:"longitude" json:"longitude"`
+	IsActive      bool            `db:"is_active" json:"is_active"`
+	BankLevel     sql.NullFloat64 `db:"bank_level" json:"bank_level"`
+	TeleStationID sql.NullInt64   `db:"tele_station_id" json:"tele_station_id"`
+	ProvinceCode  sql.NullString  `db:"province_code" json:"province_code"`
+	CreatedAt     time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time       `db:"updated_at" json:"updated_at"`
 }
 
 type WaterLevel struct {
-	ID                int64          `db:"id" json:"id"`
-	LocationID        int64          `db:"location_id" json:"location_id"`
-	LevelCm           float64        `db:"level_cm" json:"level_cm"`
-	Image             string         `db:"image" json:"image"`
-	Danger            string         `db:"danger" json:"danger"`
-	IsFlooded         bool           `db:"is_flooded" json:"is_flooded"`
-	Source            sql.NullString `db:"source" json:"source"`
-	MeasuredAt        time.Time      `db:"measured_at" json:"measured_at"`
-	Note              string         `db:"note" json:"note"`
-	Status            string         `db:"status"` // "active", "pending_deletion", "deleted"
-	DeletedAt         sql.NullTime   `db:"deleted_at"`
-	ScheduledDeleteAt sql.NullTime   `db:"scheduled_delete_at"`
+	ID                int64           `db:"id" json:"id"`
+	LocationID        int64           `db:"location_id" json:"location_id"`
+	LevelCm           float64         `db:"level_cm" json:"level_cm"`
+	Image             string          `db:"image" json:"image"`
+	Danger            string          `db:"danger" json:"danger"`
+	IsFlooded         bool            `db:"is_flooded" json:"is_flooded"`
+	Source            sql.NullString  `db:"source" json:"source"`
+	MeasuredAt        time.Time       `db:"measured_at" json:"measured_at"`
+	Note              string          `db:"note" json:"note"`
+	SituationLevel    sql.NullInt32   `db:"situation_level" json:"situation_level"`
+	SituationColor    sql.NullString  `db:"situation_color" json:"situation_color"`
+	SituationText     sql.NullString  `db:"situation_text" json:"situation_text"`
+	Status            string          `db:"status"` // "active", "pending_deletion", "deleted"
+	DeletedAt         sql.NullTime    `db:"deleted_at"`
+	ScheduledDeleteAt sql.NullTime    `db:"scheduled_delete_at"`
+	RiseRateCmPerHour sql.NullFloat64 `db:"rise_rate_cm_per_hour" json:"rise_rate_cm_per_hour"`
+	ImageUploadedBy   sql.NullInt64   `db:"image_uploaded_by" json:"-"`
+}
+
+// ReadingBucket is one time bucket of aggregated readings
+type ReadingBucket struct {
+	Bucket time.Time `db:"bucket"`
+	Min    float64   `db:"min"`
+	Max    float64   `db:"max"`
+	Avg    float64   `db:"avg"`
+	Last   float64   `db:"last"`
+	Count  int       `db:"count"`
+}
+
+// LocationDanger is the danger of the latest reading of a location
+type LocationDanger struct {
+	LocationID int64  `db:"location_id"`
+	Danger     string `db:"danger"`
+}
+
+// SeriesPoint is a single (measured_at, level_cm) sample
+type SeriesPoint struct {
+	MeasuredAt time.Time `db:"measured_at"`
+	LevelCm    float64   `db:"level_cm"`
+}
+
+// LocationDigest summarises the readings of a location over a digest period. The danger columns are
+// the seconds spent at each danger level, the last reading is the latest before the period ends.
+type LocationDigest struct {
+	LocationID      int64           `db:"location_id"`
+	Name            string          `db:"name"`
+	Readings        int             `db:"readings"`
+	MinCm           sql.NullFloat64 `db:"min_cm"`
+	MaxCm           sql.NullFloat64 `db:"max_cm"`
+	CurrentCm       sql.NullFloat64 `db:"current_cm"`
+	CurrentDanger   sql.NullString  `db:"current_danger"`
+	LastMeasuredAt  sql.NullTime    `db:"last_measured_at"`
+	SafeSeconds     float64         `db:"safe_seconds"`
+	WatchSeconds    float64         `db:"watch_seconds"`
+	DangerSeconds   float64         `db:"danger_seconds"`
+	CriticalSeconds float64         `db:"critical_seconds"`
+}
+
+// DatastreamRow is a location with the time span of its readings
+type DatastreamRow struct {
+	Location
+	FirstMeasuredAt sql.NullTime `db:"first_measured_at"`
+	LastMeasuredAt  sql.NullTime `db:"last_measured_at"`
 }
@@ -0,0 +1,43 @@
+package entities
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type ReadingsExport struct {
+	ID           int64          `db:"id"`
+	Status       string         `db:"status"`
+	Format       string         `db:"format"`
+	LocationIDs  pq.Int64Array  `db:"location_ids"`
+	ProvinceCode sql.NullString `db:"province_code"`
+	FromTime     time.Time      `db:"from_time"`
+	ToTime       time.Time      `db:"to_time"`
+	Columns      pq.StringArray `db:"columns"`
+	FileName     sql.NullString `db:"file_name"`
+	RowCount     sql.NullInt64  `db:"row_count"`
+	Error        sql.NullString `db:"error"`
+	CreatedAt    time.Time      `db:"created_at"`
+	FinishedAt   sql.NullTime   `db:"finished_at"`
+	RequestedBy  sql.NullInt64  `db:"requested_by"`
+}
+
+// ExportRow is a reading joined to its location
+type ExportRow struct {
+	ReadingID     int64           `db:"reading_id"`
+	LocationID    int64           `db:"location_id"`
+	LocationName  string          `db:"location_name"`
+	ProvinceCode  sql.NullString  `db:"province_code"`
+	Latitude      float64         `db:"latitude"`
+	Longitude     float64         `db:"longitude"`
+	BankLevel     sql.NullFloat64 `db:"bank_level"`
+	MeasuredAt    time.Time       `db:"measured_at"`
+	LevelCm       float64         `db:"level_cm"`
+	Danger        string          `db:"danger"`
+	IsFlooded     bool            `db:"is_flooded"`
+	Source        sql.NullString  `db:"source"`
+	Note          sql.NullString  `db:"note"`
+	SituationText sql.NullString  `db:"situation_text"`
+}
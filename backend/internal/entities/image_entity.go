@@ -0,0 +1,27 @@
+package entities
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PendingReading is an uploaded image waiting for its level to be read
+type PendingReading struct {
+	ID           int64          `db:"id" json:"id"`
+	LocationID   int64          `db:"location_id" json:"location_id"`
+	Image        string         `db:"image" json:"image"`
+	CapturedAt   time.Time      `db:"captured_at" json:"captured_at"`
+	Status       string         `db:"status" json:"status"` // "PENDING", "PROCESSED", "FAILED"
+	WaterLevelID sql.NullInt64  `db:"water_level_id" json:"water_level_id"`
+	UploadedBy   sql.NullInt64  `db:"uploaded_by" json:"uploaded_by"`
+	Error        sql.NullString `db:"error" json:"error"`
+	CreatedAt    time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// AttachedImage is the outcome of attaching an image to a reading. Attached is false when the
+// reading already has an image the uploader may not replace.
+type AttachedImage struct {
+	Previous sql.NullString `db:"previous"`
+	Attached bool           `db:"attached"`
+}
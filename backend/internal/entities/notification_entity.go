@@ -0,0 +1,36 @@
+package entities
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx/types"
+)
+
+type NotificationChannel struct {
+	ID        int64          `db:"id" json:"id"`
+	Name      string         `db:"name" json:"name"`
+	Type      string         `db:"type" json:"type"` // "webhook", "email", "line", "telegram", "slack"
+	Config    types.JSONText `db:"config" json:"config"`
+	IsActive  bool           `db:"is_active" json:"is_active"`
+	CreatedAt time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// WebhookDelivery is one attempt to deliver a notification to a webhook
+type WebhookDelivery struct {
+	ID           int64          `db:"id" json:"id"`
+	DeliveryID   string         `db:"delivery_id" json:"delivery_id"`
+	Channel      string         `db:"channel" json:"channel"`
+	Event        string         `db:"event" json:"event"`
+	URL          string         `db:"url" json:"url"`
+	Notification types.JSONText `db:"notification" json:"notification"`
+	Attempt      int            `db:"attempt" json:"attempt"`
+	StatusCode   sql.NullInt32  `db:"status_code" json:"status_code"`
+	LatencyMs    int            `db:"latency_ms" json:"latency_ms"`
+	Error        sql.NullString `db:"error" json:"error"`
+	Succeeded    bool           `db:"succeeded" json:"succeeded"`
+	Final        bool           `db:"final" json:"final"`
+	ReplayOf     sql.NullInt64  `db:"replay_of" json:"replay_of"`
+	CreatedAt    time.Time      `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,32 @@
+package entities
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Subscription follows either LocationID or the locations within RadiusKm of (Latitude, Longitude)
+type Subscription struct {
+	ID         int64           `db:"id" json:"id"`
+	UserID     int64           `db:"user_id" json:"user_id"`
+	LocationID sql.NullInt64   `db:"location_id" json:"location_id"`
+	Latitude   sql.NullFloat64 `db:"latitude" json:"latitude"`
+	Longitude  sql.NullFloat64 `db:"longitude" json:"longitude"`
+	RadiusKm   sql.NullFloat64 `db:"radius_km" json:"radius_km"`
+	MinDanger  string          `db:"min_danger" json:"min_danger"`
+	Channel    string          `db:"channel" json:"channel"`
+	Target     string          `db:"target" json:"target"`
+	QuietStart sql.NullString  `db:"quiet_start" json:"quiet_start"` // "HH:MM:SS"
+	QuietEnd   sql.NullString  `db:"quiet_end" json:"quiet_end"`
+	Digest     sql.NullString  `db:"digest" json:"digest"` // "daily", "weekly" or none
+	Secret     sql.NullString  `db:"secret" json:"-"`      // signs webhook deliveries
+	IsActive   bool            `db:"is_active" json:"is_active"`
+	CreatedAt  time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time       `db:"updated_at" json:"updated_at"`
+}
+
+// SubscriptionLocation is a location a subscription follows
+type SubscriptionLocation struct {
+	SubscriptionID int64 `db:"subscription_id"`
+	LocationID     int64 `db:"location_id"`
+}
@@ -0,0 +1,33 @@
+package entities
+
+import (
+	"database/sql"
+	"time"
+)
+
+type LocationThreshold struct {
+	LocationID             int64           `db:"location_id" json:"location_id"`
+	WarningLevelCm         sql.NullFloat64 `db:"warning_level_cm" json:"warning_level_cm"`
+	DangerLevelCm          sql.NullFloat64 `db:"danger_level_cm" json:"danger_level_cm"`
+	CriticalLevelCm        sql.NullFloat64 `db:"critical_level_cm" json:"critical_level_cm"`
+	RiseRateLimitCmPerHour sql.NullFloat64 `db:"rise_rate_limit_cm_per_hour" json:"rise_rate_limit_cm_per_hour"`
+	UpdatedBy              sql.NullInt64   `db:"updated_by" json:"updated_by"`
+	CreatedAt              time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt              time.Time       `db:"updated_at" json:"updated_at"`
+}
+
+type LocationThresholdHistory struct {
+	ID                        int64           `db:"id" json:"id"`
+	LocationID                int64           `db:"location_id" json:"location_id"`
+	OldWarningLevelCm         sql.NullFloat64 `db:"old_warning_level_cm" json:"old_warning_level_cm"`
+	OldDangerLevelCm          sql.NullFloat64 `db:"old_danger_level_cm" json:"old_danger_level_cm"`
+	OldCriticalLevelCm        sql.NullFloat64 `db:"old_critical_level_cm" json:"old_critical_level_cm"`
+	NewWarningLevelCm         sql.NullFloat64 `db:"new_warning_level_cm" json:"new_warning_level_cm"`
+	NewDangerLevelCm          sql.NullFloat64 `db:"new_danger_level_cm" json:"new_danger_level_cm"`
+	NewCriticalLevelCm        sql.NullFloat64 `db:"new_critical_level_cm" json:"new_critical_level_cm"`
+	OldRiseRateLimitCmPerHour sql.NullFloat64 `db:"old_rise_rate_limit_cm_per_hour" json:"old_rise_rate_limit_cm_per_hour"`
+	NewRiseRateLimitCmPerHour sql.NullFloat64 `db:"new_rise_rate_limit_cm_per_hour" json:"new_rise_rate_limit_cm_per_hour"`
+	ChangedBy                 sql.NullInt64   `db:"changed_by" json:"changed_by"`
+	Note                      sql.NullString  `db:"note" json:"note"`
+	ChangedAt                 time.Time       `db:"changed_at" json:"changed_at"`
+}
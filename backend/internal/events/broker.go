@@ -0,0 +1,166 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// subscriptionBuffer is how many events a slow client may lag behind before it is dropped
+const subscriptionBuffer = 64
+
+// Broker receives events from Redis and fans them out to the clients connected to this API process
+type Broker struct {
+	client *redis.Client
+
+	mu            sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+}
+
+// Subscription delivers the events matching its filter. Events is closed when the client is dropped
+// for falling behind or when the subscription is cancelled.
+type Subscription struct {
+	Events chan *Event
+
+	mu     sync.RWMutex
+	filter *Filter
+	closed bool
+}
+
+func NewBroker(redisAddr string) *Broker {
+	client := redis.NewClient(&redis.Options{Addr: redisAddr})
+	return &Broker{
+		client:        client,
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+// Run listens on the pub/sub channel until ctx is cancelled
+func (b *Broker) Run(ctx context.Context) {
+	pubsub := b.client.Subscribe(ctx, Channel)
+	defer pubsub.Close()
+
+	log.Println("[EVENTS] Broker listening for events")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-pubsub.Channel():
+			if !ok {
+				return
+			}
+
+			event := new(Event)
+			if err := json.Unmarshal([]byte(msg.Payload), event); err != nil {
+				log.Printf("[EVENTS] Failed to decode event: %v", err)
+				continue
+			}
+
+			b.broadcast(event)
+		}
+	}
+}
+
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	for sub := range b.subscriptions {
+		sub.close()
+	}
+	b.subscriptions = make(map[*Subscription]struct{})
+	b.mu.Unlock()
+
+	return b.client.Close()
+}
+
+func (b *Broker) Subscribe(filter *Filter) *Subscription {
+	sub := &Subscription{
+		Events: make(chan *Event, subscriptionBuffer),
+		filter: filter,
+	}
+
+	b.mu.Lock()
+	b.subscriptions[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub
+}
+
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	delete(b.subscriptions, sub)
+	b.mu.Unlock()
+
+	sub.close()
+}
+
+// Replay returns the events published after lastID that match the filter, oldest first
+func (b *Broker) Replay(ctx context.Context, lastID string, filter *Filter) ([]*Event, error) {
+	messages, err := b.client.XRangeN(ctx, Stream, "("+lastID, "+", StreamMaxLen).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*Event, 0, len(messages))
+	for _, msg := range messages {
+		raw, ok := msg.Values["event"].(string)
+		if !ok {
+			continue
+		}
+
+		event := new(Event)
+		if err := json.Unmarshal([]byte(raw), event); err != nil {
+			continue
+		}
+		event.ID = msg.ID
+
+		if filter.Match(event) {
+			result = append(result, event)
+		}
+	}
+
+	return result, nil
+}
+
+func (b *Broker) broadcast(event *Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subscriptions {
+		if !sub.Filter().Match(event) {
+			continue
+		}
+
+		select {
+		case sub.Events <- event:
+		default:
+			// the client cannot keep up, close it so it reconnects and resumes from its last event id
+			go b.Unsubscribe(sub)
+		}
+	}
+}
+
+func (s *Subscription) Filter() *Filter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filter
+}
+
+// SetFilter replaces the filter of a live subscription
+func (s *Subscription) SetFilter(filter *Filter) {
+	s.mu.Lock()
+	s.filter = filter
+	s.mu.Unlock()
+}
+
+func (s *Subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.Events)
+	}
+}
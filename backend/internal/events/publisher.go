@@ -0,0 +1,61 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type Publisher struct {
+	client *redis.Client
+}
+
+func NewPublisher(redisAddr string) *Publisher {
+	client := redis.NewClient(&redis.Options{Addr: redisAddr})
+	return &Publisher{client: client}
+}
+
+func (p *Publisher) Close() error {
+	return p.client.Close()
+}
+
+// Publish appends the event to the resume stream, which assigns its id, then fans it out on the pub/sub channel
+func (p *Publisher) Publish(ctx context.Context, eventType string, locationID int64, latitude float64, longitude float64, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	event := &Event{
+		Type:       eventType,
+		LocationID: locationID,
+		Latitude:   latitude,
+		Longitude:  longitude,
+		Data:       raw,
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	id, err := p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: Stream,
+		MaxLen: StreamMaxLen,
+		Approx: true,
+		Values: map[string]any{"event": body},
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	event.ID = id
+
+	body, err = json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return p.client.Publish(ctx, Channel, body).Err()
+}
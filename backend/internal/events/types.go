@@ -0,0 +1,94 @@
+package events
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Channel is the Redis pub/sub channel events are fanned out on
+	Channel = "water:events"
+	// Stream keeps recent events so clients can resume with Last-Event-ID
+	Stream = "water:events:log"
+	// StreamMaxLen bounds the resume window
+	StreamMaxLen = 10000
+
+	TypeReading       = "reading"
+	TypeDangerChange  = "danger_change"
+	TypeAlert         = "alert"
+	TypeAlertAck      = "alert_ack"
+	TypeAlertResolved = "alert_resolved"
+)
+
+// Event is a message published by the cron process and delivered to stream clients
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	LocationID int64           `json:"location_id"`
+	Latitude   float64         `json:"latitude"`
+	Longitude  float64         `json:"longitude"`
+	Data       json.RawMessage `json:"data"`
+}
+
+type ReadingData struct {
+	ID                int64    `json:"id"`
+	LocationID        int64    `json:"location_id"`
+	LevelCm           float64  `json:"level_cm"`
+	Danger            string   `json:"danger"`
+	IsFlooded         bool     `json:"is_flooded"`
+	MeasuredAt        string   `json:"measured_at"`
+	SituationColor    *string  `json:"situation_color"`
+	RiseRateCmPerHour *float64 `json:"rise_rate_cm_per_hour"`
+}
+
+type DangerChangeData struct {
+	LocationID int64   `json:"location_id"`
+	Previous   string  `json:"previous"`
+	Current    string  `json:"current"`
+	LevelCm    float64 `json:"level_cm"`
+	MeasuredAt string  `json:"measured_at"`
+}
+
+// Filter selects the events a client is interested in. An empty filter matches everything,
+// while a non-nil but empty LocationIDs matches nothing.
+type Filter struct {
+	LocationIDs map[int64]bool
+	// BBox is min longitude, min latitude, max longitude, max latitude
+	BBox *[4]float64
+}
+
+func (f *Filter) Match(e *Event) bool {
+	if f == nil {
+		return true
+	}
+	if f.LocationIDs != nil && !f.LocationIDs[e.LocationID] {
+		return false
+	}
+	if f.BBox != nil {
+		if e.Longitude < f.BBox[0] || e.Latitude < f.BBox[1] || e.Longitude > f.BBox[2] || e.Latitude > f.BBox[3] {
+			return false
+		}
+	}
+	return true
+}
+
+// After reports whether stream id a is strictly newer than b. Ids are Redis stream ids "<ms>-<seq>".
+func After(a string, b string) bool {
+	if b == "" {
+		return true
+	}
+	aMs, aSeq := splitID(a)
+	bMs, bSeq := splitID(b)
+	if aMs != bMs {
+		return aMs > bMs
+	}
+	return aSeq > bSeq
+}
+
+func splitID(id string) (int64, int64) {
+	ms, seq, _ := strings.Cut(id, "-")
+	msValue, _ := strconv.ParseInt(ms, 10, 64)
+	seqValue, _ := strconv.ParseInt(seq, 10, 64)
+	return msValue, seqValue
+}
@@ -0,0 +1,181 @@
+// Package forecast fits Holt's linear trend model (double exponential smoothing) on a short
+// history of readings and projects it forward with 95% prediction intervals.
+package forecast
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// MinPoints is the fewest resampled points a model is fitted on
+const MinPoints = 6
+
+// z95 is the normal quantile of a two-sided 95% interval
+const z95 = 1.96
+
+var ErrNotEnoughData = errors.New("not enough readings to forecast")
+
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Prediction is the forecast value at Time with its 95% interval
+type Prediction struct {
+	Time  time.Time
+	Value float64
+	Lower float64
+	Upper float64
+}
+
+// Model is a fitted Holt model. Level and Trend are the smoothed state after the last point,
+// Trend is the change per Step and Sigma the standard deviation of the one-step errors.
+type Model struct {
+	Alpha float64
+	Beta  float64
+	Level float64
+	Trend float64
+	Sigma float64
+	Step  time.Duration
+	Last  time.Time
+}
+
+// Resample averages irregular readings into buckets of step. Empty buckets are filled by linear
+// interpolation, so the model sees an evenly spaced series.
+func Resample(points []Point, step time.Duration) []Point {
+	if len(points) == 0 || step <= 0 {
+		return nil
+	}
+
+	sorted := make([]Point, len(points))
+	copy(sorted, points)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	start := sorted[0].Time.Truncate(step)
+	size := int(sorted[len(sorted)-1].Time.Sub(start)/step) + 1
+
+	sums := make([]float64, size)
+	counts := make([]int, size)
+	for _, p := range sorted {
+		i := int(p.Time.Sub(start) / step)
+		sums[i] += p.Value
+		counts[i]++
+	}
+
+	result := make([]Point, size)
+	prev := -1
+	for i := range result {
+		result[i].Time = start.Add(time.Duration(i) * step)
+		if counts[i] == 0 {
+			continue
+		}
+		result[i].Value = sums[i] / float64(counts[i])
+
+		// fill the gap since the previous filled bucket
+		for j := prev + 1; prev >= 0 && j < i; j++ {
+			ratio := float64(j-prev) / float64(i-prev)
+			result[j].Value = result[prev].Value + ratio*(result[i].Value-result[prev].Value)
+		}
+		prev = i
+	}
+
+	return result
+}
+
+// Fit resamples the points and picks the smoothing parameters that minimise the squared one-step errors
+func Fit(points []Point, step time.Duration) (*Model, error) {
+	series := Resample(points, step)
+	if len(series) < MinPoints {
+		return nil, ErrNotEnoughData
+	}
+
+	var best *Model
+	bestSSE := math.Inf(1)
+
+	for a := 1; a <= 9; a++ {
+		for b := 1; b <= 9; b++ {
+			model, sse := fitHolt(series, float64(a)/10, float64(b)/10)
+			if sse < bestSSE {
+				best, bestSSE = model, sse
+			}
+		}
+	}
+
+	// the first two points seed the state, the rest produce errors
+	best.Sigma = math.Sqrt(bestSSE / float64(len(series)-2))
+	best.Step = step
+	best.Last = series[len(series)-1].Time
+
+	return best, nil
+}
+
+func fitHolt(series []Point, alpha float64, beta float64) (*Model, float64) {
+	level := series[0].Value
+	trend := series[1].Value - series[0].Value
+	sse := 0.0
+
+	for i := 1; i < len(series); i++ {
+		if i > 1 {
+			e := series[i].Value - (level + trend)
+			sse += e * e
+		}
+
+		previous := level
+		level = alpha*series[i].Value + (1-alpha)*(level+trend)
+		trend = beta*(level-previous) + (1-beta)*trend
+	}
+
+	return &Model{Alpha: alpha, Beta: beta, Level: level, Trend: trend}, sse
+}
+
+// Predict returns one prediction per step up to horizon
+func (m *Model) Predict(horizon time.Duration) []Prediction {
+	steps := int(horizon / m.Step)
+	result := make([]Prediction, 0, steps)
+
+	variance := 0.0
+	for h := 1; h <= steps; h++ {
+		// h-step variance of Holt's method: sigma² (1 + sum_{j<h} alpha² (1 + j beta)²)
+		if h > 1 {
+			c := m.Alpha * (1 + float64(h-1)*m.Beta)
+			variance += c * c
+		}
+		width := z95 * m.Sigma * math.Sqrt(1+variance)
+		value := m.Level + float64(h)*m.Trend
+
+		result = append(result, Prediction{
+			Time:  m.Last.Add(time.Duration(h) * m.Step),
+			Value: value,
+			Lower: value - width,
+			Upper: value + width,
+		})
+	}
+
+	return result
+}
+
+// TimeToReach returns when value first reaches level, interpolating between predictions. from is
+// the last observed point, the predictions are expected to follow it in time order.
+func TimeToReach(from Point, predictions []Prediction, level float64, value func(Prediction) float64) (time.Time, bool) {
+	if from.Value >= level {
+		return from.Time, true
+	}
+
+	prev := from
+	for _, p := range predictions {
+		current := Point{Time: p.Time, Value: value(p)}
+		if current.Value >= level {
+			ratio := (level - prev.Value) / (current.Value - prev.Value)
+			return prev.Time.Add(time.Duration(ratio * float64(current.Time.Sub(prev.Time)))), true
+		}
+		prev = current
+	}
+
+	return time.Time{}, false
+}
+
+// Central and Upper select which value of a prediction TimeToReach follows
+func Central(p Prediction) float64 { return p.Value }
+func Upper(p Prediction) float64   { return p.Upper }
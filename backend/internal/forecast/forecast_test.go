@@ -0,0 +1,216 @@
+package forecast
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+// linear returns n points every step rising by slope per step from base
+func linear(n int, step time.Duration, base float64, slope float64) []Point {
+	points := make([]Point, n)
+	for i := range points {
+		points[i] = Point{Time: start.Add(time.Duration(i) * step), Value: base + float64(i)*slope}
+	}
+	return points
+}
+
+func almostEqual(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestResample(t *testing.T) {
+	step := 10 * time.Minute
+
+	tests := []struct {
+		name   string
+		points []Point
+		want   []float64
+	}{
+		{
+			name:   "no points",
+			points: nil,
+			want:   nil,
+		},
+		{
+			name: "readings in one bucket are averaged",
+			points: []Point{
+				{Time: start, Value: 10},
+				{Time: start.Add(4 * time.Minute), Value: 20},
+			},
+			want: []float64{15},
+		},
+		{
+			name: "unordered readings",
+			points: []Point{
+				{Time: start.Add(20 * time.Minute), Value: 30},
+				{Time: start, Value: 10},
+				{Time: start.Add(10 * time.Minute), Value: 20},
+			},
+			want: []float64{10, 20, 30},
+		},
+		{
+			name: "gaps are interpolated",
+			points: []Point{
+				{Time: start, Value: 100},
+				{Time: start.Add(40 * time.Minute), Value: 140},
+			},
+			want: []float64{100, 110, 120, 130, 140},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Resample(tt.points, step)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Resample() returned %d points, want %d", len(got), len(tt.want))
+			}
+			for i, p := range got {
+				if !p.Time.Equal(start.Add(time.Duration(i) * step)) {
+					t.Errorf("point %d at %v, want %v", i, p.Time, start.Add(time.Duration(i)*step))
+				}
+				if !almostEqual(p.Value, tt.want[i]) {
+					t.Errorf("point %d = %v, want %v", i, p.Value, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFit(t *testing.T) {
+	step := 10 * time.Minute
+
+	tests := []struct {
+		name      string
+		points    []Point
+		wantErr   error
+		wantLevel float64
+		wantTrend float64
+	}{
+		{
+			name:    "too few points",
+			points:  linear(MinPoints-1, step, 100, 2),
+			wantErr: ErrNotEnoughData,
+		},
+		{
+			name:    "too few buckets after resampling",
+			points:  linear(20, time.Second, 100, 2),
+			wantErr: ErrNotEnoughData,
+		},
+		{
+			name:      "rising line",
+			points:    linear(12, step, 100, 2),
+			wantLevel: 122,
+			wantTrend: 2,
+		},
+		{
+			name:      "falling line",
+			points:    linear(8, step, 300, -5),
+			wantLevel: 265,
+			wantTrend: -5,
+		},
+		{
+			name:      "flat line",
+			points:    linear(MinPoints, step, 80, 0),
+			wantLevel: 80,
+			wantTrend: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := Fit(tt.points, step)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Fit() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fit() error = %v", err)
+			}
+
+			// a straight line is fitted exactly whatever the smoothing parameters
+			if !almostEqual(model.Level, tt.wantLevel) || !almostEqual(model.Trend, tt.wantTrend) {
+				t.Errorf("Fit() level %v trend %v, want %v and %v", model.Level, model.Trend, tt.wantLevel, tt.wantTrend)
+			}
+			if !almostEqual(model.Sigma, 0) {
+				t.Errorf("Fit() sigma = %v, want 0", model.Sigma)
+			}
+			if !model.Last.Equal(tt.points[len(tt.points)-1].Time) {
+				t.Errorf("Fit() last = %v, want %v", model.Last, tt.points[len(tt.points)-1].Time)
+			}
+		})
+	}
+}
+
+func TestPredict(t *testing.T) {
+	model := &Model{Alpha: 0.5, Beta: 0.2, Level: 100, Trend: 3, Sigma: 2, Step: 10 * time.Minute, Last: start}
+
+	predictions := model.Predict(time.Hour)
+	if len(predictions) != 6 {
+		t.Fatalf("Predict() returned %d predictions, want 6", len(predictions))
+	}
+
+	previousWidth := 0.0
+	for i, p := range predictions {
+		h := float64(i + 1)
+		if !p.Time.Equal(start.Add(time.Duration(i+1) * 10 * time.Minute)) {
+			t.Errorf("prediction %d at %v", i, p.Time)
+		}
+		if !almostEqual(p.Value, 100+3*h) {
+			t.Errorf("prediction %d = %v, want %v", i, p.Value, 100+3*h)
+		}
+		if !almostEqual(p.Value-p.Lower, p.Upper-p.Value) {
+			t.Errorf("prediction %d interval is not symmetric: [%v, %v]", i, p.Lower, p.Upper)
+		}
+
+		// the interval widens with the horizon
+		width := p.Upper - p.Lower
+		if width <= previousWidth {
+			t.Errorf("prediction %d width %v, want more than %v", i, width, previousWidth)
+		}
+		previousWidth = width
+	}
+
+	if first := predictions[0]; !almostEqual(first.Upper-first.Value, z95*2) {
+		t.Errorf("one step half width = %v, want %v", first.Upper-first.Value, z95*2)
+	}
+}
+
+func TestTimeToReach(t *testing.T) {
+	from := Point{Time: start, Value: 100}
+	predictions := []Prediction{
+		{Time: start.Add(10 * time.Minute), Value: 110, Upper: 120},
+		{Time: start.Add(20 * time.Minute), Value: 120, Upper: 140},
+	}
+
+	tests := []struct {
+		name   string
+		level  float64
+		value  func(Prediction) float64
+		want   time.Time
+		wantOK bool
+	}{
+		{name: "already reached", level: 90, value: Central, want: start, wantOK: true},
+		{name: "interpolated in the first step", level: 105, value: Central, want: start.Add(5 * time.Minute), wantOK: true},
+		{name: "interpolated in the second step", level: 115, value: Central, want: start.Add(15 * time.Minute), wantOK: true},
+		{name: "upper bound reaches earlier", level: 115, value: Upper, want: start.Add(7*time.Minute + 30*time.Second), wantOK: true},
+		{name: "never reached", level: 130, value: Central, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := TimeToReach(from, predictions, tt.level, tt.value)
+			if ok != tt.wantOK {
+				t.Fatalf("TimeToReach() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && !got.Equal(tt.want) {
+				t.Errorf("TimeToReach() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
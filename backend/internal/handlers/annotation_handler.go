@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/services"
+	"github.com/guatom999/self-boardcast/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type annotationHandler struct {
+	service services.AnnotationServiceInterface
+}
+
+type AnnotationHandlerInterface interface {
+	ListUnlabelled(c echo.Context) error
+	Annotate(c echo.Context) error
+	ExportDataset(c echo.Context) error
+}
+
+func NewAnnotationHandler(service services.AnnotationServiceInterface) AnnotationHandlerInterface {
+	return &annotationHandler{
+		service: service,
+	}
+}
+
+func (h *annotationHandler) ListUnlabelled(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	locationID, err := parseLocationFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	limit := 50
+	if raw := c.QueryParam("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > 500 {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": "limit must be between 1 and 500",
+			})
+		}
+	}
+
+	images, err := h.service.ListUnlabelled(ctx, locationID, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"images": images,
+	})
+}
+
+// Annotate stores the level and waterline of an image, an image annotated again is replaced
+func (h *annotationHandler) Annotate(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	req := new(models.AnnotationReq)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid request body",
+		})
+	}
+	req.Image = c.Param("image")
+	req.UserID, _ = c.Get("user_id").(int64)
+
+	res, err := h.service.Annotate(ctx, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrInvalidInput):
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": err.Error(),
+			})
+		case errors.Is(err, services.ErrImageNotFound):
+			return c.JSON(http.StatusNotFound, map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// ExportDataset streams the annotated images as a zip. The archive is written as it is built, an
+// error half way can only be logged and leaves a truncated archive.
+func (h *annotationHandler) ExportDataset(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	locationID, err := parseLocationFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	fileName := fmt.Sprintf("waterlevel_dataset_%s.zip", time.Now().Format("20060102_150405"))
+	if locationID != 0 {
+		fileName = fmt.Sprintf("waterlevel_dataset_loc%d_%s.zip", locationID, time.Now().Format("20060102_150405"))
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "application/zip")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Response().WriteHeader(http.StatusOK)
+
+	manifest, err := h.service.WriteDataset(ctx, locationID, c.Response())
+	if err != nil {
+		log.Printf("Error failed to export dataset: %v", err)
+		return nil
+	}
+
+	log.Printf("Exported dataset %s: %d images, %d missing", fileName, manifest.Count, len(manifest.Missing))
+	return nil
+}
+
+// parseLocationFilter reads ?location_id=, 0 when it is not set
+func parseLocationFilter(c echo.Context) (int64, error) {
+	raw := c.QueryParam("location_id")
+	if raw == "" {
+		return 0, nil
+	}
+
+	locationID, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || locationID <= 0 {
+		return 0, errors.New("location_id must be a positive id")
+	}
+
+	return locationID, nil
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/services"
+	"github.com/guatom999/self-boardcast/internal/tasks"
+	"github.com/guatom999/self-boardcast/internal/utils"
+	"github.com/hibiken/asynq"
+	"github.com/labstack/echo/v4"
+)
+
+type batchPredictionHandler struct {
+	service  services.BatchPredictionServiceInterface
+	producer *tasks.ImageProducer
+}
+
+type BatchPredictionHandlerInterface interface {
+	PredictBatch(c echo.Context) error
+	DownloadBatchReport(c echo.Context) error
+}
+
+func NewBatchPredictionHandler(service services.BatchPredictionServiceInterface, producer *tasks.ImageProducer) BatchPredictionHandlerInterface {
+	return &batchPredictionHandler{
+		service:  service,
+		producer: producer,
+	}
+}
+
+// PredictBatch queues a batch prediction over a directory of the upload directory and answers 202
+// with the reports the worker will write
+func (h *batchPredictionHandler) PredictBatch(c echo.Context) error {
+
+	req := new(models.BatchPredictionJobReq)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid request body",
+		})
+	}
+
+	res, err := h.service.NewBatchJob(req)
+	if err != nil {
+		if errors.Is(err, utils.ErrInvalidInput) {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.producer.EnqueuePredictBatch(tasks.ImagePredictBatchPayload{
+		Name:          res.Name,
+		Dir:           req.Dir,
+		LocationID:    req.LocationID,
+		MaxGapMinutes: req.MaxGapMinutes,
+		Concurrency:   req.Concurrency,
+	}); err != nil {
+		if errors.Is(err, asynq.ErrTaskIDConflict) {
+			return c.JSON(http.StatusConflict, map[string]any{
+				"error": "a batch prediction was just queued, try again in a second",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusAccepted, res)
+}
+
+// DownloadBatchReport serves a report once the job wrote it, 404 until then
+func (h *batchPredictionHandler) DownloadBatchReport(c echo.Context) error {
+
+	fileName := c.Param("file")
+
+	path, err := h.service.GetBatchReport(fileName)
+	if err != nil {
+		if errors.Is(err, services.ErrBatchReportNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Attachment(path, fileName)
+}
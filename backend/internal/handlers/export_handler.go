@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	customMiddleware "github.com/guatom999/self-boardcast/internal/middleware"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/services"
+	"github.com/guatom999/self-boardcast/internal/tasks"
+	"github.com/guatom999/self-boardcast/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+var exportContentTypes = map[string]string{
+	services.ExportFormatCSV:  "text/csv; charset=utf-8",
+	services.ExportFormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+type exportHandler struct {
+	service  services.ExportServiceInterface
+	producer *tasks.ExportProducer
+}
+
+type ExportHandlerInterface interface {
+	ExportReadings(c echo.Context) error
+	GetExport(c echo.Context) error
+	DownloadExport(c echo.Context) error
+}
+
+func NewExportHandler(service services.ExportServiceInterface, producer *tasks.ExportProducer) ExportHandlerInterface {
+	return &exportHandler{
+		service:  service,
+		producer: producer,
+	}
+}
+
+// ExportReadings streams the readings as a spreadsheet. Exports larger than EXPORT_ASYNC_ROWS are
+// queued for the worker instead and answered with 202 and the export to poll.
+func (h *exportHandler) ExportReadings(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	query, err := parseExportQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": err.Error(),
+		})
+	}
+	query.UserID, _ = c.Get("user_id").(int64)
+
+	large, err := h.service.IsLargeExport(ctx, query)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	if large {
+		export, err := h.service.CreateExport(ctx, query)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]any{
+				"error": err.Error(),
+			})
+		}
+
+		if err := h.producer.EnqueueReadingsExport(tasks.ReadingsExportPayload{ExportID: export.ID}); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]any{
+				"error": "Failed to queue export",
+			})
+		}
+
+		return c.JSON(http.StatusAccepted, export)
+	}
+
+	fileName := fmt.Sprintf("readings_%s_%s.%s", query.From.Format("20060102"), query.To.Format("20060102"), query.Format)
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, exportContentTypes[query.Format])
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", fileName))
+	res.WriteHeader(http.StatusOK)
+
+	// the status is already sent, a failure can only cut the file short
+	if _, err := h.service.WriteReadings(ctx, res, query); err != nil {
+		log.Printf("Error failed to stream readings export %v", err.Error())
+	}
+
+	return nil
+}
+
+func (h *exportHandler) GetExport(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid export id",
+		})
+	}
+
+	userID, _ := c.Get("user_id").(int64)
+
+	export, err := h.service.GetExport(ctx, id, userID, customMiddleware.IsAdmin(c))
+	if err != nil {
+		if errors.Is(err, services.ErrExportNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, export)
+}
+
+func (h *exportHandler) DownloadExport(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid export id",
+		})
+	}
+
+	userID, _ := c.Get("user_id").(int64)
+
+	path, fileName, err := h.service.GetExportFile(ctx, id, userID, customMiddleware.IsAdmin(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrExportNotFound):
+			return c.JSON(http.StatusNotFound, map[string]any{
+				"error": err.Error(),
+			})
+		case errors.Is(err, services.ErrExportNotReady):
+			return c.JSON(http.StatusConflict, map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Attachment(path, fileName)
+}
+
+func parseExportQuery(c echo.Context) (*models.ExportQuery, error) {
+	now := time.Now()
+
+	query := &models.ExportQuery{
+		ProvinceCode: strings.TrimSpace(c.QueryParam("province_code")),
+		From:         now.AddDate(0, 0, -7),
+		To:           now,
+		Format:       strings.ToLower(c.QueryParam("format")),
+	}
+
+	if query.Format == "" {
+		query.Format = services.ExportFormatCSV
+	}
+	if _, ok := exportContentTypes[query.Format]; !ok {
+		return nil, fmt.Errorf("format must be csv or xlsx")
+	}
+
+	if raw := c.QueryParam("location_ids"); raw != "" {
+		for _, part := range strings.Split(raw, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("location_ids must be a comma separated list of integers")
+			}
+			query.LocationIDs = append(query.LocationIDs, id)
+		}
+	}
+
+	if raw := c.QueryParam("from"); raw != "" {
+		from, err := parseExportTime(raw)
+		if err != nil {
+			return nil, fmt.Errorf("from must be an RFC3339 timestamp or YYYY-MM-DD")
+		}
+		query.From = from
+	}
+
+	if raw := c.QueryParam("to"); raw != "" {
+		to, err := parseExportTime(raw)
+		if err != nil {
+			return nil, fmt.Errorf("to must be an RFC3339 timestamp or YYYY-MM-DD")
+		}
+		query.To = to
+	}
+
+	if !query.From.Before(query.To) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+
+	columns, err := services.ParseExportColumns(c.QueryParam("columns"))
+	if err != nil {
+		return nil, err
+	}
+	query.Columns = columns
+
+	return query, nil
+}
+
+// parseExportTime accepts an RFC3339 timestamp or a date, which is midnight in Asia/Bangkok
+func parseExportTime(raw string) (time.Time, error) {
+	if t, err := utils.ParseTime(raw); err == nil {
+		return t, nil
+	}
+
+	loc, err := time.LoadLocation("Asia/Bangkok")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.ParseInLocation("2006-01-02", raw, loc)
+}
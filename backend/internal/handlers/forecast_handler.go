@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/guatom999/self-boardcast/internal/forecast"
+	"github.com/guatom999/self-boardcast/internal/services"
+	"github.com/guatom999/self-boardcast/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type forecastHandler struct {
+	service services.ForecastServiceInterface
+}
+
+type ForecastHandlerInterface interface {
+	GetForecast(c echo.Context) error
+}
+
+func NewForecastHandler(service services.ForecastServiceInterface) ForecastHandlerInterface {
+	return &forecastHandler{
+		service: service,
+	}
+}
+
+// GetForecast returns the predicted levels of a location for the next ?hours=, 6 by default
+func (h *forecastHandler) GetForecast(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	locationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid location id",
+		})
+	}
+
+	hours := services.DefaultForecastHours
+	if raw := c.QueryParam("hours"); raw != "" {
+		hours, err = strconv.Atoi(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": "hours must be an integer",
+			})
+		}
+	}
+
+	res, err := h.service.GetForecast(ctx, locationID, hours)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrInvalidInput):
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": err.Error(),
+			})
+		case errors.Is(err, services.ErrLocationNotFound):
+			return c.JSON(http.StatusNotFound, map[string]any{
+				"error": err.Error(),
+			})
+		case errors.Is(err, forecast.ErrNotEnoughData):
+			return c.JSON(http.StatusUnprocessableEntity, map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
@@ -1,26 +1,42 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/guatom999/self-boardcast/internal/config"
+	customMiddleware "github.com/guatom999/self-boardcast/internal/middleware"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/services"
+	"github.com/guatom999/self-boardcast/internal/tasks"
+	"github.com/guatom999/self-boardcast/internal/thumbnail"
 	"github.com/guatom999/self-boardcast/internal/utils"
 	"github.com/labstack/echo/v4"
 )
 
 type ImageHandler struct {
-	cfg *config.Config
+	cfg      *config.Config
+	service  services.ImageServiceInterface
+	cache    *thumbnail.Cache
+	producer *tasks.ImageProducer
 }
 
-func NewImageHandler(cfg *config.Config) *ImageHandler {
+func NewImageHandler(cfg *config.Config, service services.ImageServiceInterface, producer *tasks.ImageProducer) *ImageHandler {
 	return &ImageHandler{
-		cfg: cfg,
+		cfg:      cfg,
+		service:  service,
+		cache:    thumbnail.NewCache(cfg.App.ImageCacheDir, cfg.App.ImageCacheMaxBytes),
+		producer: producer,
 	}
 }
 
-// ServeImage serves an image file with security validations
+// ServeImage serves an image file with security validations. ?w= and ?format= serve a resized or
+// re-encoded variant instead, see serveVariant.
 func (h *ImageHandler) ServeImage(c echo.Context) error {
 	filename := c.Param("filename")
 
@@ -53,6 +69,10 @@ func (h *ImageHandler) ServeImage(c echo.Context) error {
 		})
 	}
 
+	if c.QueryParam("w") != "" || c.QueryParam("format") != "" {
+		return h.serveVariant(c, filepath)
+	}
+
 	// Set cache headers for better performance
 	c.Response().Header().Set("Cache-Control", "public, max-age=86400") // 24 hours
 
@@ -60,6 +80,177 @@ func (h *ImageHandler) ServeImage(c echo.Context) error {
 	return c.File(filepath)
 }
 
+// serveVariant sends the image scaled down to ?w= and encoded as ?format=, jpeg by default. Variants
+// are built on the first request and cached on disk, a client that has one is answered with 304.
+func (h *ImageHandler) serveVariant(c echo.Context, source string) error {
+	width, err := thumbnail.ParseWidth(c.QueryParam("w"))
+	opts := thumbnail.Options{Width: width, Format: c.QueryParam("format")}
+	if opts.Format == "" {
+		opts.Format = thumbnail.FormatJPEG
+	}
+	if err == nil {
+		err = opts.Validate()
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Image not found",
+		})
+	}
+
+	etag := thumbnail.ETag(info, opts)
+	c.Response().Header().Set("ETag", etag)
+	c.Response().Header().Set("Cache-Control", "public, max-age=86400")
+
+	if etagMatches(c.Request().Header.Get("If-None-Match"), etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	variant, err := h.cache.Get(source, opts)
+	if errors.Is(err, thumbnail.ErrImageTooLarge) {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		log.Printf("failed to build variant of %s: %v", source, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to resize image",
+		})
+	}
+
+	return c.File(variant)
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, weak validators included
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// UploadImage stores the multipart "image" of a location. water_level_id attaches it to that reading,
+// otherwise it becomes a pending reading captured at captured_at (RFC3339, now by default).
+// strip_gps=true clears the GPS position from the EXIF data before the file is stored.
+func (h *ImageHandler) UploadImage(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	locationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid location id",
+		})
+	}
+
+	// leave room for the multipart boundaries and the other fields
+	maxBytes := h.cfg.App.MaxUploadBytes
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxBytes+1<<20)
+
+	fileHeader, err := c.FormFile("image")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{
+				"error": fmt.Sprintf("Image must be at most %d bytes", maxBytes),
+			})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "image file is required",
+		})
+	}
+	if fileHeader.Size > maxBytes {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{
+			"error": fmt.Sprintf("Image must be at most %d bytes", maxBytes),
+		})
+	}
+
+	userID, _ := c.Get("user_id").(int64)
+	req := &models.ImageUploadReq{
+		LocationID: locationID,
+		UserID:     userID,
+		Admin:      customMiddleware.IsAdmin(c),
+	}
+
+	if raw := c.FormValue("water_level_id"); raw != "" {
+		waterLevelID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid water_level_id",
+			})
+		}
+		req.WaterLevelID = &waterLevelID
+	}
+	if raw := c.FormValue("captured_at"); raw != "" {
+		capturedAt, err := utils.ParseTime(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "captured_at must be RFC3339",
+			})
+		}
+		req.CapturedAt = &capturedAt
+	}
+	if raw := c.FormValue("strip_gps"); raw != "" {
+		req.StripGPS, err = strconv.ParseBool(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "strip_gps must be true or false",
+			})
+		}
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Failed to read image",
+		})
+	}
+	defer file.Close()
+
+	res, err := h.service.UploadImage(ctx, req, file)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrFileTooLarge):
+			return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{
+				"error": err.Error(),
+			})
+		case errors.Is(err, utils.ErrInvalidInput):
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		case errors.Is(err, services.ErrLocationNotFound), errors.Is(err, services.ErrReadingNotFound):
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": err.Error(),
+			})
+		case errors.Is(err, services.ErrImageNotOwner):
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	// the upload is stored either way, a failed enqueue leaves the reading pending
+	if res.PendingReadingID != nil {
+		if err := h.producer.EnqueuePredict(tasks.ImagePredictPayload{PendingReadingID: *res.PendingReadingID}); err != nil {
+			log.Printf("Error failed to enqueue prediction of pending reading %d: %v", *res.PendingReadingID, err)
+		}
+	}
+
+	return c.JSON(http.StatusCreated, res)
+}
+
 func (h *ImageHandler) HealthCheck(c echo.Context) error {
 
 	fmt.Println("h.cfg.App.UploadDir", h.cfg.App.UploadDir)
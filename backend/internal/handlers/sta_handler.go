@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/guatom999/self-boardcast/internal/services"
+	"github.com/guatom999/self-boardcast/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type staHandler struct {
+	service services.StaServiceInterface
+}
+
+type StaHandlerInterface interface {
+	GetRoot(c echo.Context) error
+	GetResource(c echo.Context) error
+}
+
+func NewStaHandler(service services.StaServiceInterface) StaHandlerInterface {
+	return &staHandler{
+		service: service,
+	}
+}
+
+func (h *staHandler) GetRoot(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.service.Root())
+}
+
+// GetResource serves every resource path below /sta/v1.1, e.g. /Things(1)/Datastreams?$expand=Observations
+func (h *staHandler) GetResource(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	// clients may escape the parentheses around ids
+	path, err := url.PathUnescape(c.Param("*"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid resource path",
+		})
+	}
+
+	res, err := h.service.Resolve(ctx, path, c.Request().URL.RawQuery)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrInvalidInput):
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": err.Error(),
+			})
+		case errors.Is(err, services.ErrStaNotFound):
+			return c.JSON(http.StatusNotFound, map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
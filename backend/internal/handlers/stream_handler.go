@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/events"
+	"github.com/labstack/echo/v4"
+)
+
+const streamHeartbeatInterval = 15 * time.Second
+
+type StreamHandler struct {
+	broker *events.Broker
+}
+
+func NewStreamHandler(broker *events.Broker) *StreamHandler {
+	return &StreamHandler{
+		broker: broker,
+	}
+}
+
+// StreamReadings pushes reading and danger change events as Server-Sent Events.
+// Clients can narrow the stream with location_ids=1,2 and bbox=minLon,minLat,maxLon,maxLat,
+// and resume with the Last-Event-ID header (or last_event_id query for EventSource polyfills).
+func (h *StreamHandler) StreamReadings(c echo.Context) error {
+	filter, err := ParseEventFilter(c.QueryParam("location_ids"), c.QueryParam("bbox"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	lastEventID := c.Request().Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.QueryParam("last_event_id")
+	}
+
+	// subscribe before replaying so nothing published in between is lost
+	sub := h.broker.Subscribe(filter)
+	defer h.broker.Unsubscribe(sub)
+
+	ctx := c.Request().Context()
+
+	var replay []*events.Event
+	if lastEventID != "" {
+		replay, err = h.broker.Replay(ctx, lastEventID, filter)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	// tell EventSource how long to wait before reconnecting
+	fmt.Fprint(res, "retry: 3000\n\n")
+	res.Flush()
+
+	sent := lastEventID
+	for _, event := range replay {
+		if err := writeSSE(res, event); err != nil {
+			return nil
+		}
+		sent = event.ID
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case event, ok := <-sub.Events:
+			if !ok {
+				// dropped for falling behind, the client reconnects with its Last-Event-ID
+				return nil
+			}
+			if !events.After(event.ID, sent) {
+				continue
+			}
+			if err := writeSSE(res, event); err != nil {
+				return nil
+			}
+			sent = event.ID
+		}
+	}
+}
+
+func writeSSE(res *echo.Response, event *events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(res, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+		return err
+	}
+	res.Flush()
+
+	return nil
+}
+
+// ParseEventFilter builds an event filter from comma separated location ids and a bbox
+func ParseEventFilter(locationIDs string, bbox string) (*events.Filter, error) {
+	filter := &events.Filter{}
+
+	if locationIDs != "" {
+		filter.LocationIDs = make(map[int64]bool)
+		for _, raw := range strings.Split(locationIDs, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("location_ids must be a comma separated list of integers")
+			}
+			filter.LocationIDs[id] = true
+		}
+	}
+
+	if bbox != "" {
+		box, err := ParseBBox(bbox)
+		if err != nil {
+			return nil, err
+		}
+		filter.BBox = box
+	}
+
+	return filter, nil
+}
+
+// ParseBBox parses "minLon,minLat,maxLon,maxLat"
+func ParseBBox(raw string) (*[4]float64, error) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat")
+	}
+
+	var box [4]float64
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat")
+		}
+		box[i] = value
+	}
+
+	if box[0] > box[2] || box[1] > box[3] {
+		return nil, fmt.Errorf("bbox minimum must not exceed maximum")
+	}
+
+	return &box, nil
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/services"
+	"github.com/guatom999/self-boardcast/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type subscriptionHandler struct {
+	service services.SubscriptionServiceInterface
+}
+
+type SubscriptionHandlerInterface interface {
+	ListSubscriptions(c echo.Context) error
+	GetSubscription(c echo.Context) error
+	CreateSubscription(c echo.Context) error
+	UpdateSubscription(c echo.Context) error
+	RotateSecret(c echo.Context) error
+	DeleteSubscription(c echo.Context) error
+}
+
+func NewSubscriptionHandler(service services.SubscriptionServiceInterface) SubscriptionHandlerInterface {
+	return &subscriptionHandler{
+		service: service,
+	}
+}
+
+func (h *subscriptionHandler) ListSubscriptions(c echo.Context) error {
+
+	ctx := context.Background()
+
+	userID, _ := c.Get("user_id").(int64)
+
+	subscriptions, err := h.service.ListSubscriptions(ctx, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, subscriptions)
+}
+
+func (h *subscriptionHandler) GetSubscription(c echo.Context) error {
+
+	ctx := context.Background()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid subscription id",
+		})
+	}
+
+	userID, _ := c.Get("user_id").(int64)
+
+	subscription, err := h.service.GetSubscription(ctx, userID, id)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, subscription)
+}
+
+func (h *subscriptionHandler) CreateSubscription(c echo.Context) error {
+
+	ctx := context.Background()
+
+	req := new(models.SubscriptionReq)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid request body",
+		})
+	}
+
+	userID, _ := c.Get("user_id").(int64)
+
+	subscription, err := h.service.CreateSubscription(ctx, userID, req)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, subscription)
+}
+
+func (h *subscriptionHandler) UpdateSubscription(c echo.Context) error {
+
+	ctx := context.Background()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid subscription id",
+		})
+	}
+
+	req := new(models.SubscriptionReq)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid request body",
+		})
+	}
+
+	userID, _ := c.Get("user_id").(int64)
+
+	subscription, err := h.service.UpdateSubscription(ctx, userID, id, req)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, subscription)
+}
+
+// RotateSecret answers the new signing secret, it is not shown again
+func (h *subscriptionHandler) RotateSecret(c echo.Context) error {
+
+	ctx := context.Background()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid subscription id",
+		})
+	}
+
+	userID, _ := c.Get("user_id").(int64)
+
+	secret, err := h.service.RotateSecret(ctx, userID, id)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"secret": secret,
+	})
+}
+
+func (h *subscriptionHandler) DeleteSubscription(c echo.Context) error {
+
+	ctx := context.Background()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid subscription id",
+		})
+	}
+
+	userID, _ := c.Get("user_id").(int64)
+
+	if err := h.service.DeleteSubscription(ctx, userID, id); err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func subscriptionError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, utils.ErrInvalidInput):
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrSubscriptionNotFound), errors.Is(err, services.ErrLocationNotFound):
+		return c.JSON(http.StatusNotFound, map[string]any{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]any{
+		"error": err.Error(),
+	})
+}
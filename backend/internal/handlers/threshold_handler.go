@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type thresholdHandler struct {
+	service services.ThresholdServiceInterface
+}
+
+type ThresholdHandlerInterface interface {
+	GetThresholds(c echo.Context) error
+	GetThreshold(c echo.Context) error
+	UpdateThreshold(c echo.Context) error
+	GetThresholdHistory(c echo.Context) error
+}
+
+func NewThresholdHandler(service services.ThresholdServiceInterface) ThresholdHandlerInterface {
+	return &thresholdHandler{
+		service: service,
+	}
+}
+
+func (h *thresholdHandler) GetThresholds(c echo.Context) error {
+
+	ctx := context.Background()
+
+	thresholds, err := h.service.GetThresholds(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"thresholds": thresholds,
+	})
+}
+
+func (h *thresholdHandler) GetThreshold(c echo.Context) error {
+
+	ctx := context.Background()
+
+	locationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid location id",
+		})
+	}
+
+	threshold, err := h.service.GetThreshold(ctx, locationID)
+	if err != nil {
+		if errors.Is(err, services.ErrThresholdNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, threshold)
+}
+
+func (h *thresholdHandler) UpdateThreshold(c echo.Context) error {
+
+	ctx := context.Background()
+
+	locationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid location id",
+		})
+	}
+
+	req := new(models.UpdateThresholdReq)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid request body",
+		})
+	}
+
+	userID, _ := c.Get("user_id").(int64)
+
+	threshold, err := h.service.UpdateThreshold(ctx, locationID, userID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidThreshold):
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": err.Error(),
+			})
+		case errors.Is(err, services.ErrLocationNotFound):
+			return c.JSON(http.StatusNotFound, map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, threshold)
+}
+
+func (h *thresholdHandler) GetThresholdHistory(c echo.Context) error {
+
+	ctx := context.Background()
+
+	locationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid location id",
+		})
+	}
+
+	limit := 50
+	if raw := c.QueryParam("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > 500 {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": "limit must be between 1 and 500",
+			})
+		}
+	}
+
+	history, err := h.service.GetThresholdHistory(ctx, locationID, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrLocationNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"history": history,
+	})
+}
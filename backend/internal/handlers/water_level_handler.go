@@ -2,12 +2,20 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/guatom999/self-boardcast/internal/models"
 	"github.com/guatom999/self-boardcast/internal/services"
+	"github.com/guatom999/self-boardcast/internal/utils"
 	"github.com/labstack/echo/v4"
 )
 
+const geoJSONContentType = "application/geo+json"
+
 // WaterLevelHandler handles HTTP requests
 type waterLevelHandler struct {
 	service services.WaterLevelServiceInterface
@@ -15,7 +23,10 @@ type waterLevelHandler struct {
 
 type WaterLevelHandlerInterface interface {
 	GetMapMarkers(c echo.Context) error
+	GetMarkersGeoJSON(c echo.Context) error
 	GetSectionDetail(c echo.Context) error
+	GetReadings(c echo.Context) error
+	GetReadingsAggregate(c echo.Context) error
 }
 
 func NewMapHandler(service services.WaterLevelServiceInterface) WaterLevelHandlerInterface {
@@ -26,6 +37,10 @@ func NewMapHandler(service services.WaterLevelServiceInterface) WaterLevelHandle
 
 func (h *waterLevelHandler) GetMapMarkers(c echo.Context) error {
 
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), geoJSONContentType) {
+		return h.GetMarkersGeoJSON(c)
+	}
+
 	ctx := context.Background()
 
 	markers, err := h.service.GetAllLocations(ctx, 10)
@@ -41,6 +56,50 @@ func (h *waterLevelHandler) GetMapMarkers(c echo.Context) error {
 
 }
 
+// GetMarkersGeoJSON serves the markers as a GeoJSON FeatureCollection for QGIS and Leaflet layers
+func (h *waterLevelHandler) GetMarkersGeoJSON(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	query := &models.MarkerQuery{}
+
+	if raw := c.QueryParam("bbox"); raw != "" {
+		box, err := ParseBBox(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": err.Error(),
+			})
+		}
+		query.BBox = box
+	}
+
+	if raw := c.QueryParam("danger"); raw != "" {
+		query.Danger = make(map[string]bool)
+		for _, level := range strings.Split(raw, ",") {
+			level = strings.ToUpper(strings.TrimSpace(level))
+			switch level {
+			case services.DangerSafe, services.DangerWatch, services.DangerDanger, services.DangerCritical:
+				query.Danger[level] = true
+			default:
+				return c.JSON(http.StatusBadRequest, map[string]any{
+					"error": "danger must be a comma separated list of SAFE, WATCH, DANGER, CRITICAL",
+				})
+			}
+		}
+	}
+
+	collection, err := h.service.GetMarkersGeoJSON(ctx, query)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, geoJSONContentType)
+	return c.JSON(http.StatusOK, collection)
+
+}
+
 func (h *waterLevelHandler) GetSectionDetail(c echo.Context) error {
 
 	ctx := context.Background()
@@ -49,6 +108,16 @@ func (h *waterLevelHandler) GetSectionDetail(c echo.Context) error {
 
 	markers, err := h.service.GetByLocationID(ctx, locationID)
 	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrInvalidInput):
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": "location_id must be an integer",
+			})
+		case errors.Is(err, services.ErrLocationNotFound):
+			return c.JSON(http.StatusNotFound, map[string]any{
+				"error": err.Error(),
+			})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]any{
 			"error": err.Error(),
 		})
@@ -59,3 +128,198 @@ func (h *waterLevelHandler) GetSectionDetail(c echo.Context) error {
 	})
 
 }
+
+// GetReadings pages through the readings of a location ordered by measured_at
+func (h *waterLevelHandler) GetReadings(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	locationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid location id",
+		})
+	}
+
+	query := &models.ReadingQuery{
+		LocationID: locationID,
+		Limit:      100,
+		Descending: true,
+		Cursor:     c.QueryParam("cursor"),
+	}
+
+	if raw := c.QueryParam("from"); raw != "" {
+		from, err := utils.ParseTime(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": "from must be an RFC3339 timestamp",
+			})
+		}
+		query.From = &from
+	}
+
+	if raw := c.QueryParam("to"); raw != "" {
+		to, err := utils.ParseTime(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": "to must be an RFC3339 timestamp",
+			})
+		}
+		query.To = &to
+	}
+
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "from must be before to",
+		})
+	}
+
+	if raw := c.QueryParam("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > 1000 {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": "limit must be between 1 and 1000",
+			})
+		}
+		query.Limit = limit
+	}
+
+	switch strings.ToLower(c.QueryParam("order")) {
+	case "", "desc":
+		query.Descending = true
+	case "asc":
+		query.Descending = false
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "order must be asc or desc",
+		})
+	}
+
+	page, err := h.service.GetReadings(ctx, query)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidCursor):
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": err.Error(),
+			})
+		case errors.Is(err, services.ErrLocationNotFound):
+			return c.JSON(http.StatusNotFound, map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// GetReadingsAggregate returns bucketed min/max/avg/last values, or an LTTB downsampled series when mode=lttb
+func (h *waterLevelHandler) GetReadingsAggregate(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	locationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid location id",
+		})
+	}
+
+	to := time.Now()
+	if raw := c.QueryParam("to"); raw != "" {
+		to, err = utils.ParseTime(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": "to must be an RFC3339 timestamp",
+			})
+		}
+	}
+
+	from := to.AddDate(0, 0, -7)
+	if raw := c.QueryParam("from"); raw != "" {
+		from, err = utils.ParseTime(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": "from must be an RFC3339 timestamp",
+			})
+		}
+	}
+
+	if !from.Before(to) {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "from must be before to",
+		})
+	}
+	if to.Sub(from) > 366*24*time.Hour {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "range must not exceed 366 days",
+		})
+	}
+
+	var result any
+
+	switch c.QueryParam("mode") {
+	case "", "bucket":
+		bucket := c.QueryParam("bucket")
+		if bucket == "" {
+			bucket = "1h"
+		}
+
+		functions := []string{"min", "max", "avg", "last"}
+		if raw := c.QueryParam("fn"); raw != "" {
+			functions = strings.Split(raw, ",")
+			for i := range functions {
+				functions[i] = strings.TrimSpace(functions[i])
+			}
+		}
+
+		result, err = h.service.AggregateReadings(ctx, &models.AggregateQuery{
+			LocationID: locationID,
+			From:       from,
+			To:         to,
+			Bucket:     bucket,
+			Functions:  functions,
+		})
+	case "lttb":
+		points := 200
+		if raw := c.QueryParam("points"); raw != "" {
+			points, err = strconv.Atoi(raw)
+			if err != nil || points < 3 || points > 5000 {
+				return c.JSON(http.StatusBadRequest, map[string]any{
+					"error": "points must be between 3 and 5000",
+				})
+			}
+		}
+
+		result, err = h.service.DownsampleReadings(ctx, &models.DownsampleQuery{
+			LocationID: locationID,
+			From:       from,
+			To:         to,
+			Points:     points,
+		})
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "mode must be bucket or lttb",
+		})
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrInvalidInput):
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": err.Error(),
+			})
+		case errors.Is(err, services.ErrLocationNotFound):
+			return c.JSON(http.StatusNotFound, map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/services"
+	"github.com/guatom999/self-boardcast/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type waterMLHandler struct {
+	service services.WaterMLServiceInterface
+}
+
+type WaterMLHandlerInterface interface {
+	GetWaterML(c echo.Context) error
+}
+
+func NewWaterMLHandler(service services.WaterMLServiceInterface) WaterMLHandlerInterface {
+	return &waterMLHandler{
+		service: service,
+	}
+}
+
+// GetWaterML renders the readings of a location as a WaterML 2.0 MeasurementTimeseries, by default the last 30 days in cm
+func (h *waterMLHandler) GetWaterML(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	locationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid location id",
+		})
+	}
+
+	now := time.Now()
+	query := &models.WaterMLQuery{
+		LocationID: locationID,
+		From:       now.AddDate(0, 0, -30),
+		To:         now,
+		Unit:       services.WaterMLUnitCm,
+	}
+
+	if raw := c.QueryParam("unit"); raw != "" {
+		query.Unit = raw
+	}
+
+	if raw := c.QueryParam("from"); raw != "" {
+		from, err := parseExportTime(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": "from must be an RFC3339 timestamp or YYYY-MM-DD",
+			})
+		}
+		query.From = from
+	}
+
+	if raw := c.QueryParam("to"); raw != "" {
+		to, err := parseExportTime(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": "to must be an RFC3339 timestamp or YYYY-MM-DD",
+			})
+		}
+		query.To = to
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "application/xml; charset=utf-8")
+
+	if err := h.service.WriteWaterML(ctx, c.Response(), query); err != nil {
+		// once the document has started the status is sent and the error can only be logged
+		if c.Response().Committed {
+			log.Printf("Error failed to stream WaterML %v", err.Error())
+			return nil
+		}
+
+		c.Response().Header().Del(echo.HeaderContentType)
+		switch {
+		case errors.Is(err, utils.ErrInvalidInput):
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": err.Error(),
+			})
+		case errors.Is(err, services.ErrLocationNotFound):
+			return c.JSON(http.StatusNotFound, map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return nil
+}
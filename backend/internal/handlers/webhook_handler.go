@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/guatom999/self-boardcast/internal/services"
+	"github.com/guatom999/self-boardcast/internal/tasks"
+	"github.com/labstack/echo/v4"
+)
+
+type webhookHandler struct {
+	service  services.WebhookServiceInterface
+	producer *tasks.NotificationProducer
+}
+
+type WebhookHandlerInterface interface {
+	ListFailedDeliveries(c echo.Context) error
+	ReplayDelivery(c echo.Context) error
+}
+
+func NewWebhookHandler(service services.WebhookServiceInterface, producer *tasks.NotificationProducer) WebhookHandlerInterface {
+	return &webhookHandler{
+		service:  service,
+		producer: producer,
+	}
+}
+
+func (h *webhookHandler) ListFailedDeliveries(c echo.Context) error {
+
+	ctx := context.Background()
+
+	limit := 50
+	if raw := c.QueryParam("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > 500 {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": "limit must be between 1 and 500",
+			})
+		}
+	}
+
+	deliveries, err := h.service.ListFailedDeliveries(ctx, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"deliveries": deliveries,
+	})
+}
+
+// ReplayDelivery queues the notification of a delivery again to the same channel. The replay is a
+// new delivery with its own attempts, it points back to the replayed one.
+func (h *webhookHandler) ReplayDelivery(c echo.Context) error {
+
+	ctx := context.Background()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid delivery id",
+		})
+	}
+
+	delivery, err := h.service.GetDelivery(ctx, id)
+	if err != nil {
+		if errors.Is(err, services.ErrWebhookDeliveryNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	notification := new(tasks.Notification)
+	if err := json.Unmarshal(delivery.Notification, notification); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": "Stored notification is invalid",
+		})
+	}
+
+	if err := h.producer.EnqueueNotificationDelivery(tasks.NotificationDeliveryPayload{
+		Channel:      delivery.Channel,
+		Notification: notification,
+		ReplayOf:     delivery.ID,
+	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": "Failed to queue replay",
+		})
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]any{
+		"replay_of": delivery.ID,
+		"channel":   delivery.Channel,
+	})
+}
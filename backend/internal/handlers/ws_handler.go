@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/events"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/services"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	wsPingInterval = 20 * time.Second
+	// a client that sends nothing, not even a pong, for this long is considered gone
+	wsReadTimeout  = 60 * time.Second
+	wsWriteTimeout = 10 * time.Second
+	// control replies a client may have pending before it is disconnected
+	wsOutboxSize = 16
+)
+
+// wsClientMessage is what dashboards send over /ws
+type wsClientMessage struct {
+	Type        string  `json:"type"`
+	LocationIDs []int64 `json:"location_ids,omitempty"`
+	All         bool    `json:"all,omitempty"`
+	AlertID     int64   `json:"alert_id,omitempty"`
+}
+
+// wsServerMessage is what /ws sends back
+type wsServerMessage struct {
+	Type        string           `json:"type"`
+	Event       *events.Event    `json:"event,omitempty"`
+	LocationIDs []int64          `json:"location_ids,omitempty"`
+	All         bool             `json:"all,omitempty"`
+	Alert       *models.AlertRes `json:"alert,omitempty"`
+	AlertID     int64            `json:"alert_id,omitempty"`
+	Error       string           `json:"error,omitempty"`
+}
+
+type WebSocketHandler struct {
+	authService    services.AuthServiceInterface
+	alertService   services.AlertServiceInterface
+	broker         *events.Broker
+	allowedOrigins []string
+}
+
+func NewWebSocketHandler(authService services.AuthServiceInterface, alertService services.AlertServiceInterface, broker *events.Broker, allowedOrigins []string) *WebSocketHandler {
+	return &WebSocketHandler{
+		authService:    authService,
+		alertService:   alertService,
+		broker:         broker,
+		allowedOrigins: allowedOrigins,
+	}
+}
+
+// checkOrigin is the handshake origin policy. Clients that are not browsers send no Origin and are
+// let in on their token alone, browsers must come from the API host or an allowed origin.
+func (h *WebSocketHandler) checkOrigin(config *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("invalid origin %q", origin)
+	}
+	if strings.EqualFold(parsed.Host, req.Host) {
+		config.Origin = parsed
+		return nil
+	}
+	for _, allowed := range h.allowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			config.Origin = parsed
+			return nil
+		}
+	}
+
+	return fmt.Errorf("origin %q is not allowed", origin)
+}
+
+// Serve upgrades an authenticated request to a WebSocket. Browsers cannot set headers on the
+// upgrade request, so the access token may also be passed as ?token=.
+func (h *WebSocketHandler) Serve(c echo.Context) error {
+	token := ExtractTokenFromHeader(c)
+	if token == "" {
+		token = c.QueryParam("token")
+	}
+	if token == "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Missing access token"})
+	}
+
+	claims, err := h.authService.ValidateAccessToken(token)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or expired token"})
+	}
+
+	server := websocket.Server{
+		Handshake: h.checkOrigin,
+		Handler: func(ws *websocket.Conn) {
+			client := &wsClient{
+				handler: h,
+				ws:      ws,
+				claims:  claims,
+				outbox:  make(chan *wsServerMessage, wsOutboxSize),
+				ids:     make(map[int64]bool),
+			}
+			client.run(c.Request().Context())
+		},
+	}
+	server.ServeHTTP(c.Response(), c.Request())
+
+	return nil
+}
+
+type wsClient struct {
+	handler *WebSocketHandler
+	ws      *websocket.Conn
+	claims  *models.TokenClaims
+	sub     *events.Subscription
+	outbox  chan *wsServerMessage
+
+	mu  sync.Mutex
+	all bool
+	ids map[int64]bool
+}
+
+func (cl *wsClient) run(parent context.Context) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	defer cl.ws.Close()
+
+	// nothing is delivered until the client subscribes
+	cl.sub = cl.handler.broker.Subscribe(&events.Filter{LocationIDs: map[int64]bool{}})
+	defer cl.handler.broker.Unsubscribe(cl.sub)
+
+	go cl.writeLoop(ctx, cancel)
+
+	for {
+		cl.ws.SetReadDeadline(time.Now().Add(wsReadTimeout))
+
+		var msg wsClientMessage
+		if err := websocket.JSON.Receive(cl.ws, &msg); err != nil {
+			return
+		}
+
+		if !cl.handle(ctx, &msg) {
+			return
+		}
+	}
+}
+
+// handle processes one client message, it returns false when the connection should be closed
+func (cl *wsClient) handle(ctx context.Context, msg *wsClientMessage) bool {
+	switch msg.Type {
+	case "subscribe":
+		cl.mu.Lock()
+		if msg.All {
+			cl.all = true
+		}
+		for _, id := range msg.LocationIDs {
+			cl.ids[id] = true
+		}
+		cl.mu.Unlock()
+		cl.applyFilter()
+		return cl.send(cl.subscriptionState("subscribed"))
+	case "unsubscribe":
+		cl.mu.Lock()
+		if msg.All {
+			cl.all = false
+			cl.ids = make(map[int64]bool)
+		}
+		for _, id := range msg.LocationIDs {
+			delete(cl.ids, id)
+		}
+		cl.mu.Unlock()
+		cl.applyFilter()
+		return cl.send(cl.subscriptionState("unsubscribed"))
+	case "ack":
+		if cl.claims.Role != "ADMIN" {
+			return cl.send(&wsServerMessage{Type: "error", AlertID: msg.AlertID, Error: "Admin access required"})
+		}
+		alert, err := cl.handler.alertService.AcknowledgeAlert(ctx, msg.AlertID, cl.claims.UserID)
+		if err != nil {
+			reply := &wsServerMessage{Type: "error", AlertID: msg.AlertID, Error: "Failed to acknowledge alert"}
+			if errors.Is(err, services.ErrAlertNotFound) {
+				reply.Error = err.Error()
+			}
+			return cl.send(reply)
+		}
+		return cl.send(&wsServerMessage{Type: "acked", Alert: alert})
+	case "ping":
+		return cl.send(&wsServerMessage{Type: "pong"})
+	case "pong":
+		return true
+	default:
+		return cl.send(&wsServerMessage{Type: "error", Error: "unknown message type"})
+	}
+}
+
+// send queues a control reply; a client whose outbox is full is too slow and gets disconnected
+func (cl *wsClient) send(msg *wsServerMessage) bool {
+	select {
+	case cl.outbox <- msg:
+		return true
+	default:
+		log.Printf("[WS] Disconnecting user %d: outbox full", cl.claims.UserID)
+		return false
+	}
+}
+
+func (cl *wsClient) writeLoop(ctx context.Context, cancel context.CancelFunc) {
+	defer cancel()
+	// unblock the reader so run returns
+	defer cl.ws.Close()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	var expiry <-chan time.Time
+	if cl.claims.ExpiresAt != nil {
+		timer := time.NewTimer(time.Until(cl.claims.ExpiresAt.Time))
+		defer timer.Stop()
+		expiry = timer.C
+	}
+
+	for {
+		var msg *wsServerMessage
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-expiry:
+			cl.write(&wsServerMessage{Type: "error", Error: "token expired"})
+			return
+		case <-ping.C:
+			msg = &wsServerMessage{Type: "ping"}
+		case event, ok := <-cl.sub.Events:
+			if !ok {
+				// the broker dropped us for falling behind
+				cl.write(&wsServerMessage{Type: "error", Error: "too slow, reconnect"})
+				return
+			}
+			msg = &wsServerMessage{Type: "event", Event: event}
+		case msg = <-cl.outbox:
+		}
+
+		if err := cl.write(msg); err != nil {
+			return
+		}
+	}
+}
+
+func (cl *wsClient) write(msg *wsServerMessage) error {
+	cl.ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return websocket.JSON.Send(cl.ws, msg)
+}
+
+func (cl *wsClient) applyFilter() {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if cl.all {
+		cl.sub.SetFilter(&events.Filter{})
+		return
+	}
+
+	ids := make(map[int64]bool, len(cl.ids))
+	for id := range cl.ids {
+		ids[id] = true
+	}
+	cl.sub.SetFilter(&events.Filter{LocationIDs: ids})
+}
+
+func (cl *wsClient) subscriptionState(messageType string) *wsServerMessage {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	ids := make([]int64, 0, len(cl.ids))
+	for id := range cl.ids {
+		ids = append(ids, id)
+	}
+
+	return &wsServerMessage{Type: messageType, All: cl.all, LocationIDs: ids}
+}
@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/tasks"
+	"github.com/robfig/cron"
+)
+
+// captureWindow dedupes the captures of a location, a cron run repeated within it is dropped
+const captureWindow = time.Minute
+
+// CaptureJob queues a camera capture of every configured location. The worker takes the picture
+// and then queues its prediction.
+type CaptureJob struct {
+	cron     *cron.Cron
+	producer *tasks.ImageProducer
+	cfg      *config.Config
+}
+
+func NewCaptureJob(redisAddr string, cfg *config.Config) *CaptureJob {
+	return &CaptureJob{
+		cron:     cron.New(),
+		producer: tasks.NewImageProducer(redisAddr),
+		cfg:      cfg,
+	}
+}
+
+func (j *CaptureJob) ScheduleCaptures() error {
+	if len(j.cfg.Predictor.CaptureLocationIDs) == 0 {
+		log.Println("[CRON] No capture locations configured, image captures are disabled")
+		return nil
+	}
+
+	if err := j.cron.AddFunc(j.cfg.Predictor.CaptureSpec, j.EnqueueCaptures); err != nil {
+		return err
+	}
+
+	j.cron.Start()
+	return nil
+}
+
+func (j *CaptureJob) Stop() {
+	j.cron.Stop()
+	if err := j.producer.Close(); err != nil {
+		log.Printf("[CRON] Failed to close image producer: %v", err)
+	}
+}
+
+func (j *CaptureJob) EnqueueCaptures() {
+	for _, locationID := range j.cfg.Predictor.CaptureLocationIDs {
+		if err := j.producer.EnqueueCapture(tasks.ImageCapturePayload{LocationID: locationID}, captureWindow); err != nil {
+			log.Printf("[CRON] Failed to enqueue capture of location %d: %v", locationID, err)
+		}
+	}
+}
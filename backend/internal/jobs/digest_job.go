@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/services"
+	"github.com/guatom999/self-boardcast/internal/tasks"
+	"github.com/robfig/cron"
+)
+
+// DigestJob sends the daily and weekly digests. The digests are rendered here and delivered by the
+// notification worker to the subscribers that opted in.
+type DigestJob struct {
+	cron     *cron.Cron
+	service  services.DigestServiceInterface
+	producer *tasks.NotificationProducer
+	cfg      *config.Config
+	loc      *time.Location
+}
+
+func NewDigestJob(redisAddr string, service services.DigestServiceInterface, cfg *config.Config) *DigestJob {
+	loc, err := time.LoadLocation("Asia/Bangkok")
+	if err != nil {
+		loc = time.FixedZone("ICT", 7*60*60)
+	}
+
+	return &DigestJob{
+		cron:     cron.NewWithLocation(loc),
+		service:  service,
+		producer: tasks.NewNotificationProducer(redisAddr),
+		cfg:      cfg,
+		loc:      loc,
+	}
+}
+
+func (j *DigestJob) ScheduleDigests(ctx context.Context) error {
+	if err := j.cron.AddFunc(j.cfg.Digest.DailySpec, func() { j.SendDigests(ctx, services.DigestDaily) }); err != nil {
+		return err
+	}
+	if err := j.cron.AddFunc(j.cfg.Digest.WeeklySpec, func() { j.SendDigests(ctx, services.DigestWeekly) }); err != nil {
+		return err
+	}
+
+	j.cron.Start()
+	return nil
+}
+
+func (j *DigestJob) Stop() {
+	j.cron.Stop()
+	if err := j.producer.Close(); err != nil {
+		log.Printf("[CRON] Failed to close digest producer: %v", err)
+	}
+}
+
+// SendDigests builds the digests of a period ending now and enqueues one delivery per subscription
+func (j *DigestJob) SendDigests(ctx context.Context, period string) {
+	now := time.Now()
+
+	digests, err := j.service.BuildDigests(ctx, period, now)
+	if err != nil {
+		log.Printf("[CRON] Failed to build %s digests: %v", period, err)
+		return
+	}
+
+	date := now.In(j.loc).Format("20060102")
+	sent := 0
+	for _, digest := range digests {
+		data, err := json.Marshal(digest.Digest)
+		if err != nil {
+			log.Printf("[CRON] Failed to encode digest of subscription %d: %v", digest.SubscriptionID, err)
+			continue
+		}
+
+		if err := j.producer.EnqueueDigest(digest.SubscriptionID, &tasks.Notification{
+			Event: tasks.EventDigest,
+			Title: digest.Title,
+			Text:  digest.Text,
+			HTML:  digest.HTML,
+			Data:  data,
+		}, period, date); err != nil {
+			log.Printf("[CRON] Failed to enqueue digest of subscription %d: %v", digest.SubscriptionID, err)
+			continue
+		}
+		sent++
+	}
+
+	log.Printf("[CRON] Enqueued %d of %d %s digests", sent, len(digests), period)
+}
@@ -2,9 +2,13 @@ package jobs
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 
+	"github.com/guatom999/self-boardcast/internal/events"
+	"github.com/guatom999/self-boardcast/internal/forecast"
+	"github.com/guatom999/self-boardcast/internal/models"
 	"github.com/guatom999/self-boardcast/internal/services"
 	"github.com/guatom999/self-boardcast/internal/tasks"
 	"github.com/guatom999/self-boardcast/internal/utils"
@@ -12,21 +16,29 @@ import (
 )
 
 type WaterJob struct {
-	cron     *cron.Cron
-	service  services.WaterLevelServiceInterface
-	producer *tasks.NotificationProducer
+	cron             *cron.Cron
+	service          services.WaterLevelServiceInterface
+	thresholdService services.ThresholdServiceInterface
+	alertService     services.AlertServiceInterface
+	forecastService  services.ForecastServiceInterface
+	producer         *tasks.NotificationProducer
+	publisher        *events.Publisher
 }
 
 type WaterJobInterface interface {
 	ScheduleGetWaterLevel(ctx context.Context)
 }
 
-func NewWaterJob(service services.WaterLevelServiceInterface) *WaterJob {
-	producer := tasks.NewNotificationProducer("localhost:6379")
+func NewWaterJob(redisAddr string, publisher *events.Publisher, service services.WaterLevelServiceInterface, thresholdService services.ThresholdServiceInterface, alertService services.AlertServiceInterface, forecastService services.ForecastServiceInterface) *WaterJob {
+	producer := tasks.NewNotificationProducer(redisAddr)
 	return &WaterJob{
-		cron:     cron.New(),
-		service:  service,
-		producer: producer,
+		cron:             cron.New(),
+		service:          service,
+		thresholdService: thresholdService,
+		alertService:     alertService,
+		forecastService:  forecastService,
+		producer:         producer,
+		publisher:        publisher,
 	}
 }
 
@@ -37,28 +49,80 @@ func (c *WaterJob) ScheduleGetWaterLevel(ctx context.Context) {
 
 	c.cron.AddFunc("0 */10 * * * *", func() {
 		time.Sleep(time.Second * 10)
-		waterLevel, err := c.service.ScheduleGetWaterLevel(ctx)
+		readings, _, err := c.service.ScheduleGetWaterLevel(ctx)
 		if err != nil {
 			log.Println("failed to schedule get water level", err)
 			return
 		}
 
-		fileName = waterLevel.Image
-		locationID = int(waterLevel.LocationID)
+		c.publishReadings(ctx, readings)
 
-		if waterLevel.Danger == "DANGER" || waterLevel.Danger == "WATCH" || waterLevel.Danger == "SAFE" {
+		for _, reading := range readings {
+			// ThaiWater repeats the same waterlevel_datetime across runs, only alert once per reading
+			if reading.Outcome != models.ReadingNew {
+				continue
+			}
+
+			waterLevel := reading.Reading
+			fileName = waterLevel.Image
+			locationID = int(waterLevel.LocationID)
+
+			transition, err := c.alertService.EvaluateReading(ctx, reading)
+			if err != nil {
+				log.Printf("[CRON] Failed to evaluate alert: %v", err)
+			}
 
-			payload := tasks.WaterAlertPayload{
-				LocationID:   int(waterLevel.LocationID),
-				LocationName: waterLevel.Source.String,
-				ShoreLevel:   1.29,
-				WaterLevel:   waterLevel.LevelCm,
-				Description:  waterLevel.Note,
-				MeasuredAt:   utils.ParseTimeToString(waterLevel.MeasuredAt),
+			// only forecast when there is something to send
+			if !reading.RapidRise && transition == nil {
+				continue
 			}
+			outlook := c.forecast(ctx, waterLevel.LocationID)
 
-			if err := c.producer.EnqueueWaterAlert(payload); err != nil {
-				log.Printf("[CRON] Failed to enqueue alert: %v", err)
+			// a fast rise is alerted on its own, flash floods are still SAFE when it starts
+			if reading.RapidRise {
+				payload := tasks.RapidRisePayload{
+					LocationID:         waterLevel.LocationID,
+					LocationName:       reading.Location.Name,
+					RiseRateCmPerHour:  waterLevel.RiseRateCmPerHour.Float64,
+					RiseLimitCmPerHour: reading.RiseLimitCmPerHour,
+					WindowMinutes:      reading.RiseWindowMinutes,
+					WaterLevel:         waterLevel.LevelCm,
+					Danger:             waterLevel.Danger,
+					MeasuredAt:         utils.ParseTimeToString(waterLevel.MeasuredAt),
+					Forecast:           outlook,
+				}
+
+				if err := c.producer.EnqueueRapidRise(payload, time.Duration(reading.RiseWindowMinutes)*time.Minute); err != nil {
+					log.Printf("[CRON] Failed to enqueue rapid rise: %v", err)
+				}
+			}
+
+			// the alert only notifies when it opened, escalated, stepped down, resolved or is due for a reminder
+			if transition != nil {
+				// the transition is already recorded, so the alert goes out even without a shore level
+				shoreLevel, err := c.shoreLevel(ctx, waterLevel.LocationID)
+				if err != nil && !errors.Is(err, services.ErrThresholdNotFound) {
+					log.Printf("[CRON] Failed to get shore level of location %d: %v", waterLevel.LocationID, err)
+				}
+
+				payload := tasks.WaterAlertPayload{
+					LocationID:     int(waterLevel.LocationID),
+					LocationName:   reading.Location.Name,
+					ShoreLevel:     shoreLevel,
+					WaterLevel:     waterLevel.LevelCm,
+					Description:    waterLevel.Note,
+					MeasuredAt:     utils.ParseTimeToString(waterLevel.MeasuredAt),
+					Forecast:       outlook,
+					AlertID:        transition.Alert.ID,
+					AlertState:     transition.Alert.State,
+					AlertEvent:     transition.Event,
+					Danger:         transition.Alert.Danger,
+					PreviousDanger: transition.PreviousDanger,
+				}
+
+				if err := c.producer.EnqueueWaterAlert(payload); err != nil {
+					log.Printf("[CRON] Failed to enqueue alert: %v", err)
+				}
 			}
 		}
 	})
@@ -74,3 +138,79 @@ func (c *WaterJob) ScheduleGetWaterLevel(ctx context.Context) {
 
 	c.cron.Start()
 }
+
+// publishReadings pushes new and changed readings, and danger level changes, to the API stream clients
+func (c *WaterJob) publishReadings(ctx context.Context, readings []*models.IngestedReading) {
+	for _, reading := range readings {
+		if reading.Outcome == models.ReadingUnchanged {
+			continue
+		}
+
+		waterLevel := reading.Reading
+		location := reading.Location
+
+		if err := c.publisher.Publish(ctx, events.TypeReading, location.ID, location.Latitude, location.Longitude, events.ReadingData{
+			ID:                waterLevel.ID,
+			LocationID:        waterLevel.LocationID,
+			LevelCm:           waterLevel.LevelCm,
+			Danger:            waterLevel.Danger,
+			IsFlooded:         waterLevel.IsFlooded,
+			MeasuredAt:        utils.FormatTime(waterLevel.MeasuredAt),
+			SituationColor:    utils.NullStringToPtr(waterLevel.SituationColor),
+			RiseRateCmPerHour: utils.NullFloat64ToPtr(waterLevel.RiseRateCmPerHour),
+		}); err != nil {
+			log.Printf("[CRON] Failed to publish reading event: %v", err)
+		}
+
+		if reading.PreviousDanger != "" && reading.PreviousDanger != waterLevel.Danger {
+			if err := c.publisher.Publish(ctx, events.TypeDangerChange, location.ID, location.Latitude, location.Longitude, events.DangerChangeData{
+				LocationID: waterLevel.LocationID,
+				Previous:   reading.PreviousDanger,
+				Current:    waterLevel.Danger,
+				LevelCm:    waterLevel.LevelCm,
+				MeasuredAt: utils.FormatTime(waterLevel.MeasuredAt),
+			}); err != nil {
+				log.Printf("[CRON] Failed to publish danger change event: %v", err)
+			}
+		}
+	}
+}
+
+// shoreLevel returns the danger threshold of a location in meters, the unit alert receivers expect.
+// It is nil when the location has no danger threshold rather than report a shore level of 0.
+func (c *WaterJob) shoreLevel(ctx context.Context, locationID int64) (*float64, error) {
+	threshold, err := c.thresholdService.GetThreshold(ctx, locationID)
+	if err != nil {
+		return nil, err
+	}
+	if threshold.DangerLevelCm == nil {
+		return nil, services.ErrThresholdNotFound
+	}
+	shoreLevel := *threshold.DangerLevelCm / 100
+	return &shoreLevel, nil
+}
+
+// forecast summarises where the level of a location is heading, nil when it cannot be forecast
+func (c *WaterJob) forecast(ctx context.Context, locationID int64) *tasks.ForecastPayload {
+	res, err := c.forecastService.GetForecast(ctx, locationID, services.DefaultForecastHours)
+	if err != nil {
+		if !errors.Is(err, forecast.ErrNotEnoughData) {
+			log.Printf("[CRON] Failed to forecast location %d: %v", locationID, err)
+		}
+		return nil
+	}
+	if len(res.Points) == 0 {
+		return nil
+	}
+
+	horizon := res.Points[len(res.Points)-1]
+	return &tasks.ForecastPayload{
+		HorizonHours:     services.DefaultForecastHours,
+		LevelCm:          horizon.LevelCm,
+		LowerCm:          horizon.LowerCm,
+		UpperCm:          horizon.UpperCm,
+		BankLevelCm:      res.BankLevelCm,
+		BankLevelAt:      res.BankLevelAt,
+		HoursToBankLevel: res.HoursToBankLevel,
+	}
+}
@@ -45,11 +45,16 @@ func JWTMiddleware(authService services.AuthServiceInterface) echo.MiddlewareFun
 func AdminOnlyMiddleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			role, ok := c.Get("user_role").(string)
-			if !ok || role != "ADMIN" {
+			if !IsAdmin(c) {
 				return c.JSON(http.StatusForbidden, map[string]string{"error": "Admin access required"})
 			}
 			return next(c)
 		}
 	}
 }
+
+// IsAdmin reports whether the user authenticated by JWTMiddleware is an admin
+func IsAdmin(c echo.Context) bool {
+	role, ok := c.Get("user_role").(string)
+	return ok && role == "ADMIN"
+}
@@ -0,0 +1,24 @@
+package models
+
+type AlertRes struct {
+	ID             int64   `json:"id"`
+	LocationID     int64   `json:"location_id"`
+	WaterLevelID   *int64  `json:"water_level_id"`
+	Danger         string  `json:"danger"`
+	LevelCm        float64 `json:"level_cm"`
+	MeasuredAt     string  `json:"measured_at"`
+	State          string  `json:"state"`
+	AcknowledgedBy *int64  `json:"acknowledged_by"`
+	AcknowledgedAt *string `json:"acknowledged_at"`
+	LastNotifiedAt *string `json:"last_notified_at"`
+	ResolvedAt     *string `json:"resolved_at"`
+	CreatedAt      string  `json:"created_at"`
+	UpdatedAt      string  `json:"updated_at"`
+}
+
+// AlertTransition is what a reading did to the alert of its location, subscribers are notified of every transition
+type AlertTransition struct {
+	Alert          *AlertRes `json:"alert"`
+	Event          string    `json:"event"`
+	PreviousDanger string    `json:"previous_danger,omitempty"`
+}
@@ -0,0 +1,57 @@
+package models
+
+// WaterlinePoint is a point of the waterline in image pixels, the origin is the top left corner
+type WaterlinePoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type AnnotationReq struct {
+	Image     string           `json:"-"`
+	LevelCm   *float64         `json:"level_cm"`
+	Waterline []WaterlinePoint `json:"waterline"`
+	Note      *string          `json:"note"`
+	UserID    int64            `json:"-"`
+}
+
+type AnnotationImageRes struct {
+	Image      string `json:"image"`
+	URL        string `json:"url"`
+	LocationID int64  `json:"location_id"`
+	CapturedAt string `json:"captured_at"`
+}
+
+type AnnotationRes struct {
+	ID          int64            `json:"id"`
+	Image       string           `json:"image"`
+	URL         string           `json:"url"`
+	LocationID  int64            `json:"location_id"`
+	CapturedAt  string           `json:"captured_at"`
+	LevelCm     float64          `json:"level_cm"`
+	Waterline   []WaterlinePoint `json:"waterline"`
+	ImageWidth  int              `json:"image_width"`
+	ImageHeight int              `json:"image_height"`
+	Note        *string          `json:"note"`
+	AnnotatedBy *int64           `json:"annotated_by"`
+	UpdatedAt   string           `json:"updated_at"`
+}
+
+// DatasetManifest is manifest.json of a dataset export, labels.csv holds the same images
+type DatasetManifest struct {
+	Version    int             `json:"version"`
+	CreatedAt  string          `json:"created_at"`
+	LocationID *int64          `json:"location_id,omitempty"`
+	Count      int             `json:"count"`
+	Missing    []string        `json:"missing"` // annotated images no longer in the upload directory
+	Images     []*DatasetImage `json:"images"`
+}
+
+type DatasetImage struct {
+	File        string           `json:"file"` // path in the archive, images/<image>
+	LocationID  int64            `json:"location_id"`
+	CapturedAt  string           `json:"captured_at"`
+	LevelCm     float64          `json:"level_cm"`
+	ImageWidth  int              `json:"image_width"`
+	ImageHeight int              `json:"image_height"`
+	Waterline   []WaterlinePoint `json:"waterline"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// BatchPredictionReq runs the predictor over the snapshots under Dir. LocationID is used for
+// snapshots whose name carries no location.
+type BatchPredictionReq struct {
+	Dir         string
+	LocationID  int64
+	TimeZone    *time.Location
+	MaxGap      time.Duration
+	Concurrency int
+}
+
+// BatchPredictionRow compares the prediction of one snapshot with the nearest telemetered reading
+type BatchPredictionRow struct {
+	File          string
+	LocationID    int64
+	CapturedAt    time.Time
+	PredictedCm   *float64
+	TelemeteredCm *float64
+	TelemeteredAt *time.Time
+	Error         string
+}
+
+type BatchPredictionLocationStats struct {
+	LocationID int64   `json:"location_id"`
+	Images     int     `json:"images"`
+	Compared   int     `json:"compared"`
+	MAE        float64 `json:"mae_cm"`
+	RMSE       float64 `json:"rmse_cm"`
+}
+
+type BatchPredictionReport struct {
+	Images    int                             `json:"images"`
+	Skipped   int                             `json:"skipped"`
+	Failed    int                             `json:"failed"`
+	Compared  int                             `json:"compared"`
+	Locations []*BatchPredictionLocationStats `json:"locations"`
+}
+
+type BatchPredictionJobReq struct {
+	Dir           string `json:"dir"`
+	LocationID    int64  `json:"location_id"`
+	MaxGapMinutes int    `json:"max_gap_minutes"`
+	Concurrency   int    `json:"concurrency"`
+}
+
+type BatchPredictionJobRes struct {
+	Name        string `json:"name"`
+	Report      string `json:"report"`
+	Summary     string `json:"summary"`
+	ReportURL   string `json:"report_url"`
+	SummaryURL  string `json:"summary_url"`
+	RequestedAt string `json:"requested_at"`
+}
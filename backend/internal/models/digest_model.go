@@ -0,0 +1,37 @@
+package models
+
+// DigestRes summarises the locations a subscription follows over a period
+type DigestRes struct {
+	Period    string               `json:"period"`
+	From      string               `json:"from"`
+	To        string               `json:"to"`
+	Locations []*DigestLocationRes `json:"locations"`
+}
+
+type DigestLocationRes struct {
+	LocationID     int64             `json:"location_id"`
+	Name           string            `json:"name"`
+	Readings       int               `json:"readings"`
+	MinCm          *float64          `json:"min_cm"`
+	MaxCm          *float64          `json:"max_cm"`
+	CurrentCm      *float64          `json:"current_cm"`
+	CurrentDanger  *string           `json:"current_danger"`
+	LastMeasuredAt *string           `json:"last_measured_at"`
+	Stale          bool              `json:"stale"`
+	DangerHours    []*DangerHoursRes `json:"danger_hours"`
+}
+
+// DangerHoursRes is the time a location spent at one danger level
+type DangerHoursRes struct {
+	Danger string  `json:"danger"`
+	Hours  float64 `json:"hours"`
+}
+
+// DigestMessage is the digest of one subscription rendered for delivery
+type DigestMessage struct {
+	SubscriptionID int64
+	Title          string
+	Text           string
+	HTML           string
+	Digest         *DigestRes
+}
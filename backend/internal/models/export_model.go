@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type ExportQuery struct {
+	LocationIDs  []int64
+	ProvinceCode string
+	From         time.Time
+	To           time.Time
+	Format       string
+	Columns      []string
+	UserID       int64
+}
+
+type ExportRes struct {
+	ID           int64    `json:"id"`
+	Status       string   `json:"status"`
+	Format       string   `json:"format"`
+	LocationIDs  []int64  `json:"location_ids,omitempty"`
+	ProvinceCode *string  `json:"province_code,omitempty"`
+	From         string   `json:"from"`
+	To           string   `json:"to"`
+	Columns      []string `json:"columns"`
+	RowCount     *int64   `json:"row_count,omitempty"`
+	DownloadURL  string   `json:"download_url,omitempty"`
+	Error        *string  `json:"error,omitempty"`
+	CreatedAt    string   `json:"created_at"`
+	FinishedAt   string   `json:"finished_at,omitempty"`
+}
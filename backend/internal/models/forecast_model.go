@@ -0,0 +1,23 @@
+package models
+
+type ForecastRes struct {
+	LocationID     int64    `json:"location_id"`
+	Method         string   `json:"method"`
+	StepMinutes    int      `json:"step_minutes"`
+	GeneratedAt    string   `json:"generated_at"`
+	LastMeasuredAt string   `json:"last_measured_at"`
+	LastLevelCm    float64  `json:"last_level_cm"`
+	BankLevelCm    *float64 `json:"bank_level_cm"`
+	// BankLevelAt follows the central forecast, EarliestBankLevelAt the upper bound of the interval
+	BankLevelAt         *string             `json:"bank_level_at"`
+	HoursToBankLevel    *float64            `json:"hours_to_bank_level"`
+	EarliestBankLevelAt *string             `json:"earliest_bank_level_at"`
+	Points              []*ForecastPointRes `json:"points"`
+}
+
+type ForecastPointRes struct {
+	Time    string  `json:"time"`
+	LevelCm float64 `json:"level_cm"`
+	LowerCm float64 `json:"lower_cm"`
+	UpperCm float64 `json:"upper_cm"`
+}
@@ -0,0 +1,41 @@
+package models
+
+// MarkerQuery filters the map markers, a nil BBox or empty Danger matches everything
+type MarkerQuery struct {
+	// BBox is min longitude, min latitude, max longitude, max latitude
+	BBox   *[4]float64
+	Danger map[string]bool
+}
+
+// FeatureCollection is a GeoJSON (RFC 7946) feature collection
+type FeatureCollection struct {
+	Type     string     `json:"type"`
+	Features []*Feature `json:"features"`
+}
+
+type Feature struct {
+	Type       string            `json:"type"`
+	ID         int64             `json:"id"`
+	Geometry   *PointGeometry    `json:"geometry"`
+	Properties *MarkerProperties `json:"properties"`
+}
+
+// PointGeometry coordinates are longitude, latitude
+type PointGeometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type MarkerProperties struct {
+	LocationID     int64    `json:"location_id"`
+	Name           string   `json:"name"`
+	Description    string   `json:"description,omitempty"`
+	LevelCm        *float64 `json:"level_cm"`
+	Danger         *string  `json:"danger"`
+	BankLevel      *float64 `json:"bank_level,omitempty"`
+	IsFlooded      *bool    `json:"is_flooded"`
+	ImageURL       *string  `json:"image_url"`
+	MeasuredAt     string   `json:"measured_at,omitempty"`
+	SituationColor *string  `json:"situation_color,omitempty"`
+	SituationText  *string  `json:"situation_text,omitempty"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// ImageUploadReq describes an uploaded image. Without WaterLevelID the image becomes a pending
+// reading captured at CapturedAt, the upload time when not given. Only admins may replace an
+// image another user attached to the reading.
+type ImageUploadReq struct {
+	LocationID   int64
+	WaterLevelID *int64
+	CapturedAt   *time.Time
+	StripGPS     bool
+	UserID       int64
+	Admin        bool
+}
+
+type ImageUploadRes struct {
+	FileName         string `json:"filename"`
+	URL              string `json:"url"`
+	ContentType      string `json:"content_type"`
+	Size             int64  `json:"size"`
+	GPSStripped      bool   `json:"gps_stripped"`
+	WaterLevelID     *int64 `json:"water_level_id,omitempty"`
+	PendingReadingID *int64 `json:"pending_reading_id,omitempty"`
+	CapturedAt       string `json:"captured_at"`
+}
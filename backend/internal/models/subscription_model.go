@@ -0,0 +1,37 @@
+package models
+
+// SubscriptionReq creates or replaces a subscription. Either LocationID or Latitude, Longitude and
+// RadiusKm are set. QuietStart and QuietEnd are "HH:MM" in Asia/Bangkok time. Digest is "daily" or
+// "weekly" to also receive a digest of the followed locations.
+type SubscriptionReq struct {
+	LocationID *int64   `json:"location_id"`
+	Latitude   *float64 `json:"latitude"`
+	Longitude  *float64 `json:"longitude"`
+	RadiusKm   *float64 `json:"radius_km"`
+	MinDanger  string   `json:"min_danger"`
+	Channel    string   `json:"channel"`
+	Target     string   `json:"target"`
+	QuietStart *string  `json:"quiet_start"`
+	QuietEnd   *string  `json:"quiet_end"`
+	Digest     *string  `json:"digest"`
+	IsActive   *bool    `json:"is_active"`
+}
+
+// SubscriptionRes holds Secret only when it was just generated, it is not shown again
+type SubscriptionRes struct {
+	ID         int64    `json:"id"`
+	LocationID *int64   `json:"location_id"`
+	Latitude   *float64 `json:"latitude"`
+	Longitude  *float64 `json:"longitude"`
+	RadiusKm   *float64 `json:"radius_km"`
+	MinDanger  string   `json:"min_danger"`
+	Channel    string   `json:"channel"`
+	Target     string   `json:"target"`
+	QuietStart *string  `json:"quiet_start"`
+	QuietEnd   *string  `json:"quiet_end"`
+	Digest     *string  `json:"digest"`
+	Secret     *string  `json:"secret,omitempty"`
+	IsActive   bool     `json:"is_active"`
+	CreatedAt  string   `json:"created_at"`
+	UpdatedAt  string   `json:"updated_at"`
+}
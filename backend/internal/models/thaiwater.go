@@ -127,3 +127,22 @@ type NotTodayInfo struct {
 	ColorName string `json:"colorname"`
 	Text      string `json:"text"`
 }
+
+// ThaiWaterGraphResponse represents the historical waterlevel graph endpoint response
+type ThaiWaterGraphResponse struct {
+	Result string             `json:"result"`
+	Data   ThaiWaterGraphData `json:"data"`
+}
+
+// ThaiWaterGraphData holds the time series of a single tele-station
+type ThaiWaterGraphData struct {
+	GraphData   []ThaiWaterGraphPoint `json:"graph_data"`
+	MinBank     *float64              `json:"min_bank"`
+	GroundLevel *float64              `json:"ground_level"`
+}
+
+// ThaiWaterGraphPoint represents one historical reading in meters MSL
+type ThaiWaterGraphPoint struct {
+	Datetime string   `json:"datetime"`
+	Value    *float64 `json:"value"`
+}
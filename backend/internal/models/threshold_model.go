@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+type UpdateThresholdReq struct {
+	WarningLevelCm         *float64 `json:"warning_level_cm"`
+	DangerLevelCm          *float64 `json:"danger_level_cm"`
+	CriticalLevelCm        *float64 `json:"critical_level_cm"`
+	RiseRateLimitCmPerHour *float64 `json:"rise_rate_limit_cm_per_hour"`
+	Note                   string   `json:"note"`
+}
+
+type ThresholdRes struct {
+	LocationID             int64    `json:"location_id"`
+	WarningLevelCm         *float64 `json:"warning_level_cm"`
+	DangerLevelCm          *float64 `json:"danger_level_cm"`
+	CriticalLevelCm        *float64 `json:"critical_level_cm"`
+	RiseRateLimitCmPerHour *float64 `json:"rise_rate_limit_cm_per_hour"`
+	UpdatedBy              *int64   `json:"updated_by"`
+	UpdatedAt              string   `json:"updated_at"`
+}
+
+type ThresholdHistoryRes struct {
+	ID                        int64     `json:"id"`
+	LocationID                int64     `json:"location_id"`
+	OldWarningLevelCm         *float64  `json:"old_warning_level_cm"`
+	OldDangerLevelCm          *float64  `json:"old_danger_level_cm"`
+	OldCriticalLevelCm        *float64  `json:"old_critical_level_cm"`
+	NewWarningLevelCm         *float64  `json:"new_warning_level_cm"`
+	NewDangerLevelCm          *float64  `json:"new_danger_level_cm"`
+	NewCriticalLevelCm        *float64  `json:"new_critical_level_cm"`
+	OldRiseRateLimitCmPerHour *float64  `json:"old_rise_rate_limit_cm_per_hour"`
+	NewRiseRateLimitCmPerHour *float64  `json:"new_rise_rate_limit_cm_per_hour"`
+	ChangedBy                 *int64    `json:"changed_by"`
+	Note                      string    `json:"note"`
+	ChangedAt                 time.Time `json:"changed_at"`
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"database/sql"
 	"time"
+
+	"github.com/guatom999/self-boardcast/internal/entities"
 )
 
 type Location struct {
@@ -71,13 +73,13 @@ type PredictWater struct {
 }
 
 type LocationWithWaterLevel struct {
-	LocationID          int64   `db:"location_id"`
-	LocationName        string  `db:"location_name"`
-	LocationDescription string  `db:"location_description"`
-	Latitude            float64 `db:"latitude"`
-	Longitude           float64 `db:"longitude"`
-	IsActive            bool    `db:"is_active"`
-	BankLevel           float64 `db:"bank_level"`
+	LocationID          int64    `db:"location_id"`
+	LocationName        string   `db:"location_name"`
+	LocationDescription *string  `db:"location_description"`
+	Latitude            float64  `db:"latitude"`
+	Longitude           float64  `db:"longitude"`
+	IsActive            bool     `db:"is_active"`
+	BankLevel           *float64 `db:"bank_level"`
 
 	WaterLevelID *int64     `db:"water_level_id"`
 	LevelCm      *float64   `db:"level_cm"`
@@ -86,16 +88,19 @@ type LocationWithWaterLevel struct {
 	IsFlooded    *bool      `db:"is_flooded"`
 	MeasuredAt   *time.Time `db:"measured_at"`
 	Note         *string    `db:"note"`
+
+	SituationColor *string `db:"situation_color"`
+	SituationText  *string `db:"situation_text"`
 }
 
 type LocationWithWaterLevelRes struct {
-	LocationID          int64   `json:"location_id"`
-	LocationName        string  `json:"location_name"`
-	LocationDescription string  `json:"location_description"`
-	Latitude            float64 `json:"latitude"`
-	Longitude           float64 `json:"longitude"`
-	IsActive            bool    `json:"is_active"`
-	BankLevel           float64 `json:"bank_level"`
+	LocationID          int64    `json:"location_id"`
+	LocationName        string   `json:"location_name"`
+	LocationDescription string   `json:"location_description"`
+	Latitude            float64  `json:"latitude"`
+	Longitude           float64  `json:"longitude"`
+	IsActive            bool     `json:"is_active"`
+	BankLevel           *float64 `json:"bank_level"`
 
 	WaterLevelID *int64   `json:"water_level_id"`
 	LevelCm      *float64 `json:"level_cm"`
@@ -104,6 +109,9 @@ type LocationWithWaterLevelRes struct {
 	IsFlooded    *bool    `json:"is_flooded"`
 	MeasuredAt   string   `json:"measured_at"`
 	Note         *string  `json:"note"`
+
+	SituationColor *string `json:"situation_color"`
+	SituationText  *string `json:"situation_text"`
 }
 
 type WaterLocationDetailRes struct {
@@ -115,4 +123,139 @@ type WaterLocationDetailRes struct {
 	Source     sql.NullString `json:"source"`
 	MeasuredAt time.Time      `json:"measured_at"`
 	Note       string         `json:"note"`
+
+	SituationColor string `json:"situation_color,omitempty"`
+	SituationText  string `json:"situation_text,omitempty"`
+}
+
+// ReadingOutcome tells what an upsert did with a reading
+type ReadingOutcome string
+
+const (
+	ReadingNew       ReadingOutcome = "NEW"
+	ReadingUpdated   ReadingOutcome = "UPDATED"
+	ReadingUnchanged ReadingOutcome = "UNCHANGED"
+)
+
+// IngestedReading is a reading written by an ingestion run together with its upsert outcome.
+// PreviousDanger is the danger level of the latest reading stored before this run, empty when there was none.
+// RapidRise is set when the reading rose faster than RiseLimitCmPerHour over the last RiseWindowMinutes.
+type IngestedReading struct {
+	Reading            *entities.WaterLevel
+	Location           *entities.Location
+	Outcome            ReadingOutcome
+	PreviousDanger     string
+	RiseWindowMinutes  int
+	RiseLimitCmPerHour float64
+	RapidRise          bool
+}
+
+// IngestSummary reports the outcome of one ThaiWater ingestion run
+type IngestSummary struct {
+	Provinces int `json:"provinces"`
+	Stations  int `json:"stations"`
+	New       int `json:"new"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Missing   int `json:"missing"`
+	Failed    int `json:"failed"`
+}
+
+// BackfillReq describes one historical import window for a single location
+type BackfillReq struct {
+	LocationID int64
+	From       time.Time
+	To         time.Time
+	Resolution time.Duration
+	DryRun     bool
+}
+
+// BackfillSummary reports the outcome of a backfill window
+type BackfillSummary struct {
+	Fetched   int `json:"fetched"`
+	New       int `json:"new"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Skipped   int `json:"skipped"`
+}
+
+// ReadingQuery filters and pages the readings of one location
+type ReadingQuery struct {
+	LocationID int64
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Descending bool
+	Cursor     string
+}
+
+type ReadingRes struct {
+	ID                int64    `json:"id"`
+	LocationID        int64    `json:"location_id"`
+	LevelCm           float64  `json:"level_cm"`
+	Image             *string  `json:"image"`
+	Danger            string   `json:"danger"`
+	IsFlooded         bool     `json:"is_flooded"`
+	Source            *string  `json:"source"`
+	MeasuredAt        string   `json:"measured_at"`
+	Note              string   `json:"note"`
+	SituationColor    *string  `json:"situation_color"`
+	SituationText     *string  `json:"situation_text"`
+	RiseRateCmPerHour *float64 `json:"rise_rate_cm_per_hour"`
+}
+
+type ReadingsPageRes struct {
+	LocationID int64         `json:"location_id"`
+	Order      string        `json:"order"`
+	Limit      int           `json:"limit"`
+	Readings   []*ReadingRes `json:"readings"`
+	NextCursor *string       `json:"next_cursor"`
+}
+
+// AggregateQuery asks for readings of one location grouped into fixed buckets
+type AggregateQuery struct {
+	LocationID int64
+	From       time.Time
+	To         time.Time
+	Bucket     string
+	Functions  []string
+}
+
+type AggregateBucketRes struct {
+	Bucket string   `json:"bucket"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+	Avg    *float64 `json:"avg,omitempty"`
+	Last   *float64 `json:"last,omitempty"`
+	Count  int      `json:"count"`
+}
+
+type AggregateRes struct {
+	LocationID int64                 `json:"location_id"`
+	Bucket     string                `json:"bucket"`
+	From       string                `json:"from"`
+	To         string                `json:"to"`
+	Functions  []string              `json:"fn"`
+	Buckets    []*AggregateBucketRes `json:"buckets"`
+}
+
+// DownsampleQuery asks for at most Points samples of a location series
+type DownsampleQuery struct {
+	LocationID int64
+	From       time.Time
+	To         time.Time
+	Points     int
+}
+
+type SeriesPointRes struct {
+	MeasuredAt string  `json:"measured_at"`
+	LevelCm    float64 `json:"level_cm"`
+}
+
+type DownsampleRes struct {
+	LocationID  int64             `json:"location_id"`
+	From        string            `json:"from"`
+	To          string            `json:"to"`
+	SourceCount int               `json:"source_count"`
+	Points      []*SeriesPointRes `json:"points"`
 }
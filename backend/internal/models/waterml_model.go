@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// WaterMLQuery selects the series of one location, by id or by ThaiWater tele-station id
+type WaterMLQuery struct {
+	LocationID int64
+	StationID  int64
+	From       time.Time
+	To         time.Time
+	Unit       string // "cm" or "m", both above mean sea level
+}
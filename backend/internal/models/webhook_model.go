@@ -0,0 +1,19 @@
+package models
+
+import "encoding/json"
+
+type WebhookDeliveryRes struct {
+	ID           int64           `json:"id"`
+	DeliveryID   string          `json:"delivery_id"`
+	Channel      string          `json:"channel"`
+	Event        string          `json:"event"`
+	URL          string          `json:"url"`
+	Notification json.RawMessage `json:"notification"`
+	Attempt      int             `json:"attempt"`
+	StatusCode   *int            `json:"status_code"`
+	LatencyMs    int             `json:"latency_ms"`
+	Error        *string         `json:"error"`
+	Succeeded    bool            `json:"succeeded"`
+	ReplayOf     *int64          `json:"replay_of"`
+	CreatedAt    string          `json:"created_at"`
+}
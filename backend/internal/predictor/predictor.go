@@ -0,0 +1,162 @@
+// Package predictor captures camera snapshots and reads the water level from them. The level is
+// read by the Python model by default, a local HTTP inference server or a stub can replace it.
+package predictor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/guatom999/self-boardcast/internal/config"
+)
+
+// Backends, the values of PREDICTOR
+const (
+	BackendPython = "python"
+	BackendHTTP   = "http"
+	BackendStub   = "stub"
+)
+
+// Predictor reads the water level, in cm, shown in an image
+type Predictor interface {
+	Predict(ctx context.Context, imagePath string) (float64, error)
+}
+
+// Capturer takes a snapshot from the camera and writes it to imagePath
+type Capturer interface {
+	Capture(ctx context.Context, imagePath string) error
+}
+
+// New returns the predictor selected in the configuration
+func New(cfg *config.Config) (Predictor, error) {
+	switch cfg.Predictor.Backend {
+	case BackendPython:
+		return &PythonPredictor{Dir: cfg.App.ImageProcessingDir}, nil
+	case BackendHTTP:
+		if cfg.Predictor.URL == "" {
+			return nil, fmt.Errorf("PREDICTOR_URL is required by the http predictor")
+		}
+		return &HTTPPredictor{URL: cfg.Predictor.URL}, nil
+	case BackendStub:
+		return &StubPredictor{LevelCm: cfg.Predictor.StubLevelCm}, nil
+	}
+
+	return nil, fmt.Errorf("unknown predictor %q", cfg.Predictor.Backend)
+}
+
+// PythonCapturer runs create_waterlevel_file.py of the image processing directory. The script is
+// given the file name of imagePath and is expected to write the snapshot to the upload directory.
+type PythonCapturer struct {
+	Dir string
+}
+
+func (c *PythonCapturer) Capture(ctx context.Context, imagePath string) error {
+	if _, err := runScript(ctx, c.Dir, "create_waterlevel_file.py", filepath.Base(imagePath)); err != nil {
+		return fmt.Errorf("failed to capture image: %w", err)
+	}
+	return nil
+}
+
+// PythonPredictor runs predict.py of the image processing directory. The script is given the
+// absolute path of the image, which may be anywhere, and prints the level.
+type PythonPredictor struct {
+	Dir string
+}
+
+func (p *PythonPredictor) Predict(ctx context.Context, imagePath string) (float64, error) {
+	absPath, err := filepath.Abs(imagePath)
+	if err != nil {
+		return 0, err
+	}
+
+	output, err := runScript(ctx, p.Dir, "predict.py", absPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to predict water level: %w", err)
+	}
+
+	result, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse result: %v, output: %s", err, string(output))
+	}
+
+	return result, nil
+}
+
+func runScript(ctx context.Context, dir string, script string, arg string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "python", filepath.Join(dir, script), arg)
+	cmd.Dir = dir
+
+	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("%s: %w", script, ctx.Err())
+	}
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("%s: %v, output: %s", script, err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("%s: %w", script, err)
+	}
+
+	return output, nil
+}
+
+// HTTPPredictor posts the image to an inference server, which answers {"water_level": <cm>}
+type HTTPPredictor struct {
+	URL string
+}
+
+func (p *HTTPPredictor) Predict(ctx context.Context, imagePath string) (float64, error) {
+	image, err := os.ReadFile(imagePath)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(image))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", http.DetectContentType(image))
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to call predictor: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return 0, fmt.Errorf("predictor answered %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		WaterLevel *float64 `json:"water_level"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to decode predictor response: %w", err)
+	}
+	if result.WaterLevel == nil {
+		return 0, fmt.Errorf("predictor response has no water_level")
+	}
+
+	return *result.WaterLevel, nil
+}
+
+// StubPredictor always reads LevelCm, for development without the model
+type StubPredictor struct {
+	LevelCm float64
+}
+
+func (p *StubPredictor) Predict(ctx context.Context, imagePath string) (float64, error) {
+	if _, err := os.Stat(imagePath); err != nil {
+		return 0, err
+	}
+	return p.LevelCm, nil
+}
@@ -0,0 +1,230 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/jmoiron/sqlx"
+)
+
+type alertRepository struct {
+	db *sqlx.DB
+}
+
+type AlertRepositoryInterface interface {
+	GetActiveAlert(ctx context.Context, locationID int64) (*entities.Alert, error)
+	CreateAlert(ctx context.Context, alert *entities.Alert, event *entities.AlertEvent) error
+	UpdateAlert(ctx context.Context, alert *entities.Alert, event *entities.AlertEvent) error
+	GetAlertByID(ctx context.Context, id int64) (*entities.Alert, error)
+	AcknowledgeAlert(ctx context.Context, id int64, userID int64) (*entities.Alert, error)
+}
+
+func NewAlertRepository(db *sqlx.DB) AlertRepositoryInterface {
+	return &alertRepository{
+		db: db,
+	}
+}
+
+// GetActiveAlert returns the OPEN or ACKNOWLEDGED alert of a location, nil when there is none
+func (r *alertRepository) GetActiveAlert(ctx context.Context, locationID int64) (*entities.Alert, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `SELECT * FROM alerts WHERE location_id = $1 AND state <> 'RESOLVED'`
+
+	result := &entities.Alert{}
+	if err := r.db.GetContext(ctx, result, query, locationID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error failed to select from alerts database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CreateAlert opens an alert and records its first event
+func (r *alertRepository) CreateAlert(ctx context.Context, alert *entities.Alert, event *entities.AlertEvent) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("Error failed to begin transaction %v", err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO alerts (location_id, water_level_id, danger, level_cm, measured_at, state, last_notified_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at
+	`
+
+	if err := tx.QueryRowContext(ctx, query,
+		alert.LocationID, alert.WaterLevelID, alert.Danger, alert.LevelCm, alert.MeasuredAt, alert.State, alert.LastNotifiedAt,
+	).Scan(&alert.ID, &alert.CreatedAt, &alert.UpdatedAt); err != nil {
+		log.Printf("Error failed to insert into alerts database %v", err.Error())
+		return err
+	}
+
+	event.AlertID = alert.ID
+	if err := insertAlertEvent(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error failed to commit transaction %v", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// UpdateAlert stores the new state of an alert together with the event that caused it
+func (r *alertRepository) UpdateAlert(ctx context.Context, alert *entities.Alert, event *entities.AlertEvent) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("Error failed to begin transaction %v", err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE alerts
+		SET water_level_id = $2,
+			danger = $3,
+			level_cm = $4,
+			measured_at = $5,
+			state = $6,
+			last_notified_at = $7,
+			resolved_at = $8,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`
+
+	if err := tx.QueryRowContext(ctx, query,
+		alert.ID, alert.WaterLevelID, alert.Danger, alert.LevelCm, alert.MeasuredAt, alert.State, alert.LastNotifiedAt, alert.ResolvedAt,
+	).Scan(&alert.UpdatedAt); err != nil {
+		log.Printf("Error failed to update alerts database %v", err.Error())
+		return err
+	}
+
+	if err := insertAlertEvent(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error failed to commit transaction %v", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func insertAlertEvent(ctx context.Context, tx *sqlx.Tx, event *entities.AlertEvent) error {
+	query := `
+		INSERT INTO alert_events (alert_id, location_id, type, from_danger, to_danger, level_cm, measured_at, user_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+
+	if err := tx.QueryRowContext(ctx, query,
+		event.AlertID, event.LocationID, event.Type, event.FromDanger, event.ToDanger, event.LevelCm, event.MeasuredAt, event.UserID,
+	).Scan(&event.ID, &event.CreatedAt); err != nil {
+		log.Printf("Error failed to insert into alert_events database %v", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (r *alertRepository) GetAlertByID(ctx context.Context, id int64) (*entities.Alert, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `SELECT * FROM alerts WHERE id = $1`
+
+	result := &entities.Alert{}
+	if err := r.db.GetContext(ctx, result, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error failed to select from alerts database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// AcknowledgeAlert moves an OPEN alert to ACKNOWLEDGED and records who did it. Acknowledging twice
+// keeps the first acknowledgement and a resolved alert stays resolved.
+func (r *alertRepository) AcknowledgeAlert(ctx context.Context, id int64, userID int64) (*entities.Alert, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("Error failed to begin transaction %v", err.Error())
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	previous := &entities.Alert{}
+	if err := tx.GetContext(ctx, previous, `SELECT * FROM alerts WHERE id = $1 FOR UPDATE`, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error failed to select from alerts database %v", err.Error())
+		return nil, err
+	}
+
+	query := `
+		UPDATE alerts
+		SET acknowledged_by = COALESCE(acknowledged_by, $2),
+			acknowledged_at = COALESCE(acknowledged_at, NOW()),
+			state = CASE WHEN state = 'OPEN' THEN 'ACKNOWLEDGED' ELSE state END,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING *
+	`
+
+	result := &entities.Alert{}
+	if err := tx.GetContext(ctx, result, query, id, userID); err != nil {
+		log.Printf("Error failed to update alerts database %v", err.Error())
+		return nil, err
+	}
+
+	if previous.State == "OPEN" {
+		if err := insertAlertEvent(ctx, tx, &entities.AlertEvent{
+			AlertID:    result.ID,
+			LocationID: result.LocationID,
+			Type:       "ACKNOWLEDGED",
+			FromDanger: sql.NullString{String: result.Danger, Valid: true},
+			ToDanger:   sql.NullString{String: result.Danger, Valid: true},
+			UserID:     sql.NullInt64{Int64: userID, Valid: true},
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error failed to commit transaction %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
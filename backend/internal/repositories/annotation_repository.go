@@ -0,0 +1,142 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/jmoiron/sqlx"
+)
+
+// annotationImages are the images that can be annotated, the images of pending readings and of
+// active readings, each once with its earliest capture time
+const annotationImages = `
+	SELECT DISTINCT ON (image) image, location_id, captured_at
+	FROM (
+		SELECT image, location_id, captured_at FROM pending_readings
+		UNION ALL
+		SELECT image, location_id, measured_at FROM water_levels
+		WHERE image IS NOT NULL AND image <> '' AND status = 'ACTIVE'
+	) images
+	ORDER BY image, captured_at
+`
+
+type annotationRepository struct {
+	db *sqlx.DB
+}
+
+type AnnotationRepositoryInterface interface {
+	ListUnlabelledImages(ctx context.Context, locationID int64, limit int) ([]*entities.AnnotationImage, error)
+	GetAnnotationImage(ctx context.Context, image string) (*entities.AnnotationImage, error)
+	UpsertAnnotation(ctx context.Context, annotation *entities.ImageAnnotation) error
+	ListAnnotations(ctx context.Context, locationID int64) ([]*entities.ImageAnnotation, error)
+}
+
+func NewAnnotationRepository(db *sqlx.DB) AnnotationRepositoryInterface {
+	return &annotationRepository{
+		db: db,
+	}
+}
+
+// ListUnlabelledImages returns the newest images without an annotation, of every location when locationID is 0
+func (r *annotationRepository) ListUnlabelledImages(ctx context.Context, locationID int64, limit int) ([]*entities.AnnotationImage, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	query := `
+		SELECT i.image, i.location_id, i.captured_at
+		FROM (` + annotationImages + `) i
+		LEFT JOIN image_annotations a ON a.image = i.image
+		WHERE a.id IS NULL
+			AND ($1::BIGINT = 0 OR i.location_id = $1)
+		ORDER BY i.captured_at DESC, i.image
+		LIMIT $2
+	`
+
+	result := make([]*entities.AnnotationImage, 0)
+	if err := r.db.SelectContext(ctx, &result, query, locationID, limit); err != nil {
+		log.Printf("Error failed to select from image_annotations database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *annotationRepository) GetAnnotationImage(ctx context.Context, image string) (*entities.AnnotationImage, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `
+		SELECT i.image, i.location_id, i.captured_at
+		FROM (` + annotationImages + `) i
+		WHERE i.image = $1
+	`
+
+	result := new(entities.AnnotationImage)
+	if err := r.db.GetContext(ctx, result, query, image); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error failed to select from pending_readings database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// UpsertAnnotation stores the annotation of an image, replacing the one it already has
+func (r *annotationRepository) UpsertAnnotation(ctx context.Context, annotation *entities.ImageAnnotation) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `
+		INSERT INTO image_annotations (image, location_id, captured_at, level_cm, waterline, image_width, image_height, note, annotated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (image) DO UPDATE SET
+			level_cm = EXCLUDED.level_cm,
+			waterline = EXCLUDED.waterline,
+			image_width = EXCLUDED.image_width,
+			image_height = EXCLUDED.image_height,
+			note = EXCLUDED.note,
+			annotated_by = EXCLUDED.annotated_by,
+			updated_at = NOW()
+		RETURNING *
+	`
+
+	if err := r.db.GetContext(ctx, annotation, query,
+		annotation.Image, annotation.LocationID, annotation.CapturedAt, annotation.LevelCm, annotation.Waterline,
+		annotation.ImageWidth, annotation.ImageHeight, annotation.Note, annotation.AnnotatedBy,
+	); err != nil {
+		log.Printf("Error failed to insert into image_annotations database %v", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ListAnnotations returns the annotations in capture order, of every location when locationID is 0
+func (r *annotationRepository) ListAnnotations(ctx context.Context, locationID int64) ([]*entities.ImageAnnotation, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	query := `
+		SELECT *
+		FROM image_annotations
+		WHERE $1::BIGINT = 0 OR location_id = $1
+		ORDER BY captured_at, id
+	`
+
+	result := make([]*entities.ImageAnnotation, 0)
+	if err := r.db.SelectContext(ctx, &result, query, locationID); err != nil {
+		log.Printf("Error failed to select from image_annotations database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,217 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ExportFilter selects the readings of an export, empty LocationIDs and ProvinceCode match every location
+type ExportFilter struct {
+	LocationIDs   []int64
+	ProvinceCode  string
+	From          time.Time
+	To            time.Time
+	ExcludeSource string // readings from this source are left out, none when empty
+}
+
+type exportRepository struct {
+	db *sqlx.DB
+}
+
+type ExportRepositoryInterface interface {
+	CountReadings(ctx context.Context, filter *ExportFilter) (int64, error)
+	StreamReadings(ctx context.Context, filter *ExportFilter, fn func(row *entities.ExportRow) error) error
+	CreateExport(ctx context.Context, export *entities.ReadingsExport) error
+	GetExport(ctx context.Context, id int64) (*entities.ReadingsExport, error)
+	MarkExportRunning(ctx context.Context, id int64) error
+	FinishExport(ctx context.Context, id int64, fileName string, rowCount int64) error
+	FailExport(ctx context.Context, id int64, message string) error
+}
+
+func NewExportRepository(db *sqlx.DB) ExportRepositoryInterface {
+	return &exportRepository{
+		db: db,
+	}
+}
+
+const exportReadingsWhere = `
+	FROM water_levels wl
+	JOIN locations l ON l.id = wl.location_id
+	WHERE wl.measured_at >= $1
+		AND wl.measured_at < $2
+		AND ($3::BIGINT[] IS NULL OR wl.location_id = ANY($3))
+		AND ($4 = '' OR l.province_code = $4)
+		AND ($5 = '' OR wl.source IS DISTINCT FROM $5)
+`
+
+func (r *exportRepository) CountReadings(ctx context.Context, filter *ExportFilter) (int64, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	query := `SELECT COUNT(*) ` + exportReadingsWhere
+
+	var count int64
+	if err := r.db.GetContext(ctx, &count, query,
+		filter.From, filter.To, pq.Array(filter.LocationIDs), filter.ProvinceCode, filter.ExcludeSource,
+	); err != nil {
+		log.Printf("Error failed to count water_levels database %v", err.Error())
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// StreamReadings calls fn for every matching reading while scanning the rows, so an export never holds them all in memory.
+// Readings taken at the same time come with the ones from a source first.
+func (r *exportRepository) StreamReadings(ctx context.Context, filter *ExportFilter, fn func(row *entities.ExportRow) error) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*30)
+	defer cancel()
+
+	query := `
+		SELECT
+			wl.id AS reading_id,
+			l.id AS location_id,
+			l.name AS location_name,
+			l.province_code,
+			l.latitude,
+			l.longitude,
+			l.bank_level,
+			wl.measured_at,
+			wl.level_cm,
+			wl.danger,
+			wl.is_flooded,
+			wl.source,
+			wl.note,
+			wl.situation_text
+	` + exportReadingsWhere + `
+		ORDER BY wl.location_id, wl.measured_at, wl.source IS NULL, wl.id
+	`
+
+	rows, err := r.db.QueryxContext(ctx, query,
+		filter.From, filter.To, pq.Array(filter.LocationIDs), filter.ProvinceCode, filter.ExcludeSource,
+	)
+	if err != nil {
+		log.Printf("Error failed to select from water_levels database %v", err.Error())
+		return err
+	}
+	defer rows.Close()
+
+	row := &entities.ExportRow{}
+	for rows.Next() {
+		if err := rows.StructScan(row); err != nil {
+			log.Printf("Error failed to scan water_levels database %v", err.Error())
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error failed to read water_levels database %v", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (r *exportRepository) CreateExport(ctx context.Context, export *entities.ReadingsExport) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `
+		INSERT INTO readings_exports (format, location_ids, province_code, from_time, to_time, columns, requested_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, status, created_at
+	`
+
+	if err := r.db.QueryRowContext(ctx, query,
+		export.Format, export.LocationIDs, export.ProvinceCode, export.FromTime, export.ToTime, export.Columns, export.RequestedBy,
+	).Scan(&export.ID, &export.Status, &export.CreatedAt); err != nil {
+		log.Printf("Error failed to insert into readings_exports database %v", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (r *exportRepository) GetExport(ctx context.Context, id int64) (*entities.ReadingsExport, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `SELECT * FROM readings_exports WHERE id = $1`
+
+	result := &entities.ReadingsExport{}
+	if err := r.db.GetContext(ctx, result, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error failed to select from readings_exports database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *exportRepository) MarkExportRunning(ctx context.Context, id int64) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `UPDATE readings_exports SET status = 'RUNNING', error = NULL WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		log.Printf("Error failed to update readings_exports database %v", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (r *exportRepository) FinishExport(ctx context.Context, id int64, fileName string, rowCount int64) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `
+		UPDATE readings_exports
+		SET status = 'DONE', file_name = $2, row_count = $3, finished_at = NOW()
+		WHERE id = $1
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, id, fileName, rowCount); err != nil {
+		log.Printf("Error failed to update readings_exports database %v", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (r *exportRepository) FailExport(ctx context.Context, id int64, message string) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `
+		UPDATE readings_exports
+		SET status = 'FAILED', error = $2, finished_at = NOW()
+		WHERE id = $1
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, id, message); err != nil {
+		log.Printf("Error failed to update readings_exports database %v", err.Error())
+		return err
+	}
+
+	return nil
+}
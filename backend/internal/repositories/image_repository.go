@@ -0,0 +1,172 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/jmoiron/sqlx"
+)
+
+type imageRepository struct {
+	db *sqlx.DB
+}
+
+type ImageRepositoryInterface interface {
+	CreatePendingReading(ctx context.Context, reading *entities.PendingReading) error
+	AttachImage(ctx context.Context, locationID int64, waterLevelID int64, image string, uploadedBy int64, replaceAny bool) (*entities.AttachedImage, error)
+	GetPendingReading(ctx context.Context, id int64) (*entities.PendingReading, error)
+	CompletePendingReading(ctx context.Context, pending *entities.PendingReading, reading *entities.WaterLevel) error
+	FailPendingReading(ctx context.Context, id int64, reason string) error
+}
+
+func NewImageRepository(db *sqlx.DB) ImageRepositoryInterface {
+	return &imageRepository{
+		db: db,
+	}
+}
+
+func (r *imageRepository) CreatePendingReading(ctx context.Context, reading *entities.PendingReading) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `
+		INSERT INTO pending_readings (location_id, image, captured_at, uploaded_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING *
+	`
+
+	if err := r.db.GetContext(ctx, reading, query, reading.LocationID, reading.Image, reading.CapturedAt, reading.UploadedBy); err != nil {
+		log.Printf("Error failed to insert into pending_readings database %v", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// AttachImage sets the image of a reading of the location and returns the image it replaced. An
+// existing image is only replaced when replaceAny is set or uploadedBy uploaded it. It returns nil
+// when the location has no such reading.
+func (r *imageRepository) AttachImage(ctx context.Context, locationID int64, waterLevelID int64, image string, uploadedBy int64, replaceAny bool) (*entities.AttachedImage, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `
+		WITH previous AS (
+			SELECT id, image, image_uploaded_by FROM water_levels WHERE id = $1 AND location_id = $2 FOR UPDATE
+		), updated AS (
+			UPDATE water_levels w
+			SET image = $3, image_uploaded_by = NULLIF($4::BIGINT, 0)
+			FROM previous
+			WHERE w.id = previous.id
+				AND ($5 OR COALESCE(previous.image, '') = '' OR previous.image_uploaded_by = $4)
+			RETURNING w.id
+		)
+		SELECT previous.image AS previous, EXISTS (SELECT 1 FROM updated) AS attached
+		FROM previous
+	`
+
+	result := new(entities.AttachedImage)
+	if err := r.db.GetContext(ctx, result, query, waterLevelID, locationID, image, uploadedBy, replaceAny); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error failed to update water_levels database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *imageRepository) GetPendingReading(ctx context.Context, id int64) (*entities.PendingReading, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `SELECT * FROM pending_readings WHERE id = $1`
+
+	result := &entities.PendingReading{}
+	if err := r.db.GetContext(ctx, result, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error failed to select from pending_readings database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CompletePendingReading stores the reading read from a pending image and marks the pending reading
+// as processed. A reading already stored for the same capture is refreshed, so a retried task does
+// not fail on the unique reading constraint.
+func (r *imageRepository) CompletePendingReading(ctx context.Context, pending *entities.PendingReading, reading *entities.WaterLevel) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("Error failed to begin transaction %v", err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO water_levels(location_id, level_cm, image, danger, is_flooded, source, measured_at, note, status, image_uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 'ACTIVE', $9)
+		ON CONFLICT ON CONSTRAINT uq_water_levels_location_measured_source DO UPDATE SET
+			level_cm = EXCLUDED.level_cm,
+			image = EXCLUDED.image,
+			image_uploaded_by = EXCLUDED.image_uploaded_by,
+			danger = EXCLUDED.danger,
+			is_flooded = EXCLUDED.is_flooded,
+			note = EXCLUDED.note
+		RETURNING id
+	`
+
+	if err := tx.QueryRowContext(ctx, query,
+		reading.LocationID, reading.LevelCm, reading.Image, reading.Danger, reading.IsFlooded, reading.Source, reading.MeasuredAt, reading.Note, reading.ImageUploadedBy,
+	).Scan(&reading.ID); err != nil {
+		log.Printf("Error failed to upsert into water_levels database %v", err.Error())
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE pending_readings
+		SET status = 'PROCESSED', water_level_id = $2, error = NULL, updated_at = NOW()
+		WHERE id = $1
+	`, pending.ID, reading.ID); err != nil {
+		log.Printf("Error failed to update pending_readings database %v", err.Error())
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error failed to commit transaction %v", err.Error())
+		return err
+	}
+
+	pending.Status = "PROCESSED"
+	pending.WaterLevelID = sql.NullInt64{Int64: reading.ID, Valid: true}
+
+	return nil
+}
+
+func (r *imageRepository) FailPendingReading(ctx context.Context, id int64, reason string) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `UPDATE pending_readings SET status = 'FAILED', error = $2, updated_at = NOW() WHERE id = $1 AND status = 'PENDING'`
+
+	if _, err := r.db.ExecContext(ctx, query, id, reason); err != nil {
+		log.Printf("Error failed to update pending_readings database %v", err.Error())
+		return err
+	}
+
+	return nil
+}
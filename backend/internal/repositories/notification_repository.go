@@ -0,0 +1,107 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/jmoiron/sqlx"
+)
+
+type notificationRepository struct {
+	db *sqlx.DB
+}
+
+type NotificationRepositoryInterface interface {
+	GetActiveChannels(ctx context.Context) ([]*entities.NotificationChannel, error)
+	CreateWebhookDelivery(ctx context.Context, delivery *entities.WebhookDelivery) error
+	GetWebhookDelivery(ctx context.Context, id int64) (*entities.WebhookDelivery, error)
+	ListFailedWebhookDeliveries(ctx context.Context, limit int) ([]*entities.WebhookDelivery, error)
+}
+
+func NewNotificationRepository(db *sqlx.DB) NotificationRepositoryInterface {
+	return &notificationRepository{
+		db: db,
+	}
+}
+
+func (r *notificationRepository) GetActiveChannels(ctx context.Context) ([]*entities.NotificationChannel, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `SELECT * FROM notification_channels WHERE is_active ORDER BY id`
+
+	result := make([]*entities.NotificationChannel, 0)
+	if err := r.db.SelectContext(ctx, &result, query); err != nil {
+		log.Printf("Error failed to select from notification_channels database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *notificationRepository) CreateWebhookDelivery(ctx context.Context, delivery *entities.WebhookDelivery) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `
+		INSERT INTO webhook_deliveries (delivery_id, channel, event, url, notification, attempt, status_code, latency_ms, error, succeeded, final, replay_of)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, created_at
+	`
+
+	if err := r.db.QueryRowContext(ctx, query,
+		delivery.DeliveryID, delivery.Channel, delivery.Event, delivery.URL, delivery.Notification, delivery.Attempt,
+		delivery.StatusCode, delivery.LatencyMs, delivery.Error, delivery.Succeeded, delivery.Final, delivery.ReplayOf,
+	).Scan(&delivery.ID, &delivery.CreatedAt); err != nil {
+		log.Printf("Error failed to insert into webhook_deliveries database %v", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (r *notificationRepository) GetWebhookDelivery(ctx context.Context, id int64) (*entities.WebhookDelivery, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `SELECT * FROM webhook_deliveries WHERE id = $1`
+
+	result := &entities.WebhookDelivery{}
+	if err := r.db.GetContext(ctx, result, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error failed to select from webhook_deliveries database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ListFailedWebhookDeliveries returns the last attempt of deliveries that gave up, newest first
+func (r *notificationRepository) ListFailedWebhookDeliveries(ctx context.Context, limit int) ([]*entities.WebhookDelivery, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	query := `
+		SELECT * FROM webhook_deliveries
+		WHERE final AND NOT succeeded
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1
+	`
+
+	result := make([]*entities.WebhookDelivery, 0)
+	if err := r.db.SelectContext(ctx, &result, query, limit); err != nil {
+		log.Printf("Error failed to select from webhook_deliveries database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,170 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/jmoiron/sqlx"
+)
+
+// StaQuery is a compiled SensorThings request. Where holds conditions whose placeholders index into Args.
+type StaQuery struct {
+	Where   []string
+	Args    []any
+	OrderBy string
+	Limit   int
+	Offset  int
+}
+
+type staRepository struct {
+	db *sqlx.DB
+}
+
+type StaRepositoryInterface interface {
+	ListLocations(ctx context.Context, q *StaQuery) ([]*entities.Location, error)
+	ListDatastreams(ctx context.Context, q *StaQuery) ([]*entities.DatastreamRow, error)
+	ListObservations(ctx context.Context, q *StaQuery) ([]*entities.WaterLevel, error)
+	CountLocations(ctx context.Context, q *StaQuery) (int64, error)
+	CountObservations(ctx context.Context, q *StaQuery) (int64, error)
+}
+
+func NewStaRepository(db *sqlx.DB) StaRepositoryInterface {
+	return &staRepository{
+		db: db,
+	}
+}
+
+// build appends the conditions, order and page of q to a base query
+func (q *StaQuery) build(base string, paged bool) (string, []any) {
+	args := append([]any{}, q.Args...)
+
+	var b strings.Builder
+	b.WriteString(base)
+
+	for _, condition := range q.Where {
+		b.WriteString(" AND ")
+		b.WriteString(condition)
+	}
+
+	if !paged {
+		return b.String(), args
+	}
+
+	if q.OrderBy != "" {
+		b.WriteString(" ORDER BY ")
+		b.WriteString(q.OrderBy)
+	}
+
+	args = append(args, q.Limit, q.Offset)
+	fmt.Fprintf(&b, " LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	return b.String(), args
+}
+
+func (r *staRepository) ListLocations(ctx context.Context, q *StaQuery) ([]*entities.Location, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	query, args := q.build(`
+		SELECT l.id, l.name, l.description, l.latitude, l.longitude, l.is_active, l.bank_level, l.tele_station_id, l.province_code, l.created_at, l.updated_at
+		FROM locations l
+		WHERE l.is_active = TRUE
+	`, true)
+
+	result := make([]*entities.Location, 0)
+	if err := r.db.SelectContext(ctx, &result, query, args...); err != nil {
+		log.Printf("Error failed to select from locations database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *staRepository) ListDatastreams(ctx context.Context, q *StaQuery) ([]*entities.DatastreamRow, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	query, args := q.build(`
+		SELECT l.id, l.name, l.description, l.latitude, l.longitude, l.is_active, l.bank_level, l.tele_station_id, l.province_code, l.created_at, l.updated_at,
+			span.first_measured_at, span.last_measured_at
+		FROM locations l
+		LEFT JOIN LATERAL (
+			SELECT MIN(measured_at) AS first_measured_at, MAX(measured_at) AS last_measured_at
+			FROM water_levels
+			WHERE location_id = l.id
+		) span ON TRUE
+		WHERE l.is_active = TRUE
+	`, true)
+
+	result := make([]*entities.DatastreamRow, 0)
+	if err := r.db.SelectContext(ctx, &result, query, args...); err != nil {
+		log.Printf("Error failed to select from locations database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *staRepository) ListObservations(ctx context.Context, q *StaQuery) ([]*entities.WaterLevel, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	query, args := q.build(`
+		SELECT `+waterLevelColumns("wl")+`
+		FROM water_levels wl
+		JOIN locations l ON l.id = wl.location_id
+		WHERE l.is_active = TRUE
+	`, true)
+
+	result := make([]*entities.WaterLevel, 0)
+	if err := r.db.SelectContext(ctx, &result, query, args...); err != nil {
+		log.Printf("Error failed to select from water_levels database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *staRepository) CountLocations(ctx context.Context, q *StaQuery) (int64, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	query, args := q.build(`SELECT COUNT(*) FROM locations l WHERE l.is_active = TRUE`, false)
+
+	var count int64
+	if err := r.db.GetContext(ctx, &count, query, args...); err != nil {
+		log.Printf("Error failed to count locations database %v", err.Error())
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *staRepository) CountObservations(ctx context.Context, q *StaQuery) (int64, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	query, args := q.build(`
+		SELECT COUNT(*)
+		FROM water_levels wl
+		JOIN locations l ON l.id = wl.location_id
+		WHERE l.is_active = TRUE
+	`, false)
+
+	var count int64
+	if err := r.db.GetContext(ctx, &count, query, args...); err != nil {
+		log.Printf("Error failed to count water_levels database %v", err.Error())
+		return 0, err
+	}
+
+	return count, nil
+}
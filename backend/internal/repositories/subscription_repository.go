@@ -0,0 +1,232 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/jmoiron/sqlx"
+)
+
+type subscriptionRepository struct {
+	db *sqlx.DB
+}
+
+type SubscriptionRepositoryInterface interface {
+	ListByUser(ctx context.Context, userID int64) ([]*entities.Subscription, error)
+	GetByID(ctx context.Context, id int64) (*entities.Subscription, error)
+	Create(ctx context.Context, subscription *entities.Subscription) error
+	Update(ctx context.Context, subscription *entities.Subscription) (bool, error)
+	SetSecret(ctx context.Context, userID int64, id int64, secret string) (bool, error)
+	Delete(ctx context.Context, userID int64, id int64) (bool, error)
+	FindSubscribers(ctx context.Context, locationID int64, danger string) ([]*entities.Subscription, error)
+	ListDigestLocations(ctx context.Context, digest string) ([]*entities.SubscriptionLocation, error)
+}
+
+func NewSubscriptionRepository(db *sqlx.DB) SubscriptionRepositoryInterface {
+	return &subscriptionRepository{
+		db: db,
+	}
+}
+
+func (r *subscriptionRepository) ListByUser(ctx context.Context, userID int64) ([]*entities.Subscription, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `SELECT * FROM user_subscriptions WHERE user_id = $1 ORDER BY id`
+
+	result := make([]*entities.Subscription, 0)
+	if err := r.db.SelectContext(ctx, &result, query, userID); err != nil {
+		log.Printf("Error failed to select from user_subscriptions database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *subscriptionRepository) GetByID(ctx context.Context, id int64) (*entities.Subscription, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `SELECT * FROM user_subscriptions WHERE id = $1`
+
+	result := &entities.Subscription{}
+	if err := r.db.GetContext(ctx, result, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error failed to select from user_subscriptions database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *subscriptionRepository) Create(ctx context.Context, subscription *entities.Subscription) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `
+		INSERT INTO user_subscriptions (user_id, location_id, latitude, longitude, radius_km, min_danger, channel, target, quiet_start, quiet_end, digest, is_active, secret)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING *
+	`
+
+	if err := r.db.GetContext(ctx, subscription, query,
+		subscription.UserID, subscription.LocationID, subscription.Latitude, subscription.Longitude, subscription.RadiusKm,
+		subscription.MinDanger, subscription.Channel, subscription.Target, subscription.QuietStart, subscription.QuietEnd, subscription.Digest, subscription.IsActive,
+		subscription.Secret,
+	); err != nil {
+		log.Printf("Error failed to insert into user_subscriptions database %v", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Update replaces a subscription of its user, it reports false when the user has no such subscription
+func (r *subscriptionRepository) Update(ctx context.Context, subscription *entities.Subscription) (bool, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `
+		UPDATE user_subscriptions
+		SET location_id = $3,
+			latitude = $4,
+			longitude = $5,
+			radius_km = $6,
+			min_danger = $7,
+			channel = $8,
+			target = $9,
+			quiet_start = $10,
+			quiet_end = $11,
+			digest = $12,
+			is_active = $13,
+			updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		RETURNING *
+	`
+
+	if err := r.db.GetContext(ctx, subscription, query,
+		subscription.ID, subscription.UserID, subscription.LocationID, subscription.Latitude, subscription.Longitude, subscription.RadiusKm,
+		subscription.MinDanger, subscription.Channel, subscription.Target, subscription.QuietStart, subscription.QuietEnd, subscription.Digest, subscription.IsActive,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		log.Printf("Error failed to update user_subscriptions database %v", err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SetSecret replaces the signing secret of a subscription of its user, it reports false when the
+// user has no such subscription
+func (r *subscriptionRepository) SetSecret(ctx context.Context, userID int64, id int64, secret string) (bool, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `UPDATE user_subscriptions SET secret = $3, updated_at = NOW() WHERE id = $1 AND user_id = $2`, id, userID, secret)
+	if err != nil {
+		log.Printf("Error failed to update user_subscriptions database %v", err.Error())
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+func (r *subscriptionRepository) Delete(ctx context.Context, userID int64, id int64) (bool, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM user_subscriptions WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		log.Printf("Error failed to delete from user_subscriptions database %v", err.Error())
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// FindSubscribers returns the active subscriptions of active users that follow the location, directly
+// or by radius, at the given danger level. danger_level is an ordered enum so min_danger compares by severity.
+func (r *subscriptionRepository) FindSubscribers(ctx context.Context, locationID int64, danger string) ([]*entities.Subscription, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	query := `
+		SELECT s.*
+		FROM user_subscriptions s
+		JOIN users u ON u.id = s.user_id AND u.is_active
+		JOIN locations l ON l.id = $1
+		WHERE s.is_active
+			AND s.min_danger <= $2::danger_level
+			AND (
+				s.location_id = l.id
+				OR (s.location_id IS NULL AND 2 * 6371 * ASIN(SQRT(
+					POWER(SIN(RADIANS(l.latitude - s.latitude) / 2), 2) +
+					COS(RADIANS(s.latitude)) * COS(RADIANS(l.latitude)) * POWER(SIN(RADIANS(l.longitude - s.longitude) / 2), 2)
+				)) <= s.radius_km)
+			)
+		ORDER BY s.id
+	`
+
+	result := make([]*entities.Subscription, 0)
+	if err := r.db.SelectContext(ctx, &result, query, locationID, danger); err != nil {
+		log.Printf("Error failed to select from user_subscriptions database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ListDigestLocations returns the active locations followed by the active subscriptions that opted in
+// to the digest, ordered by subscription
+func (r *subscriptionRepository) ListDigestLocations(ctx context.Context, digest string) ([]*entities.SubscriptionLocation, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	query := `
+		SELECT s.id AS subscription_id, l.id AS location_id
+		FROM user_subscriptions s
+		JOIN users u ON u.id = s.user_id AND u.is_active
+		JOIN locations l ON l.is_active AND (
+			s.location_id = l.id
+			OR (s.location_id IS NULL AND 2 * 6371 * ASIN(SQRT(
+				POWER(SIN(RADIANS(l.latitude - s.latitude) / 2), 2) +
+				COS(RADIANS(s.latitude)) * COS(RADIANS(l.latitude)) * POWER(SIN(RADIANS(l.longitude - s.longitude) / 2), 2)
+			)) <= s.radius_km)
+		)
+		WHERE s.is_active AND s.digest = $1
+		ORDER BY s.id, l.id
+	`
+
+	result := make([]*entities.SubscriptionLocation, 0)
+	if err := r.db.SelectContext(ctx, &result, query, digest); err != nil {
+		log.Printf("Error failed to select from user_subscriptions database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,186 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/jmoiron/sqlx"
+)
+
+type thresholdRepository struct {
+	db *sqlx.DB
+}
+
+type ThresholdRepositoryInterface interface {
+	GetAll(ctx context.Context) ([]*entities.LocationThreshold, error)
+	GetByLocationID(ctx context.Context, locationID int64) (*entities.LocationThreshold, error)
+	Seed(ctx context.Context, threshold *entities.LocationThreshold) error
+	Update(ctx context.Context, threshold *entities.LocationThreshold, note string) (*entities.LocationThreshold, error)
+	GetHistory(ctx context.Context, locationID int64, limit int) ([]*entities.LocationThresholdHistory, error)
+	LocationExists(ctx context.Context, locationID int64) (bool, error)
+}
+
+func NewThresholdRepository(db *sqlx.DB) ThresholdRepositoryInterface {
+	return &thresholdRepository{
+		db: db,
+	}
+}
+
+func (r *thresholdRepository) GetAll(ctx context.Context) ([]*entities.LocationThreshold, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	query := `SELECT * FROM location_thresholds ORDER BY location_id`
+
+	result := make([]*entities.LocationThreshold, 0)
+	if err := r.db.SelectContext(ctx, &result, query); err != nil {
+		log.Printf("Error failed to select from location_thresholds database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *thresholdRepository) GetByLocationID(ctx context.Context, locationID int64) (*entities.LocationThreshold, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `SELECT * FROM location_thresholds WHERE location_id = $1`
+
+	result := &entities.LocationThreshold{}
+	if err := r.db.GetContext(ctx, result, query, locationID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error failed to select from location_thresholds database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Seed stores initial thresholds for a location, leaving any existing row untouched
+func (r *thresholdRepository) Seed(ctx context.Context, threshold *entities.LocationThreshold) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `
+		INSERT INTO location_thresholds (location_id, warning_level_cm, danger_level_cm, critical_level_cm)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (location_id) DO NOTHING
+	`
+
+	_, err := r.db.ExecContext(ctx, query, threshold.LocationID, threshold.WarningLevelCm, threshold.DangerLevelCm, threshold.CriticalLevelCm)
+	if err != nil {
+		log.Printf("Error failed to insert into location_thresholds database %v", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Update replaces the thresholds of a location and records the previous values in the history table
+func (r *thresholdRepository) Update(ctx context.Context, threshold *entities.LocationThreshold, note string) (*entities.LocationThreshold, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("Error failed to begin transaction %v", err.Error())
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	previous := &entities.LocationThreshold{}
+	if err := tx.GetContext(ctx, previous, `SELECT * FROM location_thresholds WHERE location_id = $1 FOR UPDATE`, threshold.LocationID); err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error failed to select from location_thresholds database %v", err.Error())
+			return nil, err
+		}
+		previous = &entities.LocationThreshold{LocationID: threshold.LocationID}
+	}
+
+	query := `
+		INSERT INTO location_thresholds (location_id, warning_level_cm, danger_level_cm, critical_level_cm, rise_rate_limit_cm_per_hour, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (location_id) DO UPDATE SET
+			warning_level_cm = EXCLUDED.warning_level_cm,
+			danger_level_cm = EXCLUDED.danger_level_cm,
+			critical_level_cm = EXCLUDED.critical_level_cm,
+			rise_rate_limit_cm_per_hour = EXCLUDED.rise_rate_limit_cm_per_hour,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = NOW()
+		RETURNING *
+	`
+
+	result := &entities.LocationThreshold{}
+	if err := tx.GetContext(ctx, result, query,
+		threshold.LocationID, threshold.WarningLevelCm, threshold.DangerLevelCm, threshold.CriticalLevelCm, threshold.RiseRateLimitCmPerHour, threshold.UpdatedBy,
+	); err != nil {
+		log.Printf("Error failed to upsert location_thresholds database %v", err.Error())
+		return nil, err
+	}
+
+	historyQuery := `
+		INSERT INTO location_threshold_history (
+			location_id,
+			old_warning_level_cm, old_danger_level_cm, old_critical_level_cm, old_rise_rate_limit_cm_per_hour,
+			new_warning_level_cm, new_danger_level_cm, new_critical_level_cm, new_rise_rate_limit_cm_per_hour,
+			changed_by, note
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''))
+	`
+
+	if _, err := tx.ExecContext(ctx, historyQuery,
+		threshold.LocationID,
+		previous.WarningLevelCm, previous.DangerLevelCm, previous.CriticalLevelCm, previous.RiseRateLimitCmPerHour,
+		result.WarningLevelCm, result.DangerLevelCm, result.CriticalLevelCm, result.RiseRateLimitCmPerHour,
+		threshold.UpdatedBy, note,
+	); err != nil {
+		log.Printf("Error failed to insert into location_threshold_history database %v", err.Error())
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error failed to commit transaction %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *thresholdRepository) GetHistory(ctx context.Context, locationID int64, limit int) ([]*entities.LocationThresholdHistory, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	query := `SELECT * FROM location_threshold_history WHERE location_id = $1 ORDER BY changed_at DESC, id DESC LIMIT $2`
+
+	result := make([]*entities.LocationThresholdHistory, 0)
+	if err := r.db.SelectContext(ctx, &result, query, locationID, limit); err != nil {
+		log.Printf("Error failed to select from location_threshold_history database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *thresholdRepository) LocationExists(ctx context.Context, locationID int64) (bool, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	var exists bool
+	if err := r.db.GetContext(ctx, &exists, `SELECT EXISTS (SELECT 1 FROM locations WHERE id = $1)`, locationID); err != nil {
+		log.Printf("Error failed to select from locations database %v", err.Error())
+		return false, err
+	}
+
+	return exists, nil
+}
@@ -2,24 +2,58 @@ package repositories
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/guatom999/self-boardcast/internal/entities"
 	"github.com/guatom999/self-boardcast/internal/models"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type waterLevelRepository struct {
 	db *sqlx.DB
 }
 
+// waterLevelColumns selects the columns of entities.WaterLevel from table, the nullable image and
+// note are read as empty strings
+func waterLevelColumns(table string) string {
+	columns := []string{
+		"id", "location_id", "level_cm", "image", "danger", "is_flooded", "source", "measured_at", "note",
+		"situation_level", "situation_color", "situation_text", "status", "deleted_at", "scheduled_delete_at",
+		"rise_rate_cm_per_hour", "image_uploaded_by",
+	}
+	for i, column := range columns {
+		if column == "image" || column == "note" {
+			columns[i] = fmt.Sprintf("COALESCE(%s.%s, '') AS %s", table, column, column)
+			continue
+		}
+		columns[i] = table + "." + column
+	}
+	return strings.Join(columns, ", ")
+}
+
 // WaterLevelRepository interface
 type WaterLevelRepositoryInterface interface {
 	// GetLatest(ctx context.Context) (*models.WaterLevel, error)
-	GetAll(ctx context.Context, limit int) ([]models.LocationWithWaterLevel, error)
+	GetAll(ctx context.Context, limit int, excludeSource string) ([]models.LocationWithWaterLevel, error)
+	GetLatestDangers(ctx context.Context, excludeSource string) ([]*entities.LocationDanger, error)
 	GetByLocationID(ctx context.Context, locationID int) ([]*entities.WaterLevel, error)
+	GetReadings(ctx context.Context, filter *ReadingFilter) ([]*entities.WaterLevel, error)
+	AggregateReadings(ctx context.Context, locationID int64, from time.Time, to time.Time, interval string, excludeSource string) ([]*entities.ReadingBucket, error)
+	GetSeries(ctx context.Context, locationID int64, from time.Time, to time.Time, excludeSource string) ([]*entities.SeriesPoint, error)
+	GetEarliestReading(ctx context.Context, locationID int64, from time.Time, to time.Time, excludeSource string) (*entities.SeriesPoint, error)
+	GetNearestReading(ctx context.Context, locationID int64, at time.Time, maxGap time.Duration, excludeSource string) (*entities.SeriesPoint, error)
+	GetDigestStats(ctx context.Context, locationIDs []int64, from time.Time, to time.Time, maxGap time.Duration, excludeSource string) ([]*entities.LocationDigest, error)
+	GetStationLocations(ctx context.Context) ([]*entities.Location, error)
+	GetLocationByID(ctx context.Context, id int64) (*entities.Location, error)
+	GetLocationByStationID(ctx context.Context, stationID int64) (*entities.Location, error)
 	CreateWaterLevel(ctx context.Context, req *entities.WaterLevel) error
+	UpsertWaterLevel(ctx context.Context, req *entities.WaterLevel) (models.ReadingOutcome, error)
+	GetMeasuredTimes(ctx context.Context, locationID int64, from time.Time, to time.Time, excludeSource string) ([]time.Time, error)
 	// DeleteOldestWaterLevels(ctx context.Context, locationID int, keepLatest int) error
 
 	MarkForDeletion(ctx context.Context, id int64, scheduledAt time.Time) error
@@ -34,6 +68,21 @@ type WaterLevelRepositoryInterface interface {
 	// GetFailedDeletions(ctx context.Context) ([]*entities.WaterLevel, error)
 }
 
+// ReadingFilter selects a page of readings. After, when set, is the (measured_at, id) key of the last row of the previous page.
+type ReadingFilter struct {
+	LocationID int64
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Descending bool
+	After      *ReadingKey
+}
+
+type ReadingKey struct {
+	MeasuredAt time.Time
+	ID         int64
+}
+
 func NewWaterLevelRepository(db *sqlx.DB) WaterLevelRepositoryInterface {
 	return &waterLevelRepository{
 		db: db,
@@ -43,7 +92,9 @@ func NewWaterLevelRepository(db *sqlx.DB) WaterLevelRepositoryInterface {
 //	func (r *waterLevelRepository) GetLatest(ctx context.Context) (*models.WaterLevel, error) {
 //		return nil, nil
 //	}
-func (r *waterLevelRepository) GetAll(pctx context.Context, limit int) ([]models.LocationWithWaterLevel, error) {
+
+// GetAll returns every active location with its latest reading from a source other than excludeSource
+func (r *waterLevelRepository) GetAll(pctx context.Context, limit int, excludeSource string) ([]models.LocationWithWaterLevel, error) {
 
 	ctx, cancel := context.WithTimeout(pctx, time.Second*20)
 	defer cancel()
@@ -63,16 +114,18 @@ func (r *waterLevelRepository) GetAll(pctx context.Context, limit int) ([]models
             wl.danger,
             wl.is_flooded,
             wl.measured_at,
-            wl.note
+            wl.note,
+            wl.situation_color,
+            wl.situation_text
         FROM locations l
-        LEFT JOIN water_levels wl ON l.id = wl.location_id
+        LEFT JOIN water_levels wl ON l.id = wl.location_id AND wl.source IS DISTINCT FROM $1
         WHERE l.is_active = TRUE
         ORDER BY l.id, wl.measured_at DESC NULLS LAST
     `
 
 	result := make([]models.LocationWithWaterLevel, 0)
 
-	if err := r.db.SelectContext(ctx, &result, query); err != nil {
+	if err := r.db.SelectContext(ctx, &result, query, excludeSource); err != nil {
 		log.Printf("Error failed to select from locations database %v", err.Error())
 		return nil, err
 	}
@@ -81,12 +134,35 @@ func (r *waterLevelRepository) GetAll(pctx context.Context, limit int) ([]models
 
 }
 
+// GetLatestDangers returns the danger of the latest reading from a source other than excludeSource
+// of every location that has one
+func (r *waterLevelRepository) GetLatestDangers(ctx context.Context, excludeSource string) ([]*entities.LocationDanger, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*20)
+	defer cancel()
+
+	query := `
+		SELECT DISTINCT ON (location_id) location_id, danger
+		FROM water_levels
+		WHERE source IS DISTINCT FROM $1
+		ORDER BY location_id, measured_at DESC, id DESC
+	`
+
+	result := make([]*entities.LocationDanger, 0)
+	if err := r.db.SelectContext(ctx, &result, query, excludeSource); err != nil {
+		log.Printf("Error failed to select from water_levels database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
 func (r *waterLevelRepository) GetByLocationID(ctx context.Context, locationID int) ([]*entities.WaterLevel, error) {
 
 	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
 
-	query := `SELECT * FROM water_levels WHERE location_id = $1`
+	query := `SELECT ` + waterLevelColumns("water_levels") + ` FROM water_levels WHERE location_id = $1`
 
 	result := make([]*entities.WaterLevel, 0)
 	if err := r.db.SelectContext(ctx, &result, query, locationID); err != nil {
@@ -97,6 +173,304 @@ func (r *waterLevelRepository) GetByLocationID(ctx context.Context, locationID i
 	return result, nil
 }
 
+func (r *waterLevelRepository) GetReadings(ctx context.Context, filter *ReadingFilter) ([]*entities.WaterLevel, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	conditions := []string{"location_id = $1"}
+	args := []any{filter.LocationID}
+
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		conditions = append(conditions, fmt.Sprintf("measured_at >= $%d", len(args)))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		conditions = append(conditions, fmt.Sprintf("measured_at < $%d", len(args)))
+	}
+
+	order := "ASC"
+	comparison := ">"
+	if filter.Descending {
+		order = "DESC"
+		comparison = "<"
+	}
+
+	if filter.After != nil {
+		args = append(args, filter.After.MeasuredAt, filter.After.ID)
+		conditions = append(conditions, fmt.Sprintf("(measured_at, id) %s ($%d, $%d)", comparison, len(args)-1, len(args)))
+	}
+
+	args = append(args, filter.Limit)
+
+	query := fmt.Sprintf(`SELECT %s FROM water_levels WHERE %s ORDER BY measured_at %s, id %s LIMIT $%d`,
+		waterLevelColumns("water_levels"), strings.Join(conditions, " AND "), order, order, len(args))
+
+	result := make([]*entities.WaterLevel, 0)
+	if err := r.db.SelectContext(ctx, &result, query, args...); err != nil {
+		log.Printf("Error failed to select from water_levels database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// AggregateReadings groups readings from sources other than excludeSource into buckets of the given
+// Postgres interval, aligned on midnight in Bangkok
+func (r *waterLevelRepository) AggregateReadings(ctx context.Context, locationID int64, from time.Time, to time.Time, interval string, excludeSource string) ([]*entities.ReadingBucket, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*20)
+	defer cancel()
+
+	query := `
+		SELECT
+			date_bin($2::interval, measured_at, TIMESTAMPTZ '2000-01-01 00:00:00+07') AS bucket,
+			MIN(level_cm) AS min,
+			MAX(level_cm) AS max,
+			AVG(level_cm) AS avg,
+			(ARRAY_AGG(level_cm ORDER BY measured_at DESC))[1] AS last,
+			COUNT(*) AS count
+		FROM water_levels
+		WHERE location_id = $1
+			AND measured_at >= $3
+			AND measured_at < $4
+			AND source IS DISTINCT FROM $5
+		GROUP BY bucket
+		ORDER BY bucket
+	`
+
+	result := make([]*entities.ReadingBucket, 0)
+	if err := r.db.SelectContext(ctx, &result, query, locationID, interval, from, to, excludeSource); err != nil {
+		log.Printf("Error failed to aggregate water_levels database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetSeries returns the readings of a location in [from, to) from sources other than excludeSource
+func (r *waterLevelRepository) GetSeries(ctx context.Context, locationID int64, from time.Time, to time.Time, excludeSource string) ([]*entities.SeriesPoint, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*20)
+	defer cancel()
+
+	query := `
+		SELECT measured_at, level_cm
+		FROM water_levels
+		WHERE location_id = $1
+			AND measured_at >= $2
+			AND measured_at < $3
+			AND source IS DISTINCT FROM $4
+		ORDER BY measured_at, id
+	`
+
+	result := make([]*entities.SeriesPoint, 0)
+	if err := r.db.SelectContext(ctx, &result, query, locationID, from, to, excludeSource); err != nil {
+		log.Printf("Error failed to select from water_levels database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetDigestStats summarises the readings of the locations in [from, to). A reading holds its danger
+// level until the next reading, at most maxGap, so a station that stopped reporting is not counted
+// at its last danger for the rest of the period. Readings from excludeSource are left out.
+func (r *waterLevelRepository) GetDigestStats(ctx context.Context, locationIDs []int64, from time.Time, to time.Time, maxGap time.Duration, excludeSource string) ([]*entities.LocationDigest, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	query := `
+		WITH readings AS (
+			SELECT location_id, level_cm, danger, measured_at,
+				LEAST(
+					LEAD(measured_at) OVER (PARTITION BY location_id ORDER BY measured_at, id),
+					measured_at + make_interval(secs => $4),
+					$3
+				) - measured_at AS held
+			FROM water_levels
+			WHERE location_id = ANY($1)
+				AND measured_at >= $2
+				AND measured_at < $3
+				AND source IS DISTINCT FROM $5
+		),
+		stats AS (
+			SELECT location_id,
+				COUNT(*) AS readings,
+				MIN(level_cm) AS min_cm,
+				MAX(level_cm) AS max_cm,
+				COALESCE(SUM(EXTRACT(EPOCH FROM held)) FILTER (WHERE danger = 'SAFE'), 0) AS safe_seconds,
+				COALESCE(SUM(EXTRACT(EPOCH FROM held)) FILTER (WHERE danger = 'WATCH'), 0) AS watch_seconds,
+				COALESCE(SUM(EXTRACT(EPOCH FROM held)) FILTER (WHERE danger = 'DANGER'), 0) AS danger_seconds,
+				COALESCE(SUM(EXTRACT(EPOCH FROM held)) FILTER (WHERE danger = 'CRITICAL'), 0) AS critical_seconds
+			FROM readings
+			GROUP BY location_id
+		),
+		latest AS (
+			SELECT DISTINCT ON (location_id) location_id, level_cm, danger, measured_at
+			FROM water_levels
+			WHERE location_id = ANY($1) AND measured_at < $3 AND source IS DISTINCT FROM $5
+			ORDER BY location_id, measured_at DESC, id DESC
+		)
+		SELECT l.id AS location_id, l.name,
+			COALESCE(s.readings, 0) AS readings,
+			s.min_cm, s.max_cm,
+			lt.level_cm AS current_cm,
+			lt.danger AS current_danger,
+			lt.measured_at AS last_measured_at,
+			COALESCE(s.safe_seconds, 0) AS safe_seconds,
+			COALESCE(s.watch_seconds, 0) AS watch_seconds,
+			COALESCE(s.danger_seconds, 0) AS danger_seconds,
+			COALESCE(s.critical_seconds, 0) AS critical_seconds
+		FROM locations l
+		LEFT JOIN stats s ON s.location_id = l.id
+		LEFT JOIN latest lt ON lt.location_id = l.id
+		WHERE l.id = ANY($1)
+		ORDER BY l.name, l.id
+	`
+
+	result := make([]*entities.LocationDigest, 0)
+	if err := r.db.SelectContext(ctx, &result, query, pq.Array(locationIDs), from, to, maxGap.Seconds(), excludeSource); err != nil {
+		log.Printf("Error failed to select from water_levels database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetEarliestReading returns the first reading of a location in [from, to), nil when there is none.
+// Readings without a source are manual entries and, like excludeSource, are left out.
+func (r *waterLevelRepository) GetEarliestReading(ctx context.Context, locationID int64, from time.Time, to time.Time, excludeSource string) (*entities.SeriesPoint, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `
+		SELECT measured_at, level_cm
+		FROM water_levels
+		WHERE location_id = $1
+			AND measured_at >= $2
+			AND measured_at < $3
+			AND source IS NOT NULL
+			AND source <> $4
+		ORDER BY measured_at, id
+		LIMIT 1
+	`
+
+	result := new(entities.SeriesPoint)
+	if err := r.db.GetContext(ctx, result, query, locationID, from, to, excludeSource); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error failed to select from water_levels database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetNearestReading returns the reading closest to at, within maxGap either side. Readings without
+// a source are manual entries and, like excludeSource, are left out.
+func (r *waterLevelRepository) GetNearestReading(ctx context.Context, locationID int64, at time.Time, maxGap time.Duration, excludeSource string) (*entities.SeriesPoint, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `
+		SELECT measured_at, level_cm
+		FROM water_levels
+		WHERE location_id = $1
+			AND measured_at BETWEEN $2::timestamptz - make_interval(secs => $3) AND $2::timestamptz + make_interval(secs => $3)
+			AND source IS NOT NULL
+			AND source <> $4
+		ORDER BY abs(extract(epoch FROM measured_at - $2::timestamptz)), id
+		LIMIT 1
+	`
+
+	result := new(entities.SeriesPoint)
+	if err := r.db.GetContext(ctx, result, query, locationID, at, maxGap.Seconds(), excludeSource); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error failed to select from water_levels database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetStationLocations returns active locations that are mapped to a ThaiWater tele-station
+func (r *waterLevelRepository) GetStationLocations(ctx context.Context) ([]*entities.Location, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	query := `
+		SELECT id, name, description, latitude, longitude, is_active, bank_level, tele_station_id, province_code, created_at, updated_at
+		FROM locations
+		WHERE is_active = TRUE
+			AND tele_station_id IS NOT NULL
+			AND province_code IS NOT NULL
+		ORDER BY province_code, id
+	`
+
+	result := make([]*entities.Location, 0)
+	if err := r.db.SelectContext(ctx, &result, query); err != nil {
+		log.Printf("Error failed to select from locations database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *waterLevelRepository) GetLocationByID(ctx context.Context, id int64) (*entities.Location, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `
+		SELECT id, name, description, latitude, longitude, is_active, bank_level, tele_station_id, province_code, created_at, updated_at
+		FROM locations
+		WHERE id = $1
+	`
+
+	result := &entities.Location{}
+	if err := r.db.GetContext(ctx, result, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error failed to select from locations database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *waterLevelRepository) GetLocationByStationID(ctx context.Context, stationID int64) (*entities.Location, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `
+		SELECT id, name, description, latitude, longitude, is_active, bank_level, tele_station_id, province_code, created_at, updated_at
+		FROM locations
+		WHERE tele_station_id = $1
+	`
+
+	result := &entities.Location{}
+	if err := r.db.GetContext(ctx, result, query, stationID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error failed to select from locations database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
 func (r *waterLevelRepository) GetLastWaterLevelWithLimit(ctx context.Context, locationID int, limit int) (*entities.WaterLevel, error) {
 
 	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
@@ -118,9 +492,9 @@ func (r *waterLevelRepository) CreateWaterLevel(ctx context.Context, req *entiti
 	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 
-	query := `INSERT INTO water_levels(location_id, level_cm, image, danger, is_flooded, source, measured_at, note, status) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	query := `INSERT INTO water_levels(location_id, level_cm, image, danger, is_flooded, source, measured_at, note, situation_level, situation_color, situation_text, status) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
 
-	_, err := r.db.ExecContext(ctx, query, req.LocationID, req.LevelCm, req.Image, req.Danger, req.IsFlooded, req.Source, req.MeasuredAt, req.Note, "ACTIVE")
+	_, err := r.db.ExecContext(ctx, query, req.LocationID, req.LevelCm, req.Image, req.Danger, req.IsFlooded, req.Source, req.MeasuredAt, req.Note, req.SituationLevel, req.SituationColor, req.SituationText, "ACTIVE")
 	if err != nil {
 		log.Printf("Error failed to insert into water_levels database %v", err.Error())
 		return err
@@ -129,6 +503,79 @@ func (r *waterLevelRepository) CreateWaterLevel(ctx context.Context, req *entiti
 	return nil
 }
 
+// UpsertWaterLevel inserts a ThaiWater telemetry reading or refreshes the one already stored for (location_id, measured_at),
+// so the cron and the backfill never store the same reading twice. Rows whose values did not change are left untouched
+// and reported as unchanged.
+func (r *waterLevelRepository) UpsertWaterLevel(ctx context.Context, req *entities.WaterLevel) (models.ReadingOutcome, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	query := `
+		INSERT INTO water_levels(location_id, level_cm, image, danger, is_flooded, source, measured_at, note, situation_level, situation_color, situation_text, rise_rate_cm_per_hour, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, 'ACTIVE')
+		ON CONFLICT (location_id, measured_at) WHERE source IN ('thaiwater', 'thaiwater_history') DO UPDATE SET
+			level_cm = EXCLUDED.level_cm,
+			image = COALESCE(NULLIF(EXCLUDED.image, ''), water_levels.image),
+			danger = EXCLUDED.danger,
+			is_flooded = EXCLUDED.is_flooded,
+			note = EXCLUDED.note,
+			situation_level = EXCLUDED.situation_level,
+			situation_color = EXCLUDED.situation_color,
+			situation_text = EXCLUDED.situation_text,
+			rise_rate_cm_per_hour = COALESCE(EXCLUDED.rise_rate_cm_per_hour, water_levels.rise_rate_cm_per_hour)
+		WHERE (water_levels.level_cm, water_levels.danger, water_levels.is_flooded, water_levels.situation_level, water_levels.situation_color, water_levels.situation_text)
+			IS DISTINCT FROM (EXCLUDED.level_cm, EXCLUDED.danger, EXCLUDED.is_flooded, EXCLUDED.situation_level, EXCLUDED.situation_color, EXCLUDED.situation_text)
+		RETURNING id, (xmax = 0) AS inserted
+	`
+
+	result := struct {
+		ID       int64 `db:"id"`
+		Inserted bool  `db:"inserted"`
+	}{}
+
+	if err := r.db.GetContext(ctx, &result, query,
+		req.LocationID, req.LevelCm, req.Image, req.Danger, req.IsFlooded, req.Source, req.MeasuredAt, req.Note,
+		req.SituationLevel, req.SituationColor, req.SituationText, req.RiseRateCmPerHour,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return models.ReadingUnchanged, nil
+		}
+		log.Printf("Error failed to upsert into water_levels database %v", err.Error())
+		return "", err
+	}
+
+	req.ID = result.ID
+
+	if result.Inserted {
+		return models.ReadingNew, nil
+	}
+	return models.ReadingUpdated, nil
+}
+
+// GetMeasuredTimes returns when readings from sources other than excludeSource were taken for a location in [from, to)
+func (r *waterLevelRepository) GetMeasuredTimes(ctx context.Context, locationID int64, from time.Time, to time.Time, excludeSource string) ([]time.Time, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	query := `
+		SELECT measured_at FROM water_levels
+		WHERE location_id = $1
+			AND measured_at >= $2
+			AND measured_at < $3
+			AND source IS DISTINCT FROM $4
+	`
+
+	result := make([]time.Time, 0)
+	if err := r.db.SelectContext(ctx, &result, query, locationID, from, to, excludeSource); err != nil {
+		log.Printf("Error failed to select from water_levels database %v", err.Error())
+		return nil, err
+	}
+
+	return result, nil
+}
+
 // func (r *waterLevelRepository) DeleteOldestWaterLevels(ctx context.Context, locationID int, keepLatest int) error {
 
 // 	ctx, cancel := context.WithTimeout(ctx, time.Second*60)
@@ -205,7 +652,7 @@ func (r *waterLevelRepository) GetPendingDeletions(ctx context.Context) ([]*enti
 	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 
-	query := `SELECT * FROM water_levels WHERE status = 'PENDING_DELETION'`
+	query := `SELECT ` + waterLevelColumns("water_levels") + ` FROM water_levels WHERE status = 'PENDING_DELETION'`
 
 	result := make([]*entities.WaterLevel, 0)
 	if err := r.db.SelectContext(ctx, &result, query); err != nil {
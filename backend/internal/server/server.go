@@ -11,19 +11,28 @@ import (
 	"time"
 
 	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/events"
 	"github.com/guatom999/self-boardcast/internal/handlers"
+	customMiddleware "github.com/guatom999/self-boardcast/internal/middleware"
+	"github.com/guatom999/self-boardcast/internal/predictor"
 	"github.com/guatom999/self-boardcast/internal/repositories"
 	"github.com/guatom999/self-boardcast/internal/services"
+	"github.com/guatom999/self-boardcast/internal/tasks"
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
 type Server struct {
-	db          *sqlx.DB
-	echo        *echo.Echo
-	cfg         *config.Config
-	authService services.AuthServiceInterface
+	db            *sqlx.DB
+	echo          *echo.Echo
+	cfg           *config.Config
+	authService   services.AuthServiceInterface
+	broker        *events.Broker
+	publisher     *events.Publisher
+	exports       *tasks.ExportProducer
+	notifications *tasks.NotificationProducer
+	images        *tasks.ImageProducer
 }
 
 func NewServer(db *sqlx.DB, cfg *config.Config) *Server {
@@ -39,16 +48,22 @@ func NewServer(db *sqlx.DB, cfg *config.Config) *Server {
 	authService := services.NewAuthService(authRepo, cfg)
 
 	return &Server{
-		db:          db,
-		echo:        e,
-		cfg:         cfg,
-		authService: authService,
+		db:            db,
+		echo:          e,
+		cfg:           cfg,
+		authService:   authService,
+		broker:        events.NewBroker(cfg.Redis.Addr),
+		publisher:     events.NewPublisher(cfg.Redis.Addr),
+		exports:       tasks.NewExportProducer(cfg.Redis.Addr),
+		notifications: tasks.NewNotificationProducer(cfg.Redis.Addr),
+		images:        tasks.NewImageProducer(cfg.Redis.Addr),
 	}
 }
 
 func (s *Server) WaterModules() {
 	repo := repositories.NewWaterLevelRepository(s.db)
-	service := services.NewWaterLevelService(repo, s.cfg.App.BaseURL, s.cfg)
+	thresholdRepo := repositories.NewThresholdRepository(s.db)
+	service := services.NewWaterLevelService(repo, thresholdRepo, s.cfg.App.BaseURL, s.cfg)
 	handler := handlers.NewMapHandler(service)
 
 	s.echo.GET("/heath", func(c echo.Context) error {
@@ -56,14 +71,132 @@ func (s *Server) WaterModules() {
 	})
 
 	s.echo.GET("/markers", handler.GetMapMarkers)
+	s.echo.GET("/markers.geojson", handler.GetMarkersGeoJSON)
 	s.echo.GET("/markers/detail", handler.GetSectionDetail)
+	s.echo.GET("/locations/:id/readings", handler.GetReadings)
+	s.echo.GET("/locations/:id/readings/aggregate", handler.GetReadingsAggregate)
+}
+
+func (s *Server) ThresholdModules() {
+	repo := repositories.NewThresholdRepository(s.db)
+	service := services.NewThresholdService(repo)
+	handler := handlers.NewThresholdHandler(service)
+
+	admin := s.echo.Group("/admin", customMiddleware.JWTMiddleware(s.authService), customMiddleware.AdminOnlyMiddleware())
+	admin.GET("/thresholds", handler.GetThresholds)
+	admin.GET("/locations/:id/thresholds", handler.GetThreshold)
+	admin.PUT("/locations/:id/thresholds", handler.UpdateThreshold)
+	admin.GET("/locations/:id/thresholds/history", handler.GetThresholdHistory)
+}
+
+func (s *Server) SubscriptionModules() {
+	repo := repositories.NewSubscriptionRepository(s.db)
+	service := services.NewSubscriptionService(repo, repositories.NewWaterLevelRepository(s.db))
+	handler := handlers.NewSubscriptionHandler(service)
+
+	subscriptions := s.echo.Group("/subscriptions", customMiddleware.JWTMiddleware(s.authService))
+	subscriptions.GET("", handler.ListSubscriptions)
+	subscriptions.POST("", handler.CreateSubscription)
+	subscriptions.GET("/:id", handler.GetSubscription)
+	subscriptions.PUT("/:id", handler.UpdateSubscription)
+	subscriptions.POST("/:id/secret", handler.RotateSecret)
+	subscriptions.DELETE("/:id", handler.DeleteSubscription)
+}
+
+func (s *Server) WebhookModules() {
+	service := services.NewWebhookService(repositories.NewNotificationRepository(s.db))
+	handler := handlers.NewWebhookHandler(service, s.notifications)
+
+	admin := s.echo.Group("/admin", customMiddleware.JWTMiddleware(s.authService), customMiddleware.AdminOnlyMiddleware())
+	admin.GET("/webhooks/deliveries", handler.ListFailedDeliveries)
+	admin.POST("/webhooks/deliveries/:id/replay", handler.ReplayDelivery)
+}
+
+func (s *Server) StreamModules() {
+	handler := handlers.NewStreamHandler(s.broker)
+
+	alertService := services.NewAlertService(repositories.NewAlertRepository(s.db), repositories.NewWaterLevelRepository(s.db), repositories.NewThresholdRepository(s.db), s.publisher, s.cfg)
+	wsHandler := handlers.NewWebSocketHandler(s.authService, alertService, s.broker, s.cfg.App.AllowedOrigins)
+
+	s.echo.GET("/stream/readings", handler.StreamReadings)
+	s.echo.GET("/ws", wsHandler.Serve)
+}
+
+func (s *Server) ExportModules() {
+	repo := repositories.NewExportRepository(s.db)
+	service := services.NewExportService(repo, s.cfg)
+	handler := handlers.NewExportHandler(service, s.exports)
+
+	exports := s.echo.Group("/exports", customMiddleware.JWTMiddleware(s.authService))
+	exports.GET("/readings", handler.ExportReadings)
+	exports.GET("/:id", handler.GetExport)
+	exports.GET("/:id/download", handler.DownloadExport)
+}
+
+func (s *Server) BatchPredictionModules() {
+	admin := s.echo.Group("/admin", customMiddleware.JWTMiddleware(s.authService), customMiddleware.AdminOnlyMiddleware())
+
+	// the rest of the API keeps serving, batch requests are refused until the predictor is fixed
+	levelPredictor, err := predictor.New(s.cfg)
+	if err != nil {
+		log.Printf("failed to create predictor, batch prediction is unavailable: %v", err)
+		unavailable := func(c echo.Context) error {
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{
+				"error": "Batch prediction is unavailable",
+			})
+		}
+		admin.POST("/predictions/batch", unavailable)
+		admin.GET("/predictions/batch/:file", unavailable)
+		return
+	}
+
+	service := services.NewBatchPredictionService(repositories.NewWaterLevelRepository(s.db), levelPredictor, s.cfg)
+	handler := handlers.NewBatchPredictionHandler(service, s.images)
+
+	admin.POST("/predictions/batch", handler.PredictBatch)
+	admin.GET("/predictions/batch/:file", handler.DownloadBatchReport)
+}
+
+func (s *Server) AnnotationModules() {
+	service := services.NewAnnotationService(repositories.NewAnnotationRepository(s.db), s.cfg)
+	handler := handlers.NewAnnotationHandler(service)
+
+	admin := s.echo.Group("/admin", customMiddleware.JWTMiddleware(s.authService), customMiddleware.AdminOnlyMiddleware())
+	admin.GET("/annotations/unlabelled", handler.ListUnlabelled)
+	admin.PUT("/annotations/:image", handler.Annotate)
+	admin.GET("/annotations/export", handler.ExportDataset)
+}
+
+func (s *Server) WaterMLModules() {
+	service := services.NewWaterMLService(repositories.NewExportRepository(s.db), repositories.NewWaterLevelRepository(s.db), s.cfg)
+	handler := handlers.NewWaterMLHandler(service)
+
+	s.echo.GET("/locations/:id/waterml", handler.GetWaterML)
+}
+
+func (s *Server) ForecastModules() {
+	service := services.NewForecastService(repositories.NewWaterLevelRepository(s.db))
+	handler := handlers.NewForecastHandler(service)
+
+	s.echo.GET("/locations/:id/forecast", handler.GetForecast)
+}
+
+func (s *Server) StaModules() {
+	repo := repositories.NewStaRepository(s.db)
+	service := services.NewStaService(repo, s.cfg.App.BaseURL)
+	handler := handlers.NewStaHandler(service)
+
+	s.echo.GET(services.StaVersionPath, handler.GetRoot)
+	s.echo.GET(services.StaVersionPath+"/*", handler.GetResource)
 }
 
 func (s *Server) ImageModules() {
-	imageHandler := handlers.NewImageHandler(s.cfg)
+	service := services.NewImageService(repositories.NewImageRepository(s.db), repositories.NewWaterLevelRepository(s.db), s.cfg)
+	imageHandler := handlers.NewImageHandler(s.cfg, service, s.images)
 
 	s.echo.GET("/images/:filename", imageHandler.ServeImage)
 	s.echo.GET("/images/health", imageHandler.HealthCheck)
+	s.echo.POST("/locations/:id/images", imageHandler.UploadImage, customMiddleware.JWTMiddleware(s.authService))
 }
 
 func (s *Server) AuthModules() {
@@ -80,6 +213,9 @@ func (s *Server) AuthModules() {
 }
 
 func (s *Server) Start() error {
+	brokerCtx, stopBroker := context.WithCancel(context.Background())
+	go s.broker.Run(brokerCtx)
+
 	go func() {
 		if err := s.echo.Start(fmt.Sprintf(":%d", s.cfg.Server.Port)); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server failed to start: %v", err)
@@ -88,7 +224,17 @@ func (s *Server) Start() error {
 
 	s.AuthModules()
 	s.WaterModules()
+	s.ThresholdModules()
+	s.SubscriptionModules()
+	s.WebhookModules()
+	s.StreamModules()
+	s.ExportModules()
+	s.StaModules()
+	s.WaterMLModules()
+	s.ForecastModules()
 	s.ImageModules()
+	s.BatchPredictionModules()
+	s.AnnotationModules()
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
@@ -96,6 +242,24 @@ func (s *Server) Start() error {
 	<-quit
 	log.Println(" Shutting down server...")
 
+	// close the streams first, open SSE connections would otherwise hold the shutdown
+	stopBroker()
+	if err := s.broker.Close(); err != nil {
+		log.Printf("failed to close event broker: %v", err)
+	}
+	if err := s.publisher.Close(); err != nil {
+		log.Printf("failed to close event publisher: %v", err)
+	}
+	if err := s.exports.Close(); err != nil {
+		log.Printf("failed to close export producer: %v", err)
+	}
+	if err := s.notifications.Close(); err != nil {
+		log.Printf("failed to close notification producer: %v", err)
+	}
+	if err := s.images.Close(); err != nil {
+		log.Printf("failed to close image producer: %v", err)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
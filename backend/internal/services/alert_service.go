@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/guatom999/self-boardcast/internal/events"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/utils"
+)
+
+var ErrAlertNotFound = errors.New("alert not found")
+
+// Alert states
+const (
+	AlertOpen         = "OPEN"
+	AlertAcknowledged = "ACKNOWLEDGED"
+	AlertResolved     = "RESOLVED"
+)
+
+// Alert event types
+const (
+	AlertEventOpened       = "OPENED"
+	AlertEventEscalated    = "ESCALATED"
+	AlertEventDeescalated  = "DEESCALATED"
+	AlertEventRenotified   = "RENOTIFIED"
+	AlertEventAcknowledged = "ACKNOWLEDGED"
+	AlertEventResolved     = "RESOLVED"
+)
+
+// dangerRanks orders the danger_level enum, an alert is open while the level is above SAFE
+var dangerRanks = map[string]int{
+	DangerSafe:     0,
+	DangerWatch:    1,
+	DangerDanger:   2,
+	DangerCritical: 3,
+}
+
+var dangerByRank = []string{DangerSafe, DangerWatch, DangerDanger, DangerCritical}
+
+type alertService struct {
+	repo          repositories.AlertRepositoryInterface
+	waterRepo     repositories.WaterLevelRepositoryInterface
+	thresholdRepo repositories.ThresholdRepositoryInterface
+	publisher     *events.Publisher
+	cfg           *config.Config
+}
+
+type AlertServiceInterface interface {
+	// EvaluateReading moves the alert of the reading's location through OPEN, ACKNOWLEDGED and RESOLVED.
+	// It returns nil when nothing changed and subscribers need not be notified.
+	EvaluateReading(ctx context.Context, reading *models.IngestedReading) (*models.AlertTransition, error)
+	AcknowledgeAlert(ctx context.Context, alertID int64, userID int64) (*models.AlertRes, error)
+}
+
+func NewAlertService(repo repositories.AlertRepositoryInterface, waterRepo repositories.WaterLevelRepositoryInterface, thresholdRepo repositories.ThresholdRepositoryInterface, publisher *events.Publisher, cfg *config.Config) AlertServiceInterface {
+	return &alertService{
+		repo:          repo,
+		waterRepo:     waterRepo,
+		thresholdRepo: thresholdRepo,
+		publisher:     publisher,
+		cfg:           cfg,
+	}
+}
+
+func (s *alertService) EvaluateReading(ctx context.Context, reading *models.IngestedReading) (*models.AlertTransition, error) {
+	waterLevel := reading.Reading
+	now := time.Now()
+
+	active, err := s.repo.GetActiveAlert(ctx, waterLevel.LocationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if active == nil {
+		if dangerRanks[waterLevel.Danger] == 0 {
+			return nil, nil
+		}
+
+		alert := &entities.Alert{
+			LocationID:     waterLevel.LocationID,
+			WaterLevelID:   sql.NullInt64{Int64: waterLevel.ID, Valid: waterLevel.ID != 0},
+			Danger:         waterLevel.Danger,
+			LevelCm:        waterLevel.LevelCm,
+			MeasuredAt:     waterLevel.MeasuredAt,
+			State:          AlertOpen,
+			LastNotifiedAt: sql.NullTime{Time: now, Valid: true},
+		}
+		event := newAlertEvent(AlertEventOpened, alert, "")
+
+		if err := s.repo.CreateAlert(ctx, alert, event); err != nil {
+			return nil, err
+		}
+
+		return s.transition(ctx, reading.Location, alert, event.Type, "")
+	}
+
+	threshold, err := s.thresholdRepo.GetByLocationID(ctx, waterLevel.LocationID)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := active.Danger
+	danger := settledDanger(waterLevel.LevelCm, waterLevel.Danger, previous, threshold, s.cfg.Alert.HysteresisCm)
+
+	var eventType string
+	switch {
+	case dangerRanks[danger] > dangerRanks[previous]:
+		eventType = AlertEventEscalated
+		// an escalation needs attention again even if the alert was acknowledged
+		active.State = AlertOpen
+	case dangerRanks[danger] == 0:
+		eventType = AlertEventResolved
+		active.State = AlertResolved
+		active.ResolvedAt = sql.NullTime{Time: now, Valid: true}
+	case dangerRanks[danger] < dangerRanks[previous]:
+		eventType = AlertEventDeescalated
+	case active.State == AlertOpen && (!active.LastNotifiedAt.Valid || now.Sub(active.LastNotifiedAt.Time) >= s.cfg.Alert.RenotifyInterval):
+		eventType = AlertEventRenotified
+	default:
+		return nil, nil
+	}
+
+	active.Danger = danger
+	active.LevelCm = waterLevel.LevelCm
+	active.MeasuredAt = waterLevel.MeasuredAt
+	active.WaterLevelID = sql.NullInt64{Int64: waterLevel.ID, Valid: waterLevel.ID != 0}
+	active.LastNotifiedAt = sql.NullTime{Time: now, Valid: true}
+
+	if err := s.repo.UpdateAlert(ctx, active, newAlertEvent(eventType, active, previous)); err != nil {
+		return nil, err
+	}
+
+	return s.transition(ctx, reading.Location, active, eventType, previous)
+}
+
+// transition announces the new alert state to the connected dashboards
+func (s *alertService) transition(ctx context.Context, location *entities.Location, alert *entities.Alert, eventType string, previous string) (*models.AlertTransition, error) {
+	res := toAlertRes(alert)
+
+	if alert.State == AlertResolved {
+		s.publish(ctx, events.TypeAlertResolved, location, res)
+	} else {
+		s.publish(ctx, events.TypeAlert, location, res)
+	}
+
+	return &models.AlertTransition{
+		Alert:          res,
+		Event:          eventType,
+		PreviousDanger: previous,
+	}, nil
+}
+
+func (s *alertService) AcknowledgeAlert(ctx context.Context, alertID int64, userID int64) (*models.AlertRes, error) {
+	alert, err := s.repo.AcknowledgeAlert(ctx, alertID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if alert == nil {
+		return nil, ErrAlertNotFound
+	}
+
+	location, err := s.waterRepo.GetLocationByID(ctx, alert.LocationID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := toAlertRes(alert)
+	s.publish(ctx, events.TypeAlertAck, location, res)
+
+	return res, nil
+}
+
+func (s *alertService) publish(ctx context.Context, eventType string, location *entities.Location, alert *models.AlertRes) {
+	if s.publisher == nil || location == nil {
+		return
+	}
+
+	if err := s.publisher.Publish(ctx, eventType, location.ID, location.Latitude, location.Longitude, alert); err != nil {
+		log.Printf("failed to publish %s event for alert %d: %v", eventType, alert.ID, err)
+	}
+}
+
+// settledDanger applies hysteresis to a reading: the alert only steps down from its current danger
+// once the level is more than margin below the threshold of that danger, so a level hovering
+// around a threshold does not flap between two states
+func settledDanger(levelCm float64, danger string, current string, threshold *entities.LocationThreshold, margin float64) string {
+	for rank := dangerRanks[current]; rank > dangerRanks[danger]; rank-- {
+		bound := thresholdForRank(rank, threshold)
+		if bound.Valid && levelCm >= bound.Float64-margin {
+			return dangerByRank[rank]
+		}
+	}
+	return danger
+}
+
+func thresholdForRank(rank int, threshold *entities.LocationThreshold) sql.NullFloat64 {
+	if threshold == nil {
+		return sql.NullFloat64{}
+	}
+
+	switch dangerByRank[rank] {
+	case DangerWatch:
+		return threshold.WarningLevelCm
+	case DangerDanger:
+		return threshold.DangerLevelCm
+	case DangerCritical:
+		return threshold.CriticalLevelCm
+	}
+	return sql.NullFloat64{}
+}
+
+func newAlertEvent(eventType string, alert *entities.Alert, previous string) *entities.AlertEvent {
+	return &entities.AlertEvent{
+		AlertID:    alert.ID,
+		LocationID: alert.LocationID,
+		Type:       eventType,
+		FromDanger: sql.NullString{String: previous, Valid: previous != ""},
+		ToDanger:   sql.NullString{String: alert.Danger, Valid: true},
+		LevelCm:    sql.NullFloat64{Float64: alert.LevelCm, Valid: true},
+		MeasuredAt: sql.NullTime{Time: alert.MeasuredAt, Valid: true},
+	}
+}
+
+func toAlertRes(alert *entities.Alert) *models.AlertRes {
+	res := &models.AlertRes{
+		ID:             alert.ID,
+		LocationID:     alert.LocationID,
+		WaterLevelID:   utils.NullInt64ToPtr(alert.WaterLevelID),
+		Danger:         alert.Danger,
+		LevelCm:        alert.LevelCm,
+		MeasuredAt:     utils.FormatTime(alert.MeasuredAt),
+		State:          alert.State,
+		AcknowledgedBy: utils.NullInt64ToPtr(alert.AcknowledgedBy),
+		CreatedAt:      utils.FormatTime(alert.CreatedAt),
+		UpdatedAt:      utils.FormatTime(alert.UpdatedAt),
+	}
+
+	if alert.AcknowledgedAt.Valid {
+		acknowledgedAt := utils.FormatTime(alert.AcknowledgedAt.Time)
+		res.AcknowledgedAt = &acknowledgedAt
+	}
+	if alert.LastNotifiedAt.Valid {
+		lastNotifiedAt := utils.FormatTime(alert.LastNotifiedAt.Time)
+		res.LastNotifiedAt = &lastNotifiedAt
+	}
+	if alert.ResolvedAt.Valid {
+		resolvedAt := utils.FormatTime(alert.ResolvedAt.Time)
+		res.ResolvedAt = &resolvedAt
+	}
+
+	return res
+}
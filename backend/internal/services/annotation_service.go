@@ -0,0 +1,297 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/utils"
+)
+
+const (
+	// DatasetVersion is the layout of dataset exports, raised when the archive changes incompatibly
+	DatasetVersion = 1
+
+	maxWaterlinePoints = 100
+)
+
+var ErrImageNotFound = errors.New("image not found")
+
+var datasetLabelsHeader = []string{"file", "location_id", "captured_at", "level_cm", "image_width", "image_height", "waterline"}
+
+type annotationService struct {
+	repo repositories.AnnotationRepositoryInterface
+	cfg  *config.Config
+}
+
+type AnnotationServiceInterface interface {
+	ListUnlabelled(ctx context.Context, locationID int64, limit int) ([]*models.AnnotationImageRes, error)
+	Annotate(ctx context.Context, req *models.AnnotationReq) (*models.AnnotationRes, error)
+	// WriteDataset writes the annotated images as a zip of images/, labels.csv and manifest.json
+	WriteDataset(ctx context.Context, locationID int64, w io.Writer) (*models.DatasetManifest, error)
+}
+
+func NewAnnotationService(repo repositories.AnnotationRepositoryInterface, cfg *config.Config) AnnotationServiceInterface {
+	return &annotationService{
+		repo: repo,
+		cfg:  cfg,
+	}
+}
+
+func (s *annotationService) ListUnlabelled(ctx context.Context, locationID int64, limit int) ([]*models.AnnotationImageRes, error) {
+	images, err := s.repo.ListUnlabelledImages(ctx, locationID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*models.AnnotationImageRes, 0, len(images))
+	for _, img := range images {
+		result = append(result, &models.AnnotationImageRes{
+			Image:      img.Image,
+			URL:        utils.BuildImageURL(s.cfg.App.BaseURL, img.Image),
+			LocationID: img.LocationID,
+			CapturedAt: utils.FormatTime(img.CapturedAt),
+		})
+	}
+
+	return result, nil
+}
+
+func (s *annotationService) Annotate(ctx context.Context, req *models.AnnotationReq) (*models.AnnotationRes, error) {
+	if err := utils.ValidateImagePath(req.Image); err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.ErrInvalidInput, err)
+	}
+	if req.LevelCm == nil || math.IsNaN(*req.LevelCm) || math.IsInf(*req.LevelCm, 0) {
+		return nil, fmt.Errorf("%w: level_cm is required", utils.ErrInvalidInput)
+	}
+	if len(req.Waterline) < 2 || len(req.Waterline) > maxWaterlinePoints {
+		return nil, fmt.Errorf("%w: waterline must have between 2 and %d points", utils.ErrInvalidInput, maxWaterlinePoints)
+	}
+
+	source, err := s.repo.GetAnnotationImage(ctx, req.Image)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, ErrImageNotFound
+	}
+
+	width, height, err := imageSize(filepath.Join(s.cfg.App.UploadDir, req.Image))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrImageNotFound
+		}
+		return nil, err
+	}
+
+	for i, point := range req.Waterline {
+		if point.X < 0 || point.Y < 0 || point.X > float64(width) || point.Y > float64(height) {
+			return nil, fmt.Errorf("%w: waterline point %d is outside the %dx%d image", utils.ErrInvalidInput, i, width, height)
+		}
+	}
+
+	waterline, err := json.Marshal(req.Waterline)
+	if err != nil {
+		return nil, err
+	}
+
+	annotation := &entities.ImageAnnotation{
+		Image:       source.Image,
+		LocationID:  source.LocationID,
+		CapturedAt:  source.CapturedAt,
+		LevelCm:     *req.LevelCm,
+		Waterline:   waterline,
+		ImageWidth:  width,
+		ImageHeight: height,
+	}
+	if req.Note != nil && strings.TrimSpace(*req.Note) != "" {
+		annotation.Note = sql.NullString{String: strings.TrimSpace(*req.Note), Valid: true}
+	}
+	if req.UserID != 0 {
+		annotation.AnnotatedBy = sql.NullInt64{Int64: req.UserID, Valid: true}
+	}
+
+	if err := s.repo.UpsertAnnotation(ctx, annotation); err != nil {
+		return nil, err
+	}
+
+	return &models.AnnotationRes{
+		ID:          annotation.ID,
+		Image:       annotation.Image,
+		URL:         utils.BuildImageURL(s.cfg.App.BaseURL, annotation.Image),
+		LocationID:  annotation.LocationID,
+		CapturedAt:  utils.FormatTime(annotation.CapturedAt),
+		LevelCm:     annotation.LevelCm,
+		Waterline:   req.Waterline,
+		ImageWidth:  annotation.ImageWidth,
+		ImageHeight: annotation.ImageHeight,
+		Note:        utils.NullStringToPtr(annotation.Note),
+		AnnotatedBy: utils.NullInt64ToPtr(annotation.AnnotatedBy),
+		UpdatedAt:   utils.FormatTime(annotation.UpdatedAt),
+	}, nil
+}
+
+// WriteDataset copies the images first, labels.csv and manifest.json then list only the images that
+// made it into the archive
+func (s *annotationService) WriteDataset(ctx context.Context, locationID int64, w io.Writer) (*models.DatasetManifest, error) {
+	annotations, err := s.repo.ListAnnotations(ctx, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &models.DatasetManifest{
+		Version:   DatasetVersion,
+		CreatedAt: utils.FormatTime(time.Now()),
+		Missing:   make([]string, 0),
+		Images:    make([]*models.DatasetImage, 0, len(annotations)),
+	}
+	if locationID != 0 {
+		manifest.LocationID = &locationID
+	}
+
+	archive := zip.NewWriter(w)
+
+	for _, annotation := range annotations {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var waterline []models.WaterlinePoint
+		if err := annotation.Waterline.Unmarshal(&waterline); err != nil {
+			return nil, err
+		}
+
+		file := "images/" + annotation.Image
+		copied, err := addFile(archive, file, filepath.Join(s.cfg.App.UploadDir, annotation.Image))
+		if err != nil {
+			return nil, err
+		}
+		if !copied {
+			log.Printf("Annotated image %s is missing from the upload directory", annotation.Image)
+			manifest.Missing = append(manifest.Missing, annotation.Image)
+			continue
+		}
+
+		manifest.Images = append(manifest.Images, &models.DatasetImage{
+			File:        file,
+			LocationID:  annotation.LocationID,
+			CapturedAt:  utils.FormatTime(annotation.CapturedAt),
+			LevelCm:     annotation.LevelCm,
+			ImageWidth:  annotation.ImageWidth,
+			ImageHeight: annotation.ImageHeight,
+			Waterline:   waterline,
+		})
+	}
+	manifest.Count = len(manifest.Images)
+
+	labels, err := archive.Create("labels.csv")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeDatasetLabels(labels, manifest); err != nil {
+		return nil, err
+	}
+
+	manifestFile, err := archive.Create("manifest.json")
+	if err != nil {
+		return nil, err
+	}
+	encoder := json.NewEncoder(manifestFile)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// writeDatasetLabels writes one row per image, the waterline is the JSON of its points
+func writeDatasetLabels(w io.Writer, manifest *models.DatasetManifest) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(datasetLabelsHeader); err != nil {
+		return err
+	}
+
+	for _, img := range manifest.Images {
+		waterline, err := json.Marshal(img.Waterline)
+		if err != nil {
+			return err
+		}
+		if err := writer.Write([]string{
+			img.File,
+			strconv.FormatInt(img.LocationID, 10),
+			img.CapturedAt,
+			strconv.FormatFloat(img.LevelCm, 'f', 2, 64),
+			strconv.Itoa(img.ImageWidth),
+			strconv.Itoa(img.ImageHeight),
+			string(waterline),
+		}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// addFile copies a file into the archive, it reports false when the file does not exist
+func addFile(archive *zip.Writer, name string, path string) (bool, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer src.Close()
+
+	// images are compressed already, storing them saves the CPU for nothing
+	dst, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func imageSize(path string) (int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	header, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: image cannot be decoded: %v", utils.ErrInvalidInput, err)
+	}
+
+	return header.Width, header.Height, nil
+}
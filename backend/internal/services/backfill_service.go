@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/utils"
+)
+
+// backfillSource marks backfilled readings, they share the telemetry key of SourceThaiWater readings
+const backfillSource = "thaiwater_history"
+
+type backfillService struct {
+	repo          repositories.WaterLevelRepositoryInterface
+	thresholdRepo repositories.ThresholdRepositoryInterface
+	cfg           *config.Config
+}
+
+type BackfillServiceInterface interface {
+	ResolveLocation(ctx context.Context, locationID int64, stationID int64) (*entities.Location, error)
+	Backfill(ctx context.Context, req *models.BackfillReq) ([]*entities.WaterLevel, *models.BackfillSummary, error)
+}
+
+func NewBackfillService(repo repositories.WaterLevelRepositoryInterface, thresholdRepo repositories.ThresholdRepositoryInterface, cfg *config.Config) BackfillServiceInterface {
+	return &backfillService{
+		repo:          repo,
+		thresholdRepo: thresholdRepo,
+		cfg:           cfg,
+	}
+}
+
+// ResolveLocation finds the location to backfill, either by its id or by its ThaiWater tele-station id
+func (s *backfillService) ResolveLocation(ctx context.Context, locationID int64, stationID int64) (*entities.Location, error) {
+	var location *entities.Location
+	var err error
+
+	if locationID > 0 {
+		location, err = s.repo.GetLocationByID(ctx, locationID)
+	} else {
+		location, err = s.repo.GetLocationByStationID(ctx, stationID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if location == nil {
+		return nil, ErrLocationNotFound
+	}
+	if !location.TeleStationID.Valid {
+		return nil, fmt.Errorf("location %d is not mapped to a ThaiWater station", location.ID)
+	}
+
+	return location, nil
+}
+
+// Backfill imports the ThaiWater history of one location between req.From (inclusive) and req.To (exclusive),
+// keeping the last reading of every req.Resolution bucket. In dry-run mode nothing is written.
+func (s *backfillService) Backfill(ctx context.Context, req *models.BackfillReq) ([]*entities.WaterLevel, *models.BackfillSummary, error) {
+	location, err := s.repo.GetLocationByID(ctx, req.LocationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if location == nil {
+		return nil, nil, ErrLocationNotFound
+	}
+
+	threshold, err := s.thresholdRepo.GetByLocationID(ctx, location.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	points, err := s.fetchHistory(location.TeleStationID.Int64, req.From, req.To)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// timestamps the cron already recorded are not gaps, leave them alone
+	existing, err := s.repo.GetMeasuredTimes(ctx, location.ID, req.From, req.To, backfillSource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	summary := &models.BackfillSummary{Fetched: len(points)}
+	readings := resampleHistory(location, points, req, threshold, existing)
+	summary.Skipped = summary.Fetched - len(readings)
+
+	if req.DryRun {
+		return readings, summary, nil
+	}
+
+	for _, reading := range readings {
+		outcome, err := s.repo.UpsertWaterLevel(ctx, reading)
+		if err != nil {
+			return readings, summary, err
+		}
+
+		switch outcome {
+		case models.ReadingNew:
+			summary.New++
+		case models.ReadingUpdated:
+			summary.Updated++
+		case models.ReadingUnchanged:
+			summary.Unchanged++
+		}
+	}
+
+	return readings, summary, nil
+}
+
+func (s *backfillService) fetchHistory(stationID int64, from time.Time, to time.Time) ([]models.ThaiWaterGraphPoint, error) {
+	apiResponse := new(models.ThaiWaterGraphResponse)
+
+	// the graph endpoint works on whole days and its end date is inclusive
+	url := fmt.Sprintf("%s/public/waterlevel_graph?station_type=tele_waterlevel&station_id=%d&start_date=%s&end_date=%s",
+		strings.TrimSuffix(s.cfg.ThaiWater.BaseURL, "/"),
+		stationID,
+		from.Format("2006-01-02"),
+		to.Add(-time.Nanosecond).Format("2006-01-02"),
+	)
+
+	if err := utils.GetJSON(url, apiResponse); err != nil {
+		return nil, err
+	}
+
+	if apiResponse.Result != "OK" {
+		return nil, fmt.Errorf("API returned non-OK result: %s", apiResponse.Result)
+	}
+
+	return apiResponse.Data.GraphData, nil
+}
+
+// resampleHistory converts graph points into readings, keeping the latest point of every resolution bucket
+func resampleHistory(location *entities.Location, points []models.ThaiWaterGraphPoint, req *models.BackfillReq, threshold *entities.LocationThreshold, existing []time.Time) []*entities.WaterLevel {
+	buckets := make(map[time.Time]*entities.WaterLevel)
+
+	recorded := make(map[int64]bool, len(existing))
+	for _, t := range existing {
+		recorded[t.Unix()] = true
+	}
+
+	for _, point := range points {
+		if point.Value == nil {
+			continue
+		}
+
+		measuredAt := utils.ConvertStringToTime(point.Datetime)
+		if measuredAt.IsZero() || measuredAt.Before(req.From) || !measuredAt.Before(req.To) || recorded[measuredAt.Unix()] {
+			continue
+		}
+
+		key := measuredAt
+		if req.Resolution > 0 {
+			// truncate on the local clock so daily buckets start at midnight in Bangkok
+			_, offset := measuredAt.Zone()
+			shift := time.Duration(offset) * time.Second
+			key = measuredAt.Add(shift).Truncate(req.Resolution).Add(-shift)
+		}
+
+		if current, ok := buckets[key]; ok && current.MeasuredAt.After(measuredAt) {
+			continue
+		}
+
+		levelCm := *point.Value * 100
+		danger, isFlooded := ClassifyWaterLevel(levelCm, threshold)
+
+		buckets[key] = &entities.WaterLevel{
+			LocationID: location.ID,
+			LevelCm:    levelCm,
+			Danger:     danger,
+			IsFlooded:  isFlooded,
+			Source:     sql.NullString{String: backfillSource, Valid: true},
+			MeasuredAt: measuredAt,
+			Note:       "backfilled from ThaiWater history",
+		}
+	}
+
+	readings := make([]*entities.WaterLevel, 0, len(buckets))
+	for _, reading := range buckets {
+		readings = append(readings, reading)
+	}
+	sort.Slice(readings, func(i, j int) bool {
+		return readings[i].MeasuredAt.Before(readings[j].MeasuredAt)
+	})
+
+	if len(readings) == 0 {
+		log.Printf("no history for location %d between %s and %s", location.ID, utils.FormatTime(req.From), utils.FormatTime(req.To))
+	}
+
+	return readings
+}
@@ -0,0 +1,402 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/predictor"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/utils"
+)
+
+const (
+	defaultBatchMaxGap      = 30 * time.Minute
+	defaultBatchConcurrency = 4
+	maxBatchConcurrency     = 16
+	batchPredictTimeout     = 60 * time.Second
+)
+
+// BatchReportPrefix starts the names of the reports written by batch prediction jobs
+const BatchReportPrefix = "predict_batch_"
+
+var ErrBatchReportNotFound = errors.New("batch prediction report not found")
+
+var batchReportHeader = []string{"file", "location_id", "captured_at", "predicted_cm", "telemetered_cm", "telemetered_at", "gap_seconds", "error_cm", "error"}
+
+type batchPredictionService struct {
+	waterRepo repositories.WaterLevelRepositoryInterface
+	predictor predictor.Predictor
+	cfg       *config.Config
+}
+
+type BatchPredictionServiceInterface interface {
+	// PredictBatch predicts every snapshot under req.Dir and writes one CSV row per snapshot to w
+	PredictBatch(ctx context.Context, req *models.BatchPredictionReq, w io.Writer) (*models.BatchPredictionReport, error)
+	// RunBatchJob predicts a directory of the upload directory and writes <name>.csv and
+	// <name>_summary.csv to the export directory
+	RunBatchJob(ctx context.Context, req *models.BatchPredictionJobReq, name string) (*models.BatchPredictionReport, error)
+	// NewBatchJob validates a job request and names its reports
+	NewBatchJob(req *models.BatchPredictionJobReq) (*models.BatchPredictionJobRes, error)
+	// GetBatchReport returns the path of a report written by a job
+	GetBatchReport(fileName string) (string, error)
+}
+
+func NewBatchPredictionService(waterRepo repositories.WaterLevelRepositoryInterface, predictor predictor.Predictor, cfg *config.Config) BatchPredictionServiceInterface {
+	return &batchPredictionService{
+		waterRepo: waterRepo,
+		predictor: predictor,
+		cfg:       cfg,
+	}
+}
+
+// resolveBatchDir resolves a directory relative to the upload directory, an empty dir is the upload
+// directory itself
+func (s *batchPredictionService) resolveBatchDir(dir string) (string, error) {
+	if dir != "" && !filepath.IsLocal(dir) {
+		return "", fmt.Errorf("%w: dir must be relative to the upload directory", utils.ErrInvalidInput)
+	}
+
+	path := filepath.Join(s.cfg.App.UploadDir, dir)
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%w: %s is not a directory", utils.ErrInvalidInput, dir)
+	}
+
+	return path, nil
+}
+
+func (s *batchPredictionService) NewBatchJob(req *models.BatchPredictionJobReq) (*models.BatchPredictionJobRes, error) {
+	if _, err := s.resolveBatchDir(req.Dir); err != nil {
+		return nil, err
+	}
+	if req.LocationID < 0 {
+		return nil, fmt.Errorf("%w: location_id must be positive", utils.ErrInvalidInput)
+	}
+	if req.MaxGapMinutes < 0 || req.MaxGapMinutes > 24*60 {
+		return nil, fmt.Errorf("%w: max_gap_minutes must be between 0 and 1440", utils.ErrInvalidInput)
+	}
+	if req.Concurrency < 0 || req.Concurrency > maxBatchConcurrency {
+		return nil, fmt.Errorf("%w: concurrency must be between 0 and %d", utils.ErrInvalidInput, maxBatchConcurrency)
+	}
+
+	// the name is also the task id, the random part keeps two jobs requested in the same second apart
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	now := time.Now()
+	name := BatchReportPrefix + now.Format("20060102_150405") + "_" + hex.EncodeToString(suffix)
+
+	return &models.BatchPredictionJobRes{
+		Name:        name,
+		Report:      name + ".csv",
+		Summary:     name + "_summary.csv",
+		ReportURL:   fmt.Sprintf("%s/admin/predictions/batch/%s.csv", s.cfg.App.BaseURL, name),
+		SummaryURL:  fmt.Sprintf("%s/admin/predictions/batch/%s_summary.csv", s.cfg.App.BaseURL, name),
+		RequestedAt: utils.FormatTime(now),
+	}, nil
+}
+
+func (s *batchPredictionService) GetBatchReport(fileName string) (string, error) {
+	if err := utils.ValidateImagePath(fileName); err != nil || !strings.HasPrefix(fileName, BatchReportPrefix) || filepath.Ext(fileName) != ".csv" {
+		return "", ErrBatchReportNotFound
+	}
+
+	path := filepath.Join(s.cfg.Export.Dir, fileName)
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrBatchReportNotFound
+	}
+
+	return path, nil
+}
+
+func (s *batchPredictionService) RunBatchJob(ctx context.Context, req *models.BatchPredictionJobReq, name string) (*models.BatchPredictionReport, error) {
+	dir, err := s.resolveBatchDir(req.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(s.cfg.Export.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	// written through temporary files, a report that exists is complete
+	reportPath := filepath.Join(s.cfg.Export.Dir, name+".csv")
+	f, err := os.Create(reportPath + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(reportPath + ".tmp")
+	defer f.Close()
+
+	report, err := s.PredictBatch(ctx, &models.BatchPredictionReq{
+		Dir:         dir,
+		LocationID:  req.LocationID,
+		TimeZone:    s.cfg.Predictor.BatchTimeZone,
+		MaxGap:      time.Duration(req.MaxGapMinutes) * time.Minute,
+		Concurrency: req.Concurrency,
+	}, f)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	summaryPath := filepath.Join(s.cfg.Export.Dir, name+"_summary.csv")
+	summary, err := os.Create(summaryPath + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(summaryPath + ".tmp")
+	defer summary.Close()
+
+	if err := WriteBatchSummary(summary, report); err != nil {
+		return nil, err
+	}
+	if err := summary.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(reportPath+".tmp", reportPath); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(summaryPath+".tmp", summaryPath); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func (s *batchPredictionService) PredictBatch(ctx context.Context, req *models.BatchPredictionReq, w io.Writer) (*models.BatchPredictionReport, error) {
+	maxGap := req.MaxGap
+	if maxGap <= 0 {
+		maxGap = defaultBatchMaxGap
+	}
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+	concurrency = min(concurrency, maxBatchConcurrency)
+	loc := req.TimeZone
+	if loc == nil {
+		loc = s.cfg.Predictor.BatchTimeZone
+	}
+
+	files, err := listSnapshots(req.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.BatchPredictionReport{}
+	rows := make([]*models.BatchPredictionRow, 0, len(files))
+	for _, file := range files {
+		locationID, capturedAt, err := utils.ParseImageName(file, loc)
+		if err == nil && locationID == 0 {
+			locationID = req.LocationID
+		}
+		if err != nil || locationID == 0 {
+			report.Skipped++
+			continue
+		}
+
+		rel, err := filepath.Rel(req.Dir, file)
+		if err != nil {
+			rel = file
+		}
+		rows = append(rows, &models.BatchPredictionRow{
+			File:       rel,
+			LocationID: locationID,
+			CapturedAt: capturedAt,
+		})
+	}
+	report.Images = len(rows)
+
+	log.Printf("Predicting %d snapshots of %s, %d skipped", len(rows), req.Dir, report.Skipped)
+
+	jobs := make(chan *models.BatchPredictionRow)
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for row := range jobs {
+				s.predictRow(ctx, req.Dir, row, maxGap)
+			}
+		}()
+	}
+
+	for _, row := range rows {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- row
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(batchReportHeader); err != nil {
+		return nil, err
+	}
+
+	stats := make(map[int64]*models.BatchPredictionLocationStats)
+	sums := make(map[int64]*[2]float64) // absolute and squared errors
+	for _, row := range rows {
+		stat, ok := stats[row.LocationID]
+		if !ok {
+			stat = &models.BatchPredictionLocationStats{LocationID: row.LocationID}
+			stats[row.LocationID] = stat
+			sums[row.LocationID] = new([2]float64)
+		}
+		stat.Images++
+
+		if row.Error != "" {
+			report.Failed++
+		}
+		if row.PredictedCm != nil && row.TelemeteredCm != nil {
+			diff := *row.PredictedCm - *row.TelemeteredCm
+			stat.Compared++
+			sums[row.LocationID][0] += math.Abs(diff)
+			sums[row.LocationID][1] += diff * diff
+		}
+
+		if err := writer.Write(batchReportRecord(row)); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+
+	report.Locations = make([]*models.BatchPredictionLocationStats, 0, len(stats))
+	for locationID, stat := range stats {
+		if stat.Compared > 0 {
+			stat.MAE = sums[locationID][0] / float64(stat.Compared)
+			stat.RMSE = math.Sqrt(sums[locationID][1] / float64(stat.Compared))
+		}
+		report.Compared += stat.Compared
+		report.Locations = append(report.Locations, stat)
+	}
+	sort.Slice(report.Locations, func(i, j int) bool {
+		return report.Locations[i].LocationID < report.Locations[j].LocationID
+	})
+
+	return report, nil
+}
+
+// predictRow fills the prediction and the nearest telemetered reading of a row, failures are kept
+// in the row so one bad snapshot does not stop the batch
+func (s *batchPredictionService) predictRow(ctx context.Context, dir string, row *models.BatchPredictionRow, maxGap time.Duration) {
+	predictCtx, cancel := context.WithTimeout(ctx, batchPredictTimeout)
+	levelCm, err := s.predictor.Predict(predictCtx, filepath.Join(dir, row.File))
+	cancel()
+	if err != nil {
+		row.Error = err.Error()
+		return
+	}
+	row.PredictedCm = &levelCm
+
+	nearest, err := s.waterRepo.GetNearestReading(ctx, row.LocationID, row.CapturedAt, maxGap, SourceCamera)
+	if err != nil {
+		row.Error = err.Error()
+		return
+	}
+	if nearest != nil {
+		row.TelemeteredCm = &nearest.LevelCm
+		row.TelemeteredAt = &nearest.MeasuredAt
+	}
+}
+
+func batchReportRecord(row *models.BatchPredictionRow) []string {
+	record := []string{
+		row.File,
+		strconv.FormatInt(row.LocationID, 10),
+		utils.FormatTime(row.CapturedAt),
+		"", "", "", "", "",
+		row.Error,
+	}
+	if row.PredictedCm != nil {
+		record[3] = strconv.FormatFloat(*row.PredictedCm, 'f', 2, 64)
+	}
+	if row.TelemeteredCm != nil {
+		record[4] = strconv.FormatFloat(*row.TelemeteredCm, 'f', 2, 64)
+		record[5] = utils.FormatTime(*row.TelemeteredAt)
+		record[6] = strconv.FormatFloat(row.TelemeteredAt.Sub(row.CapturedAt).Seconds(), 'f', 0, 64)
+	}
+	if row.PredictedCm != nil && row.TelemeteredCm != nil {
+		record[7] = strconv.FormatFloat(*row.PredictedCm-*row.TelemeteredCm, 'f', 2, 64)
+	}
+	return record
+}
+
+// WriteBatchSummary writes the error of the predictions of each location as CSV
+func WriteBatchSummary(w io.Writer, report *models.BatchPredictionReport) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"location_id", "images", "compared", "mae_cm", "rmse_cm"}); err != nil {
+		return err
+	}
+
+	for _, stat := range report.Locations {
+		record := []string{
+			strconv.FormatInt(stat.LocationID, 10),
+			strconv.Itoa(stat.Images),
+			strconv.Itoa(stat.Compared),
+			"", "",
+		}
+		if stat.Compared > 0 {
+			record[3] = strconv.FormatFloat(stat.MAE, 'f', 3, 64)
+			record[4] = strconv.FormatFloat(stat.RMSE, 'f', 3, 64)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// listSnapshots returns the images under dir, sorted
+func listSnapshots(dir string) ([]string, error) {
+	files := make([]string, 0)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".png", ".jpg", ".jpeg":
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/utils"
+)
+
+// Digest periods, also the values of user_subscriptions.digest
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+var digestPeriods = map[string]time.Duration{
+	DigestDaily:  24 * time.Hour,
+	DigestWeekly: 7 * 24 * time.Hour,
+}
+
+var digestFuncs = map[string]any{
+	"cm": func(value *float64) string {
+		if value == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%.2f cm", *value)
+	},
+	"str": func(value *string) string {
+		if value == nil {
+			return "-"
+		}
+		return *value
+	},
+	// when shows an RFC3339 time in Asia/Bangkok
+	"when": func(value *string) string {
+		if value == nil {
+			return "-"
+		}
+		t, err := utils.ParseTime(*value)
+		if err != nil {
+			return *value
+		}
+		return utils.ParseTimeToString(t)
+	},
+	"hours": func(hours []*models.DangerHoursRes) string {
+		parts := make([]string, 0, len(hours))
+		for _, h := range hours {
+			if h.Hours > 0 {
+				parts = append(parts, fmt.Sprintf("%s %.1fh", h.Danger, h.Hours))
+			}
+		}
+		if len(parts) == 0 {
+			return "no readings"
+		}
+		return strings.Join(parts, ", ")
+	},
+}
+
+// digestText leaves the title out, chat channels put it above the text and email uses it as the subject
+const digestText = `{{.From}} - {{.To}}
+{{range .Locations}}
+{{.Name}}
+  Current: {{cm .CurrentCm}} ({{str .CurrentDanger}}) at {{when .LastMeasuredAt}}
+  Min/Max: {{cm .MinCm}} / {{cm .MaxCm}}, {{.Readings}} readings
+  Time by danger: {{hours .DangerHours}}
+{{end}}{{if .Stale}}
+Stale stations, no reading for over {{.StaleAfter}}:
+{{range .Stale}}- {{.Name}}, last reading {{when .LastMeasuredAt}}
+{{end}}{{end}}`
+
+const digestHTML = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h2>{{.Title}}</h2>
+<p>{{.From}} - {{.To}}</p>
+<table border="1" cellpadding="6" cellspacing="0" style="border-collapse: collapse">
+<tr><th>Location</th><th>Current</th><th>Danger</th><th>Min</th><th>Max</th><th>Time by danger</th></tr>
+{{range .Locations}}<tr>
+<td>{{.Name}}</td><td>{{cm .CurrentCm}}</td><td>{{str .CurrentDanger}}</td><td>{{cm .MinCm}}</td><td>{{cm .MaxCm}}</td><td>{{hours .DangerHours}}</td>
+</tr>
+{{end}}</table>
+{{if .Stale}}<h3>Stale stations</h3>
+<p>No reading for over {{.StaleAfter}}.</p>
+<ul>
+{{range .Stale}}<li>{{.Name}}, last reading {{when .LastMeasuredAt}}</li>
+{{end}}</ul>
+{{end}}</body>
+</html>
+`
+
+var (
+	digestTextTemplate = texttemplate.Must(texttemplate.New("digest").Funcs(digestFuncs).Parse(digestText))
+	digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest").Funcs(digestFuncs).Parse(digestHTML))
+)
+
+type digestService struct {
+	subscriptionRepo repositories.SubscriptionRepositoryInterface
+	waterRepo        repositories.WaterLevelRepositoryInterface
+	cfg              *config.Config
+}
+
+type DigestServiceInterface interface {
+	// BuildDigests renders the digest of every subscription that opted in to the period, for the period ending at now
+	BuildDigests(ctx context.Context, period string, now time.Time) ([]*models.DigestMessage, error)
+}
+
+func NewDigestService(subscriptionRepo repositories.SubscriptionRepositoryInterface, waterRepo repositories.WaterLevelRepositoryInterface, cfg *config.Config) DigestServiceInterface {
+	return &digestService{
+		subscriptionRepo: subscriptionRepo,
+		waterRepo:        waterRepo,
+		cfg:              cfg,
+	}
+}
+
+func (s *digestService) BuildDigests(ctx context.Context, period string, now time.Time) ([]*models.DigestMessage, error) {
+	length, ok := digestPeriods[period]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown digest period %q", utils.ErrInvalidInput, period)
+	}
+
+	followed, err := s.subscriptionRepo.ListDigestLocations(ctx, period)
+	if err != nil {
+		return nil, err
+	}
+	if len(followed) == 0 {
+		return []*models.DigestMessage{}, nil
+	}
+
+	// every location is summarised once, however many subscriptions follow it
+	seen := make(map[int64]bool)
+	locationIDs := make([]int64, 0)
+	for _, f := range followed {
+		if !seen[f.LocationID] {
+			seen[f.LocationID] = true
+			locationIDs = append(locationIDs, f.LocationID)
+		}
+	}
+
+	from := now.Add(-length)
+	stats, err := s.waterRepo.GetDigestStats(ctx, locationIDs, from, now, s.cfg.Digest.StaleAfter, SourceCamera)
+	if err != nil {
+		return nil, err
+	}
+
+	locations := make(map[int64]*models.DigestLocationRes, len(stats))
+	for _, stat := range stats {
+		locations[stat.LocationID] = s.toDigestLocationRes(stat, now)
+	}
+
+	digests := make(map[int64]*models.DigestRes)
+	order := make([]int64, 0)
+	for _, f := range followed {
+		location, ok := locations[f.LocationID]
+		if !ok {
+			continue
+		}
+
+		digest, ok := digests[f.SubscriptionID]
+		if !ok {
+			digest = &models.DigestRes{
+				Period:    period,
+				From:      utils.FormatTime(from),
+				To:        utils.FormatTime(now),
+				Locations: make([]*models.DigestLocationRes, 0),
+			}
+			digests[f.SubscriptionID] = digest
+			order = append(order, f.SubscriptionID)
+		}
+		digest.Locations = append(digest.Locations, location)
+	}
+
+	result := make([]*models.DigestMessage, 0, len(order))
+	for _, subscriptionID := range order {
+		digest := digests[subscriptionID]
+		sort.SliceStable(digest.Locations, func(i, j int) bool { return digest.Locations[i].Name < digest.Locations[j].Name })
+
+		message, err := s.render(subscriptionID, digest, from, now)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, message)
+	}
+
+	return result, nil
+}
+
+// render writes the plain text and HTML versions of a digest, times are shown in Asia/Bangkok
+func (s *digestService) render(subscriptionID int64, digest *models.DigestRes, from time.Time, to time.Time) (*models.DigestMessage, error) {
+	loc, err := time.LoadLocation("Asia/Bangkok")
+	if err != nil {
+		loc = time.FixedZone("ICT", 7*60*60)
+	}
+
+	title := "Daily water level digest"
+	if digest.Period == DigestWeekly {
+		title = "Weekly water level digest"
+	}
+	title += " " + to.In(loc).Format("02/01/2006")
+
+	stale := make([]*models.DigestLocationRes, 0)
+	for _, location := range digest.Locations {
+		if location.Stale {
+			stale = append(stale, location)
+		}
+	}
+
+	data := map[string]any{
+		"Title":      title,
+		"From":       utils.ParseTimeToString(from),
+		"To":         utils.ParseTimeToString(to),
+		"Locations":  digest.Locations,
+		"Stale":      stale,
+		"StaleAfter": s.cfg.Digest.StaleAfter.String(),
+	}
+
+	var text, html strings.Builder
+	if err := digestTextTemplate.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("failed to render digest: %w", err)
+	}
+	if err := digestHTMLTemplate.Execute(&html, data); err != nil {
+		return nil, fmt.Errorf("failed to render digest: %w", err)
+	}
+
+	return &models.DigestMessage{
+		SubscriptionID: subscriptionID,
+		Title:          title,
+		Text:           text.String(),
+		HTML:           html.String(),
+		Digest:         digest,
+	}, nil
+}
+
+func (s *digestService) toDigestLocationRes(stat *entities.LocationDigest, now time.Time) *models.DigestLocationRes {
+	res := &models.DigestLocationRes{
+		LocationID:    stat.LocationID,
+		Name:          stat.Name,
+		Readings:      stat.Readings,
+		MinCm:         utils.NullFloat64ToPtr(stat.MinCm),
+		MaxCm:         utils.NullFloat64ToPtr(stat.MaxCm),
+		CurrentCm:     utils.NullFloat64ToPtr(stat.CurrentCm),
+		CurrentDanger: utils.NullStringToPtr(stat.CurrentDanger),
+		Stale:         !stat.LastMeasuredAt.Valid || now.Sub(stat.LastMeasuredAt.Time) > s.cfg.Digest.StaleAfter,
+		DangerHours: []*models.DangerHoursRes{
+			{Danger: DangerSafe, Hours: stat.SafeSeconds / 3600},
+			{Danger: DangerWatch, Hours: stat.WatchSeconds / 3600},
+			{Danger: DangerDanger, Hours: stat.DangerSeconds / 3600},
+			{Danger: DangerCritical, Hours: stat.CriticalSeconds / 3600},
+		},
+	}
+
+	if stat.LastMeasuredAt.Valid {
+		lastMeasuredAt := utils.FormatTime(stat.LastMeasuredAt.Time)
+		res.LastMeasuredAt = &lastMeasuredAt
+	}
+
+	return res
+}
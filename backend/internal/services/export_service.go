@@ -0,0 +1,371 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/utils"
+	"github.com/lib/pq"
+)
+
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+)
+
+// Values of readings_exports.status
+const (
+	ExportPending = "PENDING"
+	ExportRunning = "RUNNING"
+	ExportDone    = "DONE"
+	ExportFailed  = "FAILED"
+)
+
+var (
+	ErrExportNotFound = errors.New("export not found")
+	ErrExportNotReady = errors.New("export is not ready")
+)
+
+type exportColumn struct {
+	value func(row *entities.ExportRow) any
+}
+
+// exportColumns are the columns a caller may pick with columns=, timestamps are written in Asia/Bangkok
+var exportColumns = map[string]exportColumn{
+	"reading_id":     {func(row *entities.ExportRow) any { return row.ReadingID }},
+	"location_id":    {func(row *entities.ExportRow) any { return row.LocationID }},
+	"location_name":  {func(row *entities.ExportRow) any { return row.LocationName }},
+	"province_code":  {func(row *entities.ExportRow) any { return nullString(row.ProvinceCode) }},
+	"latitude":       {func(row *entities.ExportRow) any { return row.Latitude }},
+	"longitude":      {func(row *entities.ExportRow) any { return row.Longitude }},
+	"bank_level":     {func(row *entities.ExportRow) any { return nullFloat(row.BankLevel) }},
+	"measured_at":    {func(row *entities.ExportRow) any { return row.MeasuredAt }},
+	"level_cm":       {func(row *entities.ExportRow) any { return row.LevelCm }},
+	"danger":         {func(row *entities.ExportRow) any { return row.Danger }},
+	"is_flooded":     {func(row *entities.ExportRow) any { return row.IsFlooded }},
+	"source":         {func(row *entities.ExportRow) any { return nullString(row.Source) }},
+	"situation_text": {func(row *entities.ExportRow) any { return nullString(row.SituationText) }},
+	"note":           {func(row *entities.ExportRow) any { return nullString(row.Note) }},
+}
+
+var DefaultExportColumns = []string{"location_id", "location_name", "measured_at", "level_cm", "danger", "is_flooded", "source"}
+
+type exportService struct {
+	repo repositories.ExportRepositoryInterface
+	cfg  *config.Config
+}
+
+type ExportServiceInterface interface {
+	// IsLargeExport reports whether the export has too many rows to stream in a request
+	IsLargeExport(ctx context.Context, query *models.ExportQuery) (bool, error)
+	WriteReadings(ctx context.Context, w io.Writer, query *models.ExportQuery) (int64, error)
+	CreateExport(ctx context.Context, query *models.ExportQuery) (*models.ExportRes, error)
+	RunExport(ctx context.Context, id int64) error
+	// GetExport and GetExportFile report the exports of other users as missing, unless admin is set
+	GetExport(ctx context.Context, id int64, userID int64, admin bool) (*models.ExportRes, error)
+	GetExportFile(ctx context.Context, id int64, userID int64, admin bool) (string, string, error)
+}
+
+func NewExportService(repo repositories.ExportRepositoryInterface, cfg *config.Config) ExportServiceInterface {
+	return &exportService{
+		repo: repo,
+		cfg:  cfg,
+	}
+}
+
+// ParseExportColumns validates a comma separated column list, an empty list gives the default columns
+func ParseExportColumns(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return DefaultExportColumns, nil
+	}
+
+	columns := make([]string, 0)
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := exportColumns[name]; !ok {
+			return nil, fmt.Errorf("%w: unknown column %q", utils.ErrInvalidInput, name)
+		}
+		columns = append(columns, name)
+	}
+
+	return columns, nil
+}
+
+func (s *exportService) IsLargeExport(ctx context.Context, query *models.ExportQuery) (bool, error) {
+	count, err := s.repo.CountReadings(ctx, toExportFilter(query))
+	if err != nil {
+		return false, err
+	}
+
+	return count > s.cfg.Export.AsyncRowThreshold, nil
+}
+
+// WriteReadings streams the readings to w in the requested format and returns the number of rows written
+func (s *exportService) WriteReadings(ctx context.Context, w io.Writer, query *models.ExportQuery) (int64, error) {
+	header := make([]any, len(query.Columns))
+	for i, name := range query.Columns {
+		header[i] = name
+	}
+
+	var (
+		writeRow func(values []any) error
+		finish   func() error
+	)
+
+	switch query.Format {
+	case ExportFormatCSV:
+		cw := csv.NewWriter(w)
+		record := make([]string, len(query.Columns))
+		writeRow = func(values []any) error {
+			for i, value := range values {
+				record[i] = csvValue(value)
+			}
+			return cw.Write(record)
+		}
+		finish = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case ExportFormatXLSX:
+		xw, err := utils.NewXLSXWriter(w, "readings")
+		if err != nil {
+			return 0, err
+		}
+		writeRow = xw.WriteRow
+		finish = xw.Close
+	default:
+		return 0, fmt.Errorf("%w: format must be csv or xlsx", utils.ErrInvalidInput)
+	}
+
+	if err := writeRow(header); err != nil {
+		return 0, err
+	}
+
+	var rows int64
+	values := make([]any, len(query.Columns))
+	err := s.repo.StreamReadings(ctx, toExportFilter(query), func(row *entities.ExportRow) error {
+		for i, name := range query.Columns {
+			values[i] = exportColumns[name].value(row)
+		}
+		rows++
+		return writeRow(values)
+	})
+	if err != nil {
+		return rows, err
+	}
+
+	return rows, finish()
+}
+
+func (s *exportService) CreateExport(ctx context.Context, query *models.ExportQuery) (*models.ExportRes, error) {
+	export := &entities.ReadingsExport{
+		Format:       query.Format,
+		LocationIDs:  pq.Int64Array(query.LocationIDs),
+		ProvinceCode: sql.NullString{String: query.ProvinceCode, Valid: query.ProvinceCode != ""},
+		FromTime:     query.From,
+		ToTime:       query.To,
+		Columns:      pq.StringArray(query.Columns),
+		RequestedBy:  sql.NullInt64{Int64: query.UserID, Valid: query.UserID != 0},
+	}
+
+	if err := s.repo.CreateExport(ctx, export); err != nil {
+		return nil, err
+	}
+
+	return s.toExportRes(export), nil
+}
+
+// RunExport writes the export file on the worker. The file is written under a temporary name and
+// renamed once complete, so a download never sees a partial file.
+func (s *exportService) RunExport(ctx context.Context, id int64) error {
+	export, err := s.repo.GetExport(ctx, id)
+	if err != nil {
+		return err
+	}
+	if export == nil {
+		return ErrExportNotFound
+	}
+	if export.Status == ExportDone {
+		return nil
+	}
+
+	if err := s.repo.MarkExportRunning(ctx, id); err != nil {
+		return err
+	}
+
+	rows, fileName, err := s.writeExportFile(ctx, export)
+	if err != nil {
+		if failErr := s.repo.FailExport(context.Background(), id, err.Error()); failErr != nil {
+			return failErr
+		}
+		return err
+	}
+
+	return s.repo.FinishExport(ctx, id, fileName, rows)
+}
+
+func (s *exportService) writeExportFile(ctx context.Context, export *entities.ReadingsExport) (int64, string, error) {
+	if err := os.MkdirAll(s.cfg.Export.Dir, 0o755); err != nil {
+		return 0, "", err
+	}
+
+	fileName := fmt.Sprintf("readings_%d.%s", export.ID, export.Format)
+	path := filepath.Join(s.cfg.Export.Dir, fileName)
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(tmp)
+
+	rows, err := s.WriteReadings(ctx, f, &models.ExportQuery{
+		LocationIDs:  export.LocationIDs,
+		ProvinceCode: export.ProvinceCode.String,
+		From:         export.FromTime,
+		To:           export.ToTime,
+		Format:       export.Format,
+		Columns:      export.Columns,
+	})
+	if err != nil {
+		f.Close()
+		return 0, "", err
+	}
+	if err := f.Close(); err != nil {
+		return 0, "", err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, "", err
+	}
+
+	return rows, fileName, nil
+}
+
+func (s *exportService) GetExport(ctx context.Context, id int64, userID int64, admin bool) (*models.ExportRes, error) {
+	export, err := s.repo.GetExport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if export == nil || !canSeeExport(export, userID, admin) {
+		return nil, ErrExportNotFound
+	}
+
+	return s.toExportRes(export), nil
+}
+
+// GetExportFile returns the path of a finished export file and the name to download it as
+func (s *exportService) GetExportFile(ctx context.Context, id int64, userID int64, admin bool) (string, string, error) {
+	export, err := s.repo.GetExport(ctx, id)
+	if err != nil {
+		return "", "", err
+	}
+	if export == nil || !canSeeExport(export, userID, admin) {
+		return "", "", ErrExportNotFound
+	}
+	if export.Status != ExportDone || !export.FileName.Valid {
+		return "", "", ErrExportNotReady
+	}
+
+	downloadName := fmt.Sprintf("readings_%s_%s.%s",
+		export.FromTime.In(bangkok()).Format("20060102"),
+		export.ToTime.In(bangkok()).Format("20060102"),
+		export.Format,
+	)
+
+	return filepath.Join(s.cfg.Export.Dir, export.FileName.String), downloadName, nil
+}
+
+// canSeeExport reports whether a user may see an export, ids are sequential so the exports of
+// other users are hidden rather than forbidden
+func canSeeExport(export *entities.ReadingsExport, userID int64, admin bool) bool {
+	return admin || (export.RequestedBy.Valid && export.RequestedBy.Int64 == userID)
+}
+
+func (s *exportService) toExportRes(export *entities.ReadingsExport) *models.ExportRes {
+	res := &models.ExportRes{
+		ID:           export.ID,
+		Status:       export.Status,
+		Format:       export.Format,
+		LocationIDs:  export.LocationIDs,
+		ProvinceCode: utils.NullStringToPtr(export.ProvinceCode),
+		From:         utils.ParseTimeToString(export.FromTime),
+		To:           utils.ParseTimeToString(export.ToTime),
+		Columns:      export.Columns,
+		RowCount:     utils.NullInt64ToPtr(export.RowCount),
+		Error:        utils.NullStringToPtr(export.Error),
+		CreatedAt:    utils.ParseTimeToString(export.CreatedAt),
+	}
+
+	if export.FinishedAt.Valid {
+		res.FinishedAt = utils.ParseTimeToString(export.FinishedAt.Time)
+	}
+	if export.Status == ExportDone {
+		res.DownloadURL = fmt.Sprintf("%s/exports/%d/download", s.cfg.App.BaseURL, export.ID)
+	}
+
+	return res
+}
+
+func toExportFilter(query *models.ExportQuery) *repositories.ExportFilter {
+	return &repositories.ExportFilter{
+		LocationIDs:  query.LocationIDs,
+		ProvinceCode: query.ProvinceCode,
+		From:         query.From,
+		To:           query.To,
+	}
+}
+
+func csvValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return utils.ParseTimeToString(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func nullString(value sql.NullString) any {
+	if !value.Valid {
+		return nil
+	}
+	return value.String
+}
+
+func nullFloat(value sql.NullFloat64) any {
+	if !value.Valid {
+		return nil
+	}
+	return value.Float64
+}
+
+func bangkok() *time.Location {
+	loc, err := time.LoadLocation("Asia/Bangkok")
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/forecast"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/utils"
+)
+
+const (
+	DefaultForecastHours = 6
+	MaxForecastHours     = 48
+
+	// the model is fitted on the last day of readings, resampled to half hours
+	forecastHistory = 24 * time.Hour
+	forecastStep    = 30 * time.Minute
+
+	// a station whose last reading is older than this is not forecast, its predictions would lie in the past
+	forecastMaxAge = 4 * forecastStep
+)
+
+type forecastService struct {
+	repo repositories.WaterLevelRepositoryInterface
+}
+
+type ForecastServiceInterface interface {
+	// GetForecast predicts the level of a location for the next hours and when it reaches its bank level.
+	// It fails with forecast.ErrNotEnoughData when the location has too few recent readings.
+	GetForecast(ctx context.Context, locationID int64, hours int) (*models.ForecastRes, error)
+}
+
+func NewForecastService(repo repositories.WaterLevelRepositoryInterface) ForecastServiceInterface {
+	return &forecastService{
+		repo: repo,
+	}
+}
+
+func (s *forecastService) GetForecast(ctx context.Context, locationID int64, hours int) (*models.ForecastRes, error) {
+	if hours < 1 || hours > MaxForecastHours {
+		return nil, fmt.Errorf("%w: hours must be between 1 and %d", utils.ErrInvalidInput, MaxForecastHours)
+	}
+
+	location, err := s.repo.GetLocationByID(ctx, locationID)
+	if err != nil {
+		return nil, err
+	}
+	if location == nil {
+		return nil, ErrLocationNotFound
+	}
+
+	now := time.Now()
+	series, err := s.repo.GetSeries(ctx, locationID, now.Add(-forecastHistory), now.Add(time.Minute), SourceCamera)
+	if err != nil {
+		return nil, err
+	}
+	if len(series) == 0 || now.Sub(series[len(series)-1].MeasuredAt) > forecastMaxAge {
+		return nil, forecast.ErrNotEnoughData
+	}
+
+	points := make([]forecast.Point, 0, len(series))
+	for _, p := range series {
+		points = append(points, forecast.Point{Time: p.MeasuredAt, Value: p.LevelCm})
+	}
+
+	model, err := forecast.Fit(points, forecastStep)
+	if err != nil {
+		return nil, err
+	}
+	predictions := model.Predict(time.Duration(hours) * time.Hour)
+
+	last := series[len(series)-1]
+	result := &models.ForecastRes{
+		LocationID:     locationID,
+		Method:         "holt",
+		StepMinutes:    int(forecastStep / time.Minute),
+		GeneratedAt:    utils.FormatTime(now),
+		LastMeasuredAt: utils.FormatTime(last.MeasuredAt),
+		LastLevelCm:    last.LevelCm,
+		Points:         make([]*models.ForecastPointRes, 0, len(predictions)),
+	}
+
+	for _, p := range predictions {
+		result.Points = append(result.Points, &models.ForecastPointRes{
+			Time:    utils.FormatTime(p.Time),
+			LevelCm: roundCm(p.Value),
+			LowerCm: roundCm(p.Lower),
+			UpperCm: roundCm(p.Upper),
+		})
+	}
+
+	// bank_level is in meters above MSL like the readings
+	if location.BankLevel.Valid {
+		bankLevelCm := location.BankLevel.Float64 * 100
+		result.BankLevelCm = &bankLevelCm
+
+		from := forecast.Point{Time: last.MeasuredAt, Value: last.LevelCm}
+		if at, ok := forecast.TimeToReach(from, predictions, bankLevelCm, forecast.Central); ok {
+			formatted := utils.FormatTime(at)
+			hoursTo := math.Round(math.Max(at.Sub(now).Hours(), 0)*100) / 100
+			result.BankLevelAt = &formatted
+			result.HoursToBankLevel = &hoursTo
+		}
+		if at, ok := forecast.TimeToReach(from, predictions, bankLevelCm, forecast.Upper); ok {
+			formatted := utils.FormatTime(at)
+			result.EarliestBankLevelAt = &formatted
+		}
+	}
+
+	return result, nil
+}
+
+func roundCm(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/utils"
+)
+
+var ErrReadingNotFound = errors.New("reading not found")
+
+var ErrImageNotOwner = errors.New("reading image was uploaded by another user")
+
+type imageService struct {
+	repo      repositories.ImageRepositoryInterface
+	waterRepo repositories.WaterLevelRepositoryInterface
+	cfg       *config.Config
+}
+
+type ImageServiceInterface interface {
+	// UploadImage stores an image of a location and attaches it to a reading, or queues it as a pending reading
+	UploadImage(ctx context.Context, req *models.ImageUploadReq, file io.Reader) (*models.ImageUploadRes, error)
+}
+
+func NewImageService(repo repositories.ImageRepositoryInterface, waterRepo repositories.WaterLevelRepositoryInterface, cfg *config.Config) ImageServiceInterface {
+	return &imageService{
+		repo:      repo,
+		waterRepo: waterRepo,
+		cfg:       cfg,
+	}
+}
+
+func (s *imageService) UploadImage(ctx context.Context, req *models.ImageUploadReq, file io.Reader) (*models.ImageUploadRes, error) {
+	location, err := s.waterRepo.GetLocationByID(ctx, req.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	if location == nil {
+		return nil, ErrLocationNotFound
+	}
+
+	capturedAt := time.Now()
+	if req.CapturedAt != nil {
+		capturedAt = *req.CapturedAt
+	}
+
+	uploaded, err := utils.SaveUploadedImage(file, s.cfg.App.UploadDir, req.LocationID, capturedAt, s.cfg.App.MaxUploadBytes, req.StripGPS)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &models.ImageUploadRes{
+		FileName:    uploaded.FileName,
+		URL:         utils.BuildImageURL(s.cfg.App.BaseURL, uploaded.FileName),
+		ContentType: uploaded.ContentType,
+		Size:        uploaded.Size,
+		GPSStripped: uploaded.GPSStripped,
+		CapturedAt:  utils.FormatTime(capturedAt),
+	}
+
+	if req.WaterLevelID != nil {
+		attached, err := s.repo.AttachImage(ctx, req.LocationID, *req.WaterLevelID, uploaded.FileName, req.UserID, req.Admin)
+		if err != nil || attached == nil || !attached.Attached {
+			s.discard(uploaded.FileName)
+			switch {
+			case err != nil:
+				return nil, err
+			case attached == nil:
+				return nil, ErrReadingNotFound
+			}
+			return nil, ErrImageNotOwner
+		}
+
+		// the replaced image is no longer referenced
+		if previous := attached.Previous; previous.Valid && previous.String != "" && previous.String != uploaded.FileName {
+			s.discard(previous.String)
+		}
+
+		res.WaterLevelID = req.WaterLevelID
+		return res, nil
+	}
+
+	pending := &entities.PendingReading{
+		LocationID: req.LocationID,
+		Image:      uploaded.FileName,
+		CapturedAt: capturedAt,
+		UploadedBy: sql.NullInt64{Int64: req.UserID, Valid: req.UserID != 0},
+	}
+	if err := s.repo.CreatePendingReading(ctx, pending); err != nil {
+		s.discard(uploaded.FileName)
+		return nil, err
+	}
+
+	res.PendingReadingID = &pending.ID
+	return res, nil
+}
+
+func (s *imageService) discard(fileName string) {
+	if err := utils.ValidateImagePath(fileName); err != nil {
+		return
+	}
+	if err := utils.DeleteFile(filepath.Join(s.cfg.App.UploadDir, fileName)); err != nil {
+		log.Println("failed to delete file", fileName, err)
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/predictor"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/utils"
+)
+
+// SourceCamera is the water_levels.source of readings read from images
+const SourceCamera = "camera"
+
+var ErrPendingReadingNotFound = errors.New("pending reading not found")
+
+type predictionService struct {
+	imageRepo     repositories.ImageRepositoryInterface
+	waterRepo     repositories.WaterLevelRepositoryInterface
+	thresholdRepo repositories.ThresholdRepositoryInterface
+	predictor     predictor.Predictor
+	capturer      predictor.Capturer
+	cfg           *config.Config
+}
+
+type PredictionServiceInterface interface {
+	// CaptureImage takes a snapshot of the location and returns the pending reading it became
+	CaptureImage(ctx context.Context, locationID int64) (int64, error)
+	// PredictReading reads the level of a pending reading and stores it in water_levels. It returns
+	// nil when the pending reading was already processed.
+	PredictReading(ctx context.Context, pendingReadingID int64) (*models.PredictWater, error)
+	FailPendingReading(ctx context.Context, pendingReadingID int64, reason string) error
+}
+
+func NewPredictionService(imageRepo repositories.ImageRepositoryInterface, waterRepo repositories.WaterLevelRepositoryInterface, thresholdRepo repositories.ThresholdRepositoryInterface, predictor predictor.Predictor, capturer predictor.Capturer, cfg *config.Config) PredictionServiceInterface {
+	return &predictionService{
+		imageRepo:     imageRepo,
+		waterRepo:     waterRepo,
+		thresholdRepo: thresholdRepo,
+		predictor:     predictor,
+		capturer:      capturer,
+		cfg:           cfg,
+	}
+}
+
+func (s *predictionService) CaptureImage(ctx context.Context, locationID int64) (int64, error) {
+	location, err := s.waterRepo.GetLocationByID(ctx, locationID)
+	if err != nil {
+		return 0, err
+	}
+	if location == nil {
+		return 0, ErrLocationNotFound
+	}
+
+	capturedAt := time.Now()
+	fileName := utils.GenerateImageName(locationID, capturedAt, "png")
+
+	if err := s.capturer.Capture(ctx, filepath.Join(s.cfg.App.UploadDir, fileName)); err != nil {
+		return 0, err
+	}
+
+	pending := &entities.PendingReading{
+		LocationID: locationID,
+		Image:      fileName,
+		CapturedAt: capturedAt,
+	}
+	if err := s.imageRepo.CreatePendingReading(ctx, pending); err != nil {
+		return 0, err
+	}
+
+	return pending.ID, nil
+}
+
+func (s *predictionService) PredictReading(ctx context.Context, pendingReadingID int64) (*models.PredictWater, error) {
+	pending, err := s.imageRepo.GetPendingReading(ctx, pendingReadingID)
+	if err != nil {
+		return nil, err
+	}
+	if pending == nil {
+		return nil, ErrPendingReadingNotFound
+	}
+	if pending.Status != "PENDING" {
+		return nil, nil
+	}
+
+	levelCm, err := s.predictor.Predict(ctx, filepath.Join(s.cfg.App.UploadDir, pending.Image))
+	if err != nil {
+		return nil, err
+	}
+
+	threshold, err := s.thresholdRepo.GetByLocationID(ctx, pending.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	danger, flooded := ClassifyWaterLevel(levelCm, threshold)
+
+	reading := &entities.WaterLevel{
+		LocationID:      pending.LocationID,
+		LevelCm:         levelCm,
+		Image:           pending.Image,
+		Danger:          danger,
+		IsFlooded:       flooded,
+		Source:          sql.NullString{String: SourceCamera, Valid: true},
+		MeasuredAt:      pending.CapturedAt,
+		ImageUploadedBy: pending.UploadedBy,
+	}
+	if err := s.imageRepo.CompletePendingReading(ctx, pending, reading); err != nil {
+		return nil, err
+	}
+
+	return &models.PredictWater{
+		FileName:   pending.Image,
+		WaterLevel: levelCm,
+	}, nil
+}
+
+func (s *predictionService) FailPendingReading(ctx context.Context, pendingReadingID int64, reason string) error {
+	return s.imageRepo.FailPendingReading(ctx, pendingReadingID, reason)
+}
@@ -0,0 +1,637 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/sta"
+	"github.com/guatom999/self-boardcast/internal/utils"
+	"github.com/lib/pq"
+)
+
+const StaVersionPath = "/sta/v1.1"
+
+var ErrStaNotFound = errors.New("entity not found")
+
+// maxStaExpandQueries bounds the queries $expand may run for one request, every expanded entity
+// costs one query per navigation property
+const maxStaExpandQueries = 200
+
+type staExpandBudgetKey struct{}
+
+// spendExpandQuery takes one query from the $expand budget of the request
+func spendExpandQuery(ctx context.Context) error {
+	budget, ok := ctx.Value(staExpandBudgetKey{}).(*int)
+	if !ok {
+		return nil
+	}
+	if *budget <= 0 {
+		return fmt.Errorf("%w: $expand is limited to %d related queries, lower $top or expand less", utils.ErrInvalidInput, maxStaExpandQueries)
+	}
+	*budget--
+	return nil
+}
+
+// staSet is an entity set of the SensorThings surface. Things, Locations and Datastreams are all
+// rows of locations: each station is a Thing at one Location with a single water-level Datastream.
+// Observations are rows of water_levels. Sensors and ObservedProperties are static.
+type staSet struct {
+	idColumn string
+	// columns are the properties usable in $filter and $orderby
+	columns map[string]string
+	static  func(s *staService) *staEntity
+}
+
+var staSets = map[string]*staSet{
+	"Things": {
+		idColumn: "l.id",
+		columns: map[string]string{
+			"id":                         "l.id",
+			"name":                       "l.name",
+			"description":                "l.description",
+			"properties/province_code":   "l.province_code",
+			"properties/bank_level":      "l.bank_level",
+			"properties/tele_station_id": "l.tele_station_id",
+		},
+	},
+	"Locations": {
+		idColumn: "l.id",
+		columns: map[string]string{
+			"id":          "l.id",
+			"name":        "l.name",
+			"description": "l.description",
+		},
+	},
+	"Datastreams": {
+		idColumn: "l.id",
+		columns: map[string]string{
+			"id":          "l.id",
+			"name":        "(l.name || ' water level')",
+			"description": "('Water level at ' || l.name)",
+			"Thing/id":    "l.id",
+		},
+	},
+	"Observations": {
+		idColumn: "wl.id",
+		columns: map[string]string{
+			"id":                    "wl.id",
+			"phenomenonTime":        "wl.measured_at",
+			"resultTime":            "wl.measured_at",
+			"result":                "wl.level_cm",
+			"parameters/danger":     "wl.danger::TEXT",
+			"parameters/is_flooded": "wl.is_flooded",
+			"parameters/source":     "wl.source",
+			"Datastream/id":         "wl.location_id",
+		},
+	},
+	"Sensors": {
+		static: func(s *staService) *staEntity {
+			return &staEntity{id: 1, body: map[string]any{
+				"@iot.id":                        1,
+				"@iot.selfLink":                  s.link("Sensors", 1),
+				"name":                           "ThaiWater telemetry water level gauge",
+				"description":                    "Telemetry water level station reporting to ThaiWater",
+				"encodingType":                   "text/html",
+				"metadata":                       "https://www.thaiwater.net",
+				"Datastreams@iot.navigationLink": s.link("Sensors", 1) + "/Datastreams",
+			}}
+		},
+	},
+	"ObservedProperties": {
+		static: func(s *staService) *staEntity {
+			return &staEntity{id: 1, body: map[string]any{
+				"@iot.id":                        1,
+				"@iot.selfLink":                  s.link("ObservedProperties", 1),
+				"name":                           "Water level",
+				"description":                    "Height of the water surface at the gauge",
+				"definition":                     "https://en.wikipedia.org/wiki/Stage_(hydrology)",
+				"Datastreams@iot.navigationLink": s.link("ObservedProperties", 1) + "/Datastreams",
+			}}
+		},
+	},
+}
+
+// staSetOrder lists the sets in the order of the service root document
+var staSetOrder = []string{"Things", "Locations", "Datastreams", "Sensors", "ObservedProperties", "Observations"}
+
+type staNavigation struct {
+	target string
+	single bool
+	// restrict is the column of target matched against the location of the parent, empty for none
+	restrict string
+}
+
+var staNavigations = map[string]map[string]*staNavigation{
+	"Things": {
+		"Locations":   {target: "Locations", restrict: "l.id"},
+		"Datastreams": {target: "Datastreams", restrict: "l.id"},
+	},
+	"Locations": {
+		"Things": {target: "Things", restrict: "l.id"},
+	},
+	"Datastreams": {
+		"Thing":            {target: "Things", single: true, restrict: "l.id"},
+		"Sensor":           {target: "Sensors", single: true},
+		"ObservedProperty": {target: "ObservedProperties", single: true},
+		"Observations":     {target: "Observations", restrict: "wl.location_id"},
+	},
+	"Observations": {
+		"Datastream": {target: "Datastreams", single: true, restrict: "l.id"},
+	},
+	"Sensors": {
+		"Datastreams": {target: "Datastreams"},
+	},
+	"ObservedProperties": {
+		"Datastreams": {target: "Datastreams"},
+	},
+}
+
+type staEntity struct {
+	id         int64
+	locationID int64
+	body       map[string]any
+}
+
+type staPage struct {
+	entities []*staEntity
+	count    *int64
+	more     bool
+}
+
+type staRestriction struct {
+	column string
+	value  int64
+}
+
+type staService struct {
+	repo    repositories.StaRepositoryInterface
+	baseURL string
+}
+
+type StaServiceInterface interface {
+	Root() map[string]any
+	// Resolve answers a resource path such as "/Things(1)/Datastreams" with the raw query string of the request
+	Resolve(ctx context.Context, path string, rawQuery string) (any, error)
+}
+
+func NewStaService(repo repositories.StaRepositoryInterface, baseURL string) StaServiceInterface {
+	return &staService{
+		repo:    repo,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+func (s *staService) Root() map[string]any {
+	value := make([]map[string]any, 0, len(staSetOrder))
+	for _, name := range staSetOrder {
+		value = append(value, map[string]any{
+			"name": name,
+			"url":  s.baseURL + StaVersionPath + "/" + name,
+		})
+	}
+
+	return map[string]any{
+		"value": value,
+		"serverSettings": map[string]any{
+			"conformance": []string{
+				"http://www.opengis.net/spec/iot_sensing/1.1/req/datamodel",
+				"http://www.opengis.net/spec/iot_sensing/1.1/req/resource-path/resource-path-to-entities",
+				"http://www.opengis.net/spec/iot_sensing/1.1/req/request-data",
+			},
+		},
+	}
+}
+
+type staSegment struct {
+	name string
+	id   *int64
+}
+
+func parseStaPath(path string) ([]*staSegment, error) {
+	segments := make([]*staSegment, 0)
+
+	for _, part := range strings.Split(strings.Trim(path, "/"), "/") {
+		segment := &staSegment{name: part}
+
+		if open := strings.IndexByte(part, '('); open >= 0 {
+			if !strings.HasSuffix(part, ")") {
+				return nil, fmt.Errorf("%w: invalid path segment %q", utils.ErrInvalidInput, part)
+			}
+			id, err := strconv.ParseInt(strings.Trim(part[open+1:len(part)-1], "'"), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid id in %q", utils.ErrInvalidInput, part)
+			}
+			segment.name = part[:open]
+			segment.id = &id
+		}
+
+		segments = append(segments, segment)
+	}
+
+	return segments, nil
+}
+
+func (s *staService) Resolve(ctx context.Context, path string, rawQuery string) (any, error) {
+	budget := maxStaExpandQueries
+	ctx = context.WithValue(ctx, staExpandBudgetKey{}, &budget)
+
+	query, err := sta.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := sta.ParseOptions(query)
+	if err != nil {
+		return nil, err
+	}
+
+	segments, err := parseStaPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	first := segments[0]
+	if _, ok := staSets[first.name]; !ok {
+		return nil, ErrStaNotFound
+	}
+
+	if first.id == nil {
+		if len(segments) > 1 {
+			return nil, fmt.Errorf("%w: %s needs an id before navigating", utils.ErrInvalidInput, first.name)
+		}
+		page, err := s.list(ctx, first.name, nil, opts)
+		if err != nil {
+			return nil, s.wrapQueryError(err)
+		}
+		return s.pageResponse(page, path, query, opts), nil
+	}
+
+	setName := first.name
+	entity, err := s.get(ctx, setName, *first.id, nil)
+	if err != nil {
+		return nil, s.wrapQueryError(err)
+	}
+
+	// walk the navigation properties, every step but the last must lead to a single entity
+	for i, segment := range segments[1:] {
+		if entity == nil {
+			return nil, ErrStaNotFound
+		}
+
+		nav, ok := staNavigations[setName][segment.name]
+		if !ok || segment.id != nil {
+			return nil, ErrStaNotFound
+		}
+
+		last := i == len(segments)-2
+		if !nav.single {
+			if !last {
+				return nil, fmt.Errorf("%w: %s is a collection", utils.ErrInvalidInput, segment.name)
+			}
+			page, err := s.list(ctx, nav.target, restrictionFor(nav, entity), opts)
+			if err != nil {
+				return nil, s.wrapQueryError(err)
+			}
+			return s.pageResponse(page, path, query, opts), nil
+		}
+
+		entity, err = s.navigateSingle(ctx, nav, entity, nil)
+		if err != nil {
+			return nil, s.wrapQueryError(err)
+		}
+		setName = nav.target
+	}
+
+	if entity == nil {
+		return nil, ErrStaNotFound
+	}
+
+	if err := s.expand(ctx, setName, []*staEntity{entity}, opts.Expand); err != nil {
+		return nil, s.wrapQueryError(err)
+	}
+
+	return entity.body, nil
+}
+
+func restrictionFor(nav *staNavigation, parent *staEntity) *staRestriction {
+	if nav.restrict == "" {
+		return nil
+	}
+	return &staRestriction{column: nav.restrict, value: parent.locationID}
+}
+
+func (s *staService) get(ctx context.Context, setName string, id int64, expand []*sta.Expand) (*staEntity, error) {
+	set := staSets[setName]
+
+	if set.static != nil {
+		entity := set.static(s)
+		if entity.id != id {
+			return nil, nil
+		}
+		return entity, s.expand(ctx, setName, []*staEntity{entity}, expand)
+	}
+
+	page, err := s.list(ctx, setName, &staRestriction{column: set.idColumn, value: id}, &sta.Options{Top: 1, Expand: expand})
+	if err != nil {
+		return nil, err
+	}
+	if len(page.entities) == 0 {
+		return nil, nil
+	}
+
+	return page.entities[0], nil
+}
+
+func (s *staService) navigateSingle(ctx context.Context, nav *staNavigation, parent *staEntity, expand []*sta.Expand) (*staEntity, error) {
+	if nav.restrict == "" {
+		return s.get(ctx, nav.target, 1, expand)
+	}
+	return s.get(ctx, nav.target, parent.locationID, expand)
+}
+
+func (s *staService) list(ctx context.Context, setName string, restriction *staRestriction, opts *sta.Options) (*staPage, error) {
+	set := staSets[setName]
+
+	if set.static != nil {
+		if opts.Filter != nil || len(opts.OrderBy) > 0 {
+			return nil, fmt.Errorf("%w: %s does not support $filter or $orderby", utils.ErrInvalidInput, setName)
+		}
+
+		all := []*staEntity{set.static(s)}
+		page := &staPage{entities: make([]*staEntity, 0)}
+		if opts.Skip < len(all) {
+			all = all[opts.Skip:]
+			page.entities = all[:min(opts.Top, len(all))]
+			page.more = opts.Top > 0 && len(all) > opts.Top
+		}
+		if opts.Count {
+			count := int64(1)
+			page.count = &count
+		}
+		return page, s.expand(ctx, setName, page.entities, opts.Expand)
+	}
+
+	compiler := &sta.Compiler{Columns: set.columns}
+	q := &repositories.StaQuery{}
+
+	if restriction != nil {
+		compiler.Args = append(compiler.Args, restriction.value)
+		q.Where = append(q.Where, fmt.Sprintf("%s = $%d", restriction.column, len(compiler.Args)))
+	}
+
+	if opts.Filter != nil {
+		condition, err := compiler.Compile(opts.Filter)
+		if err != nil {
+			return nil, err
+		}
+		q.Where = append(q.Where, condition)
+	}
+
+	order := make([]string, 0, len(opts.OrderBy)+1)
+	for _, o := range opts.OrderBy {
+		column, err := compiler.Column(o.Property)
+		if err != nil {
+			return nil, err
+		}
+		if o.Desc {
+			order = append(order, column+" DESC")
+		} else {
+			order = append(order, column+" ASC")
+		}
+	}
+	// the id keeps pages stable when the requested order has ties
+	order = append(order, set.idColumn+" ASC")
+
+	q.Args = compiler.Args
+	q.OrderBy = strings.Join(order, ", ")
+	q.Limit = opts.Top + 1
+	q.Offset = opts.Skip
+
+	page := &staPage{entities: make([]*staEntity, 0)}
+
+	// $top=0 only asks for the count
+	switch {
+	case opts.Top == 0:
+	case setName == "Things", setName == "Locations":
+		rows, err := s.repo.ListLocations(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			if setName == "Things" {
+				page.entities = append(page.entities, s.thing(row))
+			} else {
+				page.entities = append(page.entities, s.location(row))
+			}
+		}
+	case setName == "Datastreams":
+		rows, err := s.repo.ListDatastreams(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			page.entities = append(page.entities, s.datastream(row))
+		}
+	case setName == "Observations":
+		rows, err := s.repo.ListObservations(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			page.entities = append(page.entities, s.observation(row))
+		}
+	}
+
+	if len(page.entities) > opts.Top {
+		page.entities = page.entities[:opts.Top]
+		page.more = true
+	}
+
+	if opts.Count {
+		var (
+			count int64
+			err   error
+		)
+		if setName == "Observations" {
+			count, err = s.repo.CountObservations(ctx, q)
+		} else {
+			count, err = s.repo.CountLocations(ctx, q)
+		}
+		if err != nil {
+			return nil, err
+		}
+		page.count = &count
+	}
+
+	if err := s.expand(ctx, setName, page.entities, opts.Expand); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// expand inlines the requested navigation properties into every entity
+func (s *staService) expand(ctx context.Context, setName string, entities []*staEntity, expand []*sta.Expand) error {
+	for _, item := range expand {
+		nav, ok := staNavigations[setName][item.Name]
+		if !ok {
+			return fmt.Errorf("%w: %s has no navigation property %s", utils.ErrInvalidInput, setName, item.Name)
+		}
+
+		for _, entity := range entities {
+			if err := spendExpandQuery(ctx); err != nil {
+				return err
+			}
+			if nav.single {
+				related, err := s.navigateSingle(ctx, nav, entity, item.Options.Expand)
+				if err != nil {
+					return err
+				}
+				if related == nil {
+					entity.body[item.Name] = nil
+				} else {
+					entity.body[item.Name] = related.body
+				}
+				continue
+			}
+
+			page, err := s.list(ctx, nav.target, restrictionFor(nav, entity), item.Options)
+			if err != nil {
+				return err
+			}
+			values := make([]map[string]any, 0, len(page.entities))
+			for _, related := range page.entities {
+				values = append(values, related.body)
+			}
+			entity.body[item.Name] = values
+			if page.count != nil {
+				entity.body[item.Name+"@iot.count"] = *page.count
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *staService) pageResponse(page *staPage, path string, query url.Values, opts *sta.Options) map[string]any {
+	values := make([]map[string]any, 0, len(page.entities))
+	for _, entity := range page.entities {
+		values = append(values, entity.body)
+	}
+
+	res := map[string]any{"value": values}
+	if page.count != nil {
+		res["@iot.count"] = *page.count
+	}
+
+	if page.more {
+		next := url.Values{}
+		for key, value := range query {
+			next[key] = value
+		}
+		next.Set("$skip", strconv.Itoa(opts.Skip+opts.Top))
+		next.Set("$top", strconv.Itoa(opts.Top))
+		res["@iot.nextLink"] = s.baseURL + StaVersionPath + "/" + strings.Trim(path, "/") + "?" + next.Encode()
+	}
+
+	return res
+}
+
+// wrapQueryError reports values Postgres could not compare with a property, e.g. result eq 'high', as bad input
+func (s *staService) wrapQueryError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		if pqErr.Code.Class() == "22" || pqErr.Code == "42883" || pqErr.Code == "42804" || pqErr.Code == "42P18" {
+			return fmt.Errorf("%w: %s", utils.ErrInvalidInput, pqErr.Message)
+		}
+	}
+	return err
+}
+
+func (s *staService) link(setName string, id int64) string {
+	return fmt.Sprintf("%s%s/%s(%d)", s.baseURL, StaVersionPath, setName, id)
+}
+
+func (s *staService) thing(l *entities.Location) *staEntity {
+	self := s.link("Things", l.ID)
+	return &staEntity{id: l.ID, locationID: l.ID, body: map[string]any{
+		"@iot.id":       l.ID,
+		"@iot.selfLink": self,
+		"name":          l.Name,
+		"description":   l.Description.String,
+		"properties": map[string]any{
+			"province_code":   utils.NullStringToPtr(l.ProvinceCode),
+			"bank_level":      utils.NullFloat64ToPtr(l.BankLevel),
+			"tele_station_id": utils.NullInt64ToPtr(l.TeleStationID),
+		},
+		"Locations@iot.navigationLink":   self + "/Locations",
+		"Datastreams@iot.navigationLink": self + "/Datastreams",
+	}}
+}
+
+func (s *staService) location(l *entities.Location) *staEntity {
+	self := s.link("Locations", l.ID)
+	return &staEntity{id: l.ID, locationID: l.ID, body: map[string]any{
+		"@iot.id":       l.ID,
+		"@iot.selfLink": self,
+		"name":          l.Name,
+		"description":   l.Description.String,
+		"encodingType":  "application/geo+json",
+		"location": map[string]any{
+			"type":        "Point",
+			"coordinates": []float64{l.Longitude, l.Latitude},
+		},
+		"Things@iot.navigationLink": self + "/Things",
+	}}
+}
+
+func (s *staService) datastream(d *entities.DatastreamRow) *staEntity {
+	self := s.link("Datastreams", d.ID)
+
+	var phenomenonTime any
+	if d.FirstMeasuredAt.Valid && d.LastMeasuredAt.Valid {
+		phenomenonTime = utils.FormatTime(d.FirstMeasuredAt.Time) + "/" + utils.FormatTime(d.LastMeasuredAt.Time)
+	}
+
+	return &staEntity{id: d.ID, locationID: d.ID, body: map[string]any{
+		"@iot.id":         d.ID,
+		"@iot.selfLink":   self,
+		"name":            d.Name + " water level",
+		"description":     "Water level at " + d.Name,
+		"observationType": "http://www.opengis.net/def/observationType/OGC-OM/2.0/OM_Measurement",
+		"unitOfMeasurement": map[string]any{
+			"name":       "centimetre",
+			"symbol":     "cm",
+			"definition": "http://unitsofmeasure.org/ucum.html",
+		},
+		"phenomenonTime":                      phenomenonTime,
+		"Thing@iot.navigationLink":            self + "/Thing",
+		"Sensor@iot.navigationLink":           self + "/Sensor",
+		"ObservedProperty@iot.navigationLink": self + "/ObservedProperty",
+		"Observations@iot.navigationLink":     self + "/Observations",
+	}}
+}
+
+func (s *staService) observation(w *entities.WaterLevel) *staEntity {
+	self := s.link("Observations", w.ID)
+	return &staEntity{id: w.ID, locationID: w.LocationID, body: map[string]any{
+		"@iot.id":        w.ID,
+		"@iot.selfLink":  self,
+		"phenomenonTime": utils.FormatTime(w.MeasuredAt),
+		"resultTime":     utils.FormatTime(w.MeasuredAt),
+		"result":         w.LevelCm,
+		"parameters": map[string]any{
+			"danger":         w.Danger,
+			"is_flooded":     w.IsFlooded,
+			"source":         utils.NullStringToPtr(w.Source),
+			"situation_text": utils.NullStringToPtr(w.SituationText),
+		},
+		"Datastream@iot.navigationLink": self + "/Datastream",
+	}}
+}
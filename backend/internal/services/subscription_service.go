@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/utils"
+)
+
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+const maxSubscriptionRadiusKm = 500
+
+// subscriptionChannels are the channels a subscriber can be reached on, the bot tokens and SMTP
+// server come from the worker configuration
+var subscriptionChannels = map[string]bool{
+	"webhook":  true,
+	"email":    true,
+	"line":     true,
+	"telegram": true,
+	"slack":    true,
+}
+
+type subscriptionService struct {
+	repo      repositories.SubscriptionRepositoryInterface
+	waterRepo repositories.WaterLevelRepositoryInterface
+}
+
+type SubscriptionServiceInterface interface {
+	ListSubscriptions(ctx context.Context, userID int64) ([]*models.SubscriptionRes, error)
+	GetSubscription(ctx context.Context, userID int64, id int64) (*models.SubscriptionRes, error)
+	CreateSubscription(ctx context.Context, userID int64, req *models.SubscriptionReq) (*models.SubscriptionRes, error)
+	UpdateSubscription(ctx context.Context, userID int64, id int64, req *models.SubscriptionReq) (*models.SubscriptionRes, error)
+	// RotateSecret replaces the secret webhook deliveries are signed with and returns it, once
+	RotateSecret(ctx context.Context, userID int64, id int64) (string, error)
+	DeleteSubscription(ctx context.Context, userID int64, id int64) error
+}
+
+func NewSubscriptionService(repo repositories.SubscriptionRepositoryInterface, waterRepo repositories.WaterLevelRepositoryInterface) SubscriptionServiceInterface {
+	return &subscriptionService{
+		repo:      repo,
+		waterRepo: waterRepo,
+	}
+}
+
+func (s *subscriptionService) ListSubscriptions(ctx context.Context, userID int64) ([]*models.SubscriptionRes, error) {
+	subscriptions, err := s.repo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*models.SubscriptionRes, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		result = append(result, toSubscriptionRes(subscription))
+	}
+
+	return result, nil
+}
+
+func (s *subscriptionService) GetSubscription(ctx context.Context, userID int64, id int64) (*models.SubscriptionRes, error) {
+	subscription, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// someone else's subscription is reported as missing
+	if subscription == nil || subscription.UserID != userID {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	return toSubscriptionRes(subscription), nil
+}
+
+func (s *subscriptionService) CreateSubscription(ctx context.Context, userID int64, req *models.SubscriptionReq) (*models.SubscriptionRes, error) {
+	subscription, err := s.buildSubscription(ctx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// every subscription gets a secret, the channel may become a webhook later
+	secret := newSubscriptionSecret()
+	subscription.Secret = sql.NullString{String: secret, Valid: true}
+
+	if err := s.repo.Create(ctx, subscription); err != nil {
+		return nil, err
+	}
+
+	res := toSubscriptionRes(subscription)
+	res.Secret = &secret
+	return res, nil
+}
+
+func (s *subscriptionService) UpdateSubscription(ctx context.Context, userID int64, id int64, req *models.SubscriptionReq) (*models.SubscriptionRes, error) {
+	subscription, err := s.buildSubscription(ctx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+	subscription.ID = id
+
+	found, err := s.repo.Update(ctx, subscription)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	return toSubscriptionRes(subscription), nil
+}
+
+func (s *subscriptionService) RotateSecret(ctx context.Context, userID int64, id int64) (string, error) {
+	secret := newSubscriptionSecret()
+
+	found, err := s.repo.SetSecret(ctx, userID, id, secret)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", ErrSubscriptionNotFound
+	}
+
+	return secret, nil
+}
+
+func (s *subscriptionService) DeleteSubscription(ctx context.Context, userID int64, id int64) error {
+	found, err := s.repo.Delete(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+// buildSubscription validates a request into a subscription of the user
+func (s *subscriptionService) buildSubscription(ctx context.Context, userID int64, req *models.SubscriptionReq) (*entities.Subscription, error) {
+	subscription := &entities.Subscription{
+		UserID:    userID,
+		MinDanger: strings.ToUpper(strings.TrimSpace(req.MinDanger)),
+		Channel:   strings.ToLower(strings.TrimSpace(req.Channel)),
+		Target:    strings.TrimSpace(req.Target),
+		IsActive:  req.IsActive == nil || *req.IsActive,
+	}
+
+	if req.LocationID != nil {
+		if req.Latitude != nil || req.Longitude != nil || req.RadiusKm != nil {
+			return nil, fmt.Errorf("%w: set either location_id or latitude, longitude and radius_km", utils.ErrInvalidInput)
+		}
+
+		location, err := s.waterRepo.GetLocationByID(ctx, *req.LocationID)
+		if err != nil {
+			return nil, err
+		}
+		if location == nil {
+			return nil, ErrLocationNotFound
+		}
+		subscription.LocationID = sql.NullInt64{Int64: *req.LocationID, Valid: true}
+	} else {
+		if req.Latitude == nil || req.Longitude == nil || req.RadiusKm == nil {
+			return nil, fmt.Errorf("%w: set either location_id or latitude, longitude and radius_km", utils.ErrInvalidInput)
+		}
+		if *req.Latitude < -90 || *req.Latitude > 90 || *req.Longitude < -180 || *req.Longitude > 180 {
+			return nil, fmt.Errorf("%w: latitude or longitude out of range", utils.ErrInvalidInput)
+		}
+		if *req.RadiusKm <= 0 || *req.RadiusKm > maxSubscriptionRadiusKm {
+			return nil, fmt.Errorf("%w: radius_km must be between 0 and %d", utils.ErrInvalidInput, maxSubscriptionRadiusKm)
+		}
+		subscription.Latitude = utils.PtrToNullFloat64(req.Latitude)
+		subscription.Longitude = utils.PtrToNullFloat64(req.Longitude)
+		subscription.RadiusKm = utils.PtrToNullFloat64(req.RadiusKm)
+	}
+
+	if subscription.MinDanger == "" {
+		subscription.MinDanger = DangerWatch
+	}
+	if _, ok := dangerRanks[subscription.MinDanger]; !ok {
+		return nil, fmt.Errorf("%w: min_danger must be SAFE, WATCH, DANGER or CRITICAL", utils.ErrInvalidInput)
+	}
+
+	if !subscriptionChannels[subscription.Channel] {
+		return nil, fmt.Errorf("%w: channel must be webhook, email, line, telegram or slack", utils.ErrInvalidInput)
+	}
+	target, err := validateSubscriptionTarget(ctx, subscription.Channel, subscription.Target)
+	if err != nil {
+		return nil, err
+	}
+	subscription.Target = target
+
+	if (req.QuietStart == nil) != (req.QuietEnd == nil) {
+		return nil, fmt.Errorf("%w: quiet_start and quiet_end go together", utils.ErrInvalidInput)
+	}
+	if req.QuietStart != nil {
+		for _, value := range []string{*req.QuietStart, *req.QuietEnd} {
+			if _, err := time.Parse("15:04", value); err != nil {
+				return nil, fmt.Errorf("%w: quiet hours must be HH:MM", utils.ErrInvalidInput)
+			}
+		}
+		subscription.QuietStart = sql.NullString{String: *req.QuietStart, Valid: true}
+		subscription.QuietEnd = sql.NullString{String: *req.QuietEnd, Valid: true}
+	}
+
+	if req.Digest != nil && *req.Digest != "" {
+		digest := strings.ToLower(strings.TrimSpace(*req.Digest))
+		if digest != DigestDaily && digest != DigestWeekly {
+			return nil, fmt.Errorf("%w: digest must be daily or weekly", utils.ErrInvalidInput)
+		}
+		subscription.Digest = sql.NullString{String: digest, Valid: true}
+	}
+
+	return subscription, nil
+}
+
+// validateSubscriptionTarget checks the recipient of a channel and returns it as it is stored. Email
+// targets are reduced to the bare address the mail server takes as recipient. Webhook and Slack URLs
+// are chosen by any registered user, they must resolve to public addresses so the worker cannot be
+// pointed at the internal network.
+func validateSubscriptionTarget(ctx context.Context, channel string, target string) (string, error) {
+	if target == "" || len(target) > 500 {
+		return "", fmt.Errorf("%w: target is required and at most 500 characters", utils.ErrInvalidInput)
+	}
+
+	switch channel {
+	case "email":
+		addr, err := mail.ParseAddress(target)
+		if err != nil {
+			return "", fmt.Errorf("%w: target must be an email address", utils.ErrInvalidInput)
+		}
+		return addr.Address, nil
+	case "webhook", "slack":
+		if err := utils.ValidatePublicURL(ctx, target); err != nil {
+			return "", err
+		}
+	}
+
+	return target, nil
+}
+
+// newSubscriptionSecret returns 32 random bytes as hex
+func newSubscriptionSecret() string {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return hex.EncodeToString(secret)
+}
+
+func toSubscriptionRes(subscription *entities.Subscription) *models.SubscriptionRes {
+	return &models.SubscriptionRes{
+		ID:         subscription.ID,
+		LocationID: utils.NullInt64ToPtr(subscription.LocationID),
+		Latitude:   utils.NullFloat64ToPtr(subscription.Latitude),
+		Longitude:  utils.NullFloat64ToPtr(subscription.Longitude),
+		RadiusKm:   utils.NullFloat64ToPtr(subscription.RadiusKm),
+		MinDanger:  subscription.MinDanger,
+		Channel:    subscription.Channel,
+		Target:     subscription.Target,
+		QuietStart: quietTime(subscription.QuietStart),
+		QuietEnd:   quietTime(subscription.QuietEnd),
+		Digest:     utils.NullStringToPtr(subscription.Digest),
+		IsActive:   subscription.IsActive,
+		CreatedAt:  utils.FormatTime(subscription.CreatedAt),
+		UpdatedAt:  utils.FormatTime(subscription.UpdatedAt),
+	}
+}
+
+// quietTime trims the seconds Postgres adds to TIME values
+func quietTime(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
+	}
+	hhmm := value.String
+	if len(hhmm) > 5 {
+		hhmm = hhmm[:5]
+	}
+	return &hhmm
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/utils"
+)
+
+// Values of the danger_level enum
+const (
+	DangerSafe     = "SAFE"
+	DangerWatch    = "WATCH"
+	DangerDanger   = "DANGER"
+	DangerCritical = "CRITICAL"
+)
+
+// upstreamDangerLevels maps ThaiWater situation levels
+// (1 critically low, 2 low, 3 normal, 4 high, 5 overflowing the bank) onto the danger_level enum.
+// An overflowing reading at or above the critical threshold of the location is CRITICAL.
+var upstreamDangerLevels = map[int]string{
+	1: DangerSafe,
+	2: DangerSafe,
+	3: DangerSafe,
+	4: DangerWatch,
+	5: DangerDanger,
+}
+
+var (
+	ErrLocationNotFound  = errors.New("location not found")
+	ErrThresholdNotFound = errors.New("threshold not configured for this location")
+	ErrInvalidThreshold  = errors.New("thresholds must satisfy warning <= danger <= critical")
+)
+
+type thresholdService struct {
+	repo repositories.ThresholdRepositoryInterface
+}
+
+type ThresholdServiceInterface interface {
+	GetThresholds(ctx context.Context) ([]*models.ThresholdRes, error)
+	GetThreshold(ctx context.Context, locationID int64) (*models.ThresholdRes, error)
+	UpdateThreshold(ctx context.Context, locationID int64, userID int64, req *models.UpdateThresholdReq) (*models.ThresholdRes, error)
+	GetThresholdHistory(ctx context.Context, locationID int64, limit int) ([]*models.ThresholdHistoryRes, error)
+}
+
+func NewThresholdService(repo repositories.ThresholdRepositoryInterface) ThresholdServiceInterface {
+	return &thresholdService{
+		repo: repo,
+	}
+}
+
+func (s *thresholdService) GetThresholds(ctx context.Context) ([]*models.ThresholdRes, error) {
+	thresholds, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*models.ThresholdRes, 0, len(thresholds))
+	for _, threshold := range thresholds {
+		result = append(result, toThresholdRes(threshold))
+	}
+
+	return result, nil
+}
+
+func (s *thresholdService) GetThreshold(ctx context.Context, locationID int64) (*models.ThresholdRes, error) {
+	threshold, err := s.repo.GetByLocationID(ctx, locationID)
+	if err != nil {
+		return nil, err
+	}
+	if threshold == nil {
+		return nil, ErrThresholdNotFound
+	}
+
+	return toThresholdRes(threshold), nil
+}
+
+func (s *thresholdService) UpdateThreshold(ctx context.Context, locationID int64, userID int64, req *models.UpdateThresholdReq) (*models.ThresholdRes, error) {
+	if !isOrdered(req.WarningLevelCm, req.DangerLevelCm, req.CriticalLevelCm) {
+		return nil, ErrInvalidThreshold
+	}
+	if req.RiseRateLimitCmPerHour != nil && *req.RiseRateLimitCmPerHour <= 0 {
+		return nil, ErrInvalidThreshold
+	}
+
+	exists, err := s.repo.LocationExists(ctx, locationID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrLocationNotFound
+	}
+
+	threshold, err := s.repo.Update(ctx, &entities.LocationThreshold{
+		LocationID:             locationID,
+		WarningLevelCm:         utils.PtrToNullFloat64(req.WarningLevelCm),
+		DangerLevelCm:          utils.PtrToNullFloat64(req.DangerLevelCm),
+		CriticalLevelCm:        utils.PtrToNullFloat64(req.CriticalLevelCm),
+		RiseRateLimitCmPerHour: utils.PtrToNullFloat64(req.RiseRateLimitCmPerHour),
+		UpdatedBy:              sql.NullInt64{Int64: userID, Valid: userID != 0},
+	}, req.Note)
+	if err != nil {
+		return nil, err
+	}
+
+	return toThresholdRes(threshold), nil
+}
+
+func (s *thresholdService) GetThresholdHistory(ctx context.Context, locationID int64, limit int) ([]*models.ThresholdHistoryRes, error) {
+	exists, err := s.repo.LocationExists(ctx, locationID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrLocationNotFound
+	}
+
+	history, err := s.repo.GetHistory(ctx, locationID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*models.ThresholdHistoryRes, 0, len(history))
+	for _, h := range history {
+		result = append(result, &models.ThresholdHistoryRes{
+			ID:                        h.ID,
+			LocationID:                h.LocationID,
+			OldWarningLevelCm:         utils.NullFloat64ToPtr(h.OldWarningLevelCm),
+			OldDangerLevelCm:          utils.NullFloat64ToPtr(h.OldDangerLevelCm),
+			OldCriticalLevelCm:        utils.NullFloat64ToPtr(h.OldCriticalLevelCm),
+			NewWarningLevelCm:         utils.NullFloat64ToPtr(h.NewWarningLevelCm),
+			NewDangerLevelCm:          utils.NullFloat64ToPtr(h.NewDangerLevelCm),
+			NewCriticalLevelCm:        utils.NullFloat64ToPtr(h.NewCriticalLevelCm),
+			OldRiseRateLimitCmPerHour: utils.NullFloat64ToPtr(h.OldRiseRateLimitCmPerHour),
+			NewRiseRateLimitCmPerHour: utils.NullFloat64ToPtr(h.NewRiseRateLimitCmPerHour),
+			ChangedBy:                 utils.NullInt64ToPtr(h.ChangedBy),
+			Note:                      h.Note.String,
+			ChangedAt:                 h.ChangedAt,
+		})
+	}
+
+	return result, nil
+}
+
+// ClassifyWaterLevel maps a reading onto the danger_level enum using the location thresholds.
+// A reading is considered flooded once it reaches the danger threshold.
+func ClassifyWaterLevel(levelCm float64, threshold *entities.LocationThreshold) (string, bool) {
+	if threshold == nil {
+		return DangerSafe, false
+	}
+
+	switch {
+	case threshold.CriticalLevelCm.Valid && levelCm >= threshold.CriticalLevelCm.Float64:
+		return DangerCritical, true
+	case threshold.DangerLevelCm.Valid && levelCm >= threshold.DangerLevelCm.Float64:
+		return DangerDanger, true
+	case threshold.WarningLevelCm.Valid && levelCm >= threshold.WarningLevelCm.Float64:
+		return DangerWatch, false
+	default:
+		return DangerSafe, false
+	}
+}
+
+// applyUpstreamSituation stores the ThaiWater situation level, colour and text on the reading.
+// When useUpstream is set the danger level also follows the upstream classification instead of the local thresholds.
+func applyUpstreamSituation(entity *entities.WaterLevel, data *models.ThaiWaterResponse, scale *models.ScaleInfo, threshold *entities.LocationThreshold, useUpstream bool) {
+	level, ok := evaluateSituationLevel(data, scale)
+	if !ok {
+		return
+	}
+
+	entity.SituationLevel = sql.NullInt32{Int32: int32(level), Valid: true}
+
+	if info, ok := scale.Level[strconv.Itoa(level)]; ok {
+		entity.SituationColor = sql.NullString{String: info.Color, Valid: info.Color != ""}
+		entity.SituationText = sql.NullString{String: info.Trans, Valid: info.Trans != ""}
+	}
+	if value, ok := situationValue(data); ok {
+		for _, s := range scale.Scale {
+			if matchScaleTerm(value, s.Operator, s.Term) {
+				if s.Color != "" {
+					entity.SituationColor = sql.NullString{String: s.Color, Valid: true}
+				}
+				if s.Text != "" {
+					entity.SituationText = sql.NullString{String: s.Text, Valid: true}
+				}
+				break
+			}
+		}
+	}
+
+	if !useUpstream {
+		return
+	}
+
+	if danger, ok := upstreamDangerLevels[level]; ok {
+		if danger == DangerDanger && threshold != nil && threshold.CriticalLevelCm.Valid && entity.LevelCm >= threshold.CriticalLevelCm.Float64 {
+			danger = DangerCritical
+		}
+		entity.Danger = danger
+		entity.IsFlooded = danger == DangerDanger || danger == DangerCritical
+	}
+}
+
+// evaluateSituationLevel runs the upstream rule set against the reading, in the order ThaiWater sends it.
+// Readings the rules cannot evaluate fall back to the situation_level reported by ThaiWater.
+func evaluateSituationLevel(data *models.ThaiWaterResponse, scale *models.ScaleInfo) (int, bool) {
+	if value, ok := situationValue(data); ok {
+		for _, rule := range scale.Rule {
+			if matchScaleTerm(value, rule.Operator, rule.Term) {
+				return rule.Level, true
+			}
+		}
+	}
+
+	if data.SituationLevel > 0 {
+		return data.SituationLevel, true
+	}
+
+	return 0, false
+}
+
+// situationValue returns the value the upstream rules are written against: storage_percent,
+// or the bank capacity implied by diff_wl_bank when the station does not report a percentage
+func situationValue(data *models.ThaiWaterResponse) (float64, bool) {
+	if value, err := strconv.ParseFloat(strings.TrimSpace(data.StoragePercent), 64); err == nil {
+		return value, true
+	}
+
+	diff, err := strconv.ParseFloat(strings.TrimSpace(data.DiffWLBank), 64)
+	if err != nil {
+		return 0, false
+	}
+
+	// diff_wl_bank is how far the water sits below the lowest bank; the channel depth runs from ground level to that bank
+	depth := data.Station.MinBank - data.Station.GroundLevel
+	if depth <= 0 {
+		return 0, false
+	}
+
+	return (depth - diff) / depth * 100, true
+}
+
+func matchScaleTerm(value float64, operator string, term string) bool {
+	target, err := strconv.ParseFloat(strings.TrimSpace(term), 64)
+	if err != nil {
+		return false
+	}
+
+	switch strings.TrimSpace(operator) {
+	case "<":
+		return value < target
+	case "<=":
+		return value <= target
+	case ">":
+		return value > target
+	case ">=":
+		return value >= target
+	case "=", "==":
+		return value == target
+	default:
+		return false
+	}
+}
+
+// seedThreshold derives initial thresholds from the ThaiWater station metadata and the location bank level
+func seedThreshold(location *entities.Location, station *models.Station) *entities.LocationThreshold {
+	threshold := &entities.LocationThreshold{LocationID: location.ID}
+
+	if station.WarningLevelM != nil {
+		threshold.WarningLevelCm = utils.PtrToNullFloat64(metersToCm(*station.WarningLevelM))
+	}
+	if location.BankLevel.Valid {
+		threshold.DangerLevelCm = utils.PtrToNullFloat64(metersToCm(location.BankLevel.Float64))
+	}
+	if station.CriticalLevelMSL != nil {
+		threshold.CriticalLevelCm = utils.PtrToNullFloat64(metersToCm(*station.CriticalLevelMSL))
+		if !threshold.DangerLevelCm.Valid {
+			threshold.DangerLevelCm = threshold.CriticalLevelCm
+		}
+	}
+
+	// upstream values are not always consistent with our bank level, drop the ones out of order
+	if !isOrdered(utils.NullFloat64ToPtr(threshold.WarningLevelCm), utils.NullFloat64ToPtr(threshold.DangerLevelCm), nil) {
+		threshold.WarningLevelCm.Valid = false
+	}
+	if !isOrdered(nil, utils.NullFloat64ToPtr(threshold.DangerLevelCm), utils.NullFloat64ToPtr(threshold.CriticalLevelCm)) {
+		threshold.CriticalLevelCm.Valid = false
+	}
+
+	return threshold
+}
+
+func toThresholdRes(threshold *entities.LocationThreshold) *models.ThresholdRes {
+	return &models.ThresholdRes{
+		LocationID:             threshold.LocationID,
+		WarningLevelCm:         utils.NullFloat64ToPtr(threshold.WarningLevelCm),
+		DangerLevelCm:          utils.NullFloat64ToPtr(threshold.DangerLevelCm),
+		CriticalLevelCm:        utils.NullFloat64ToPtr(threshold.CriticalLevelCm),
+		RiseRateLimitCmPerHour: utils.NullFloat64ToPtr(threshold.RiseRateLimitCmPerHour),
+		UpdatedBy:              utils.NullInt64ToPtr(threshold.UpdatedBy),
+		UpdatedAt:              utils.ParseTimeToString(threshold.UpdatedAt),
+	}
+}
+
+// isOrdered reports whether the configured levels are non-decreasing, ignoring unset ones
+func isOrdered(levels ...*float64) bool {
+	var previous *float64
+	for _, level := range levels {
+		if level == nil {
+			continue
+		}
+		if previous != nil && *level < *previous {
+			return false
+		}
+		previous = level
+	}
+	return true
+}
+
+func metersToCm(value float64) *float64 {
+	cm := value * 100
+	return &cm
+}
@@ -3,9 +3,13 @@ package services
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/guatom999/self-boardcast/internal/config"
@@ -15,33 +19,63 @@ import (
 	"github.com/guatom999/self-boardcast/internal/utils"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// minRiseSpan is the shortest span between two readings a rise rate is computed over, shorter
+// spans turn sensor noise into huge rates
+const minRiseSpan = 10 * time.Minute
+
+// aggregateBuckets maps the bucket query values onto Postgres intervals
+var aggregateBuckets = map[string]string{
+	"10m": "10 minutes",
+	"30m": "30 minutes",
+	"1h":  "1 hour",
+	"3h":  "3 hours",
+	"6h":  "6 hours",
+	"12h": "12 hours",
+	"1d":  "1 day",
+}
+
+var aggregateFunctions = map[string]bool{
+	"min":  true,
+	"max":  true,
+	"avg":  true,
+	"last": true,
+}
+
 // WaterLevelService handles business logic
 type waterLevelService struct {
-	repo    repositories.WaterLevelRepositoryInterface
-	baseURL string
-	cfg     *config.Config
+	repo          repositories.WaterLevelRepositoryInterface
+	thresholdRepo repositories.ThresholdRepositoryInterface
+	baseURL       string
+	cfg           *config.Config
 }
 
 type WaterLevelServiceInterface interface {
 	// ProcessImage(ctx context.Context, imageURL string) (*models.WaterLevel, error)
 	GetAllLocations(ctx context.Context, limit int) ([]models.LocationWithWaterLevelRes, error)
+	GetMarkersGeoJSON(ctx context.Context, query *models.MarkerQuery) (*models.FeatureCollection, error)
 	GetByLocationID(ctx context.Context, id string) ([]*models.WaterLocationDetailRes, error)
-	ScheduleGetWaterLevel(ctx context.Context) (*entities.WaterLevel, error)
+	GetReadings(ctx context.Context, query *models.ReadingQuery) (*models.ReadingsPageRes, error)
+	AggregateReadings(ctx context.Context, query *models.AggregateQuery) (*models.AggregateRes, error)
+	DownsampleReadings(ctx context.Context, query *models.DownsampleQuery) (*models.DownsampleRes, error)
+	ScheduleGetWaterLevel(ctx context.Context) ([]*models.IngestedReading, *models.IngestSummary, error)
 	CreateWaterLevel(ctx context.Context, req *models.CreateWaterLevelReq) error
 
 	ScheduleDeleteWaterLevel(ctx context.Context, fileName string, locationID int) error
 }
 
-func NewWaterLevelService(repo repositories.WaterLevelRepositoryInterface, baseURL string, cfg *config.Config) WaterLevelServiceInterface {
+func NewWaterLevelService(repo repositories.WaterLevelRepositoryInterface, thresholdRepo repositories.ThresholdRepositoryInterface, baseURL string, cfg *config.Config) WaterLevelServiceInterface {
 	return &waterLevelService{
-		repo:    repo,
-		baseURL: baseURL,
-		cfg:     cfg,
+		repo:          repo,
+		thresholdRepo: thresholdRepo,
+		baseURL:       baseURL,
+		cfg:           cfg,
 	}
 }
 
 func (s *waterLevelService) GetAllLocations(ctx context.Context, limit int) ([]models.LocationWithWaterLevelRes, error) {
-	locations, err := s.repo.GetAll(ctx, limit)
+	locations, err := s.repo.GetAll(ctx, limit, SourceCamera)
 	if err != nil {
 		return nil, err
 	}
@@ -59,7 +93,7 @@ func (s *waterLevelService) GetAllLocations(ctx context.Context, limit int) ([]m
 		locationsRes = append(locationsRes, models.LocationWithWaterLevelRes{
 			LocationID:          v.LocationID,
 			LocationName:        v.LocationName,
-			LocationDescription: v.LocationDescription,
+			LocationDescription: utils.PtrToString(v.LocationDescription),
 			Latitude:            v.Latitude,
 			Longitude:           v.Longitude,
 			IsActive:            v.IsActive,
@@ -73,22 +107,80 @@ func (s *waterLevelService) GetAllLocations(ctx context.Context, limit int) ([]m
 				}
 				return nil
 			}(),
-			Danger:     v.Danger,
-			IsFlooded:  v.IsFlooded,
-			MeasuredAt: utils.ParseTimePtrToString(v.MeasuredAt),
-			Note:       v.Note,
+			Danger:         v.Danger,
+			IsFlooded:      v.IsFlooded,
+			MeasuredAt:     utils.ParseTimePtrToString(v.MeasuredAt),
+			Note:           v.Note,
+			SituationColor: v.SituationColor,
+			SituationText:  v.SituationText,
 		})
 	}
 
 	return locationsRes, nil
 }
 
+// GetMarkersGeoJSON returns the latest reading of every active location as GeoJSON point features
+func (s *waterLevelService) GetMarkersGeoJSON(ctx context.Context, query *models.MarkerQuery) (*models.FeatureCollection, error) {
+	locations, err := s.GetAllLocations(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	collection := &models.FeatureCollection{
+		Type:     "FeatureCollection",
+		Features: make([]*models.Feature, 0, len(locations)),
+	}
+
+	for _, v := range locations {
+		if box := query.BBox; box != nil {
+			if v.Longitude < box[0] || v.Latitude < box[1] || v.Longitude > box[2] || v.Latitude > box[3] {
+				continue
+			}
+		}
+		if len(query.Danger) > 0 && (v.Danger == nil || !query.Danger[*v.Danger]) {
+			continue
+		}
+
+		collection.Features = append(collection.Features, &models.Feature{
+			Type: "Feature",
+			ID:   v.LocationID,
+			Geometry: &models.PointGeometry{
+				Type:        "Point",
+				Coordinates: [2]float64{v.Longitude, v.Latitude},
+			},
+			Properties: &models.MarkerProperties{
+				LocationID:     v.LocationID,
+				Name:           v.LocationName,
+				Description:    v.LocationDescription,
+				LevelCm:        v.LevelCm,
+				Danger:         v.Danger,
+				BankLevel:      v.BankLevel,
+				IsFlooded:      v.IsFlooded,
+				ImageURL:       v.Image,
+				MeasuredAt:     v.MeasuredAt,
+				SituationColor: v.SituationColor,
+				SituationText:  v.SituationText,
+			},
+		})
+	}
+
+	return collection, nil
+}
+
 func (s *waterLevelService) GetByLocationID(ctx context.Context, id string) ([]*models.WaterLocationDetailRes, error) {
 
 	locationID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: location_id must be an integer", utils.ErrInvalidInput)
+	}
+
+	location, err := s.repo.GetLocationByID(ctx, int64(locationID))
 	if err != nil {
 		return nil, err
 	}
+	if location == nil {
+		return nil, ErrLocationNotFound
+	}
 
 	waterLevelsRes := make([]*models.WaterLocationDetailRes, 0)
 
@@ -99,19 +191,225 @@ func (s *waterLevelService) GetByLocationID(ctx context.Context, id string) ([]*
 
 	for _, res := range results {
 		waterLevelsRes = append(waterLevelsRes, &models.WaterLocationDetailRes{
-			LocationID: res.LocationID,
-			LevelCm:    res.LevelCm,
-			Image:      res.Image,
-			Danger:     res.Danger,
-			IsFlooded:  res.IsFlooded,
-			Source:     res.Source,
-			MeasuredAt: res.MeasuredAt,
-			Note:       res.Note,
+			LocationID:     res.LocationID,
+			LevelCm:        res.LevelCm,
+			Image:          res.Image,
+			Danger:         res.Danger,
+			IsFlooded:      res.IsFlooded,
+			Source:         res.Source,
+			MeasuredAt:     res.MeasuredAt,
+			Note:           res.Note,
+			SituationColor: res.SituationColor.String,
+			SituationText:  res.SituationText.String,
 		})
 	}
 	return waterLevelsRes, nil
 }
 
+func (s *waterLevelService) GetReadings(ctx context.Context, query *models.ReadingQuery) (*models.ReadingsPageRes, error) {
+
+	location, err := s.repo.GetLocationByID(ctx, query.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	if location == nil {
+		return nil, ErrLocationNotFound
+	}
+
+	filter := &repositories.ReadingFilter{
+		LocationID: query.LocationID,
+		From:       query.From,
+		To:         query.To,
+		// one extra row tells whether another page exists
+		Limit:      query.Limit + 1,
+		Descending: query.Descending,
+	}
+
+	if query.Cursor != "" {
+		key, err := decodeReadingCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = key
+	}
+
+	results, err := s.repo.GetReadings(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.ReadingsPageRes{
+		LocationID: query.LocationID,
+		Order:      "asc",
+		Limit:      query.Limit,
+		Readings:   make([]*models.ReadingRes, 0, len(results)),
+	}
+	if query.Descending {
+		page.Order = "desc"
+	}
+
+	if len(results) > query.Limit {
+		results = results[:query.Limit]
+		last := results[len(results)-1]
+		cursor := encodeReadingCursor(last.MeasuredAt, last.ID)
+		page.NextCursor = &cursor
+	}
+
+	for _, res := range results {
+		page.Readings = append(page.Readings, s.toReadingRes(res))
+	}
+
+	return page, nil
+}
+
+func (s *waterLevelService) AggregateReadings(ctx context.Context, query *models.AggregateQuery) (*models.AggregateRes, error) {
+
+	interval, ok := aggregateBuckets[query.Bucket]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported bucket %q", utils.ErrInvalidInput, query.Bucket)
+	}
+
+	functions := make(map[string]bool, len(query.Functions))
+	for _, fn := range query.Functions {
+		if !aggregateFunctions[fn] {
+			return nil, fmt.Errorf("%w: unsupported fn %q", utils.ErrInvalidInput, fn)
+		}
+		functions[fn] = true
+	}
+
+	location, err := s.repo.GetLocationByID(ctx, query.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	if location == nil {
+		return nil, ErrLocationNotFound
+	}
+
+	buckets, err := s.repo.AggregateReadings(ctx, query.LocationID, query.From, query.To, interval, SourceCamera)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.AggregateRes{
+		LocationID: query.LocationID,
+		Bucket:     query.Bucket,
+		From:       utils.FormatTime(query.From),
+		To:         utils.FormatTime(query.To),
+		Functions:  query.Functions,
+		Buckets:    make([]*models.AggregateBucketRes, 0, len(buckets)),
+	}
+
+	for _, bucket := range buckets {
+		res := &models.AggregateBucketRes{
+			Bucket: utils.FormatTime(bucket.Bucket),
+			Count:  bucket.Count,
+		}
+		if functions["min"] {
+			res.Min = &bucket.Min
+		}
+		if functions["max"] {
+			res.Max = &bucket.Max
+		}
+		if functions["avg"] {
+			avg := math.Round(bucket.Avg*100) / 100
+			res.Avg = &avg
+		}
+		if functions["last"] {
+			res.Last = &bucket.Last
+		}
+		result.Buckets = append(result.Buckets, res)
+	}
+
+	return result, nil
+}
+
+func (s *waterLevelService) DownsampleReadings(ctx context.Context, query *models.DownsampleQuery) (*models.DownsampleRes, error) {
+
+	location, err := s.repo.GetLocationByID(ctx, query.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	if location == nil {
+		return nil, ErrLocationNotFound
+	}
+
+	series, err := s.repo.GetSeries(ctx, query.LocationID, query.From, query.To, SourceCamera)
+	if err != nil {
+		return nil, err
+	}
+
+	sampled := utils.LTTB(series, query.Points)
+
+	result := &models.DownsampleRes{
+		LocationID:  query.LocationID,
+		From:        utils.FormatTime(query.From),
+		To:          utils.FormatTime(query.To),
+		SourceCount: len(series),
+		Points:      make([]*models.SeriesPointRes, 0, len(sampled)),
+	}
+
+	for _, point := range sampled {
+		result.Points = append(result.Points, &models.SeriesPointRes{
+			MeasuredAt: utils.FormatTime(point.MeasuredAt),
+			LevelCm:    point.LevelCm,
+		})
+	}
+
+	return result, nil
+}
+
+func (s *waterLevelService) toReadingRes(res *entities.WaterLevel) *models.ReadingRes {
+	return &models.ReadingRes{
+		ID:         res.ID,
+		LocationID: res.LocationID,
+		LevelCm:    res.LevelCm,
+		Image: func() *string {
+			if res.Image != "" {
+				imageURL := utils.BuildImageURL(s.baseURL, res.Image)
+				return &imageURL
+			}
+			return nil
+		}(),
+		Danger:            res.Danger,
+		IsFlooded:         res.IsFlooded,
+		Source:            utils.NullStringToPtr(res.Source),
+		MeasuredAt:        utils.FormatTime(res.MeasuredAt),
+		Note:              res.Note,
+		SituationColor:    utils.NullStringToPtr(res.SituationColor),
+		SituationText:     utils.NullStringToPtr(res.SituationText),
+		RiseRateCmPerHour: utils.NullFloat64ToPtr(res.RiseRateCmPerHour),
+	}
+}
+
+// encodeReadingCursor packs the (measured_at, id) key of the last row into an opaque token
+func encodeReadingCursor(measuredAt time.Time, id int64) string {
+	raw := fmt.Sprintf("%d:%d", measuredAt.UnixNano(), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeReadingCursor(cursor string) (*repositories.ReadingKey, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &repositories.ReadingKey{MeasuredAt: time.Unix(0, nanos), ID: id}, nil
+}
+
 func (s *waterLevelService) CreateWaterLevel(ctx context.Context, req *models.CreateWaterLevelReq) error {
 
 	if err := s.repo.CreateWaterLevel(ctx, &entities.WaterLevel{
@@ -129,17 +427,151 @@ func (s *waterLevelService) CreateWaterLevel(ctx context.Context, req *models.Cr
 	return nil
 }
 
-func (s *waterLevelService) ScheduleGetWaterLevel(ctx context.Context) (*entities.WaterLevel, error) {
+func (s *waterLevelService) ScheduleGetWaterLevel(ctx context.Context) ([]*models.IngestedReading, *models.IngestSummary, error) {
 
-	fileName := utils.GenerateFileName()
+	locations, err := s.repo.GetStationLocations(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	// if err := utils.CaptureWaterImage(s.cfg.App.ImageProcessingDir, fileName); err != nil {
-	// 	return nil, err
-	// }
+	// one ThaiWater request per province, each response covers every station in it
+	provinces := make(map[string][]*entities.Location)
+	provinceCodes := make([]string, 0)
+	for _, location := range locations {
+		code := location.ProvinceCode.String
+		if _, ok := provinces[code]; !ok {
+			provinceCodes = append(provinceCodes, code)
+		}
+		provinces[code] = append(provinces[code], location)
+	}
+
+	thresholds, err := s.getThresholds(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	latest, err := s.repo.GetLatestDangers(ctx, SourceCamera)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	previousDanger := make(map[int64]string, len(latest))
+	for _, v := range latest {
+		previousDanger[v.LocationID] = v.Danger
+	}
+
+	summary := &models.IngestSummary{
+		Provinces: len(provinceCodes),
+		Stations:  len(locations),
+	}
+	readings := make([]*models.IngestedReading, 0, len(locations))
+
+	for _, code := range provinceCodes {
+		apiResponse, err := s.fetchProvinceWaterLevel(code)
+		if err != nil {
+			log.Printf("failed to fetch water level for province %s: %v", code, err)
+			summary.Failed += len(provinces[code])
+			continue
+		}
+
+		stations := make(map[int64]*models.ThaiWaterResponse, len(apiResponse.Data))
+		for i := range apiResponse.Data {
+			stations[int64(apiResponse.Data[i].Station.ID)] = &apiResponse.Data[i]
+		}
+
+		for _, location := range provinces[code] {
+			data, ok := stations[location.TeleStationID.Int64]
+			if !ok {
+				log.Printf("station %d (location %d) missing from province %s response", location.TeleStationID.Int64, location.ID, code)
+				summary.Missing++
+				continue
+			}
+
+			threshold, ok := thresholds[location.ID]
+			if !ok {
+				threshold = seedThreshold(location, &data.Station)
+				if err := s.thresholdRepo.Seed(ctx, threshold); err != nil {
+					log.Printf("failed to seed thresholds for location %d: %v", location.ID, err)
+				}
+				thresholds[location.ID] = threshold
+			}
+
+			entity := buildWaterLevel(location, data, threshold)
+			applyUpstreamSituation(entity, data, &apiResponse.Scale, threshold, s.cfg.ThaiWater.ClassificationMode == "upstream")
+			entity.RiseRateCmPerHour = s.riseRate(ctx, entity)
+			riseLimit := s.riseRateLimit(threshold)
+
+			outcome, err := s.repo.UpsertWaterLevel(ctx, entity)
+			if err != nil {
+				log.Printf("failed to upsert water level for location %d: %v", location.ID, err)
+				summary.Failed++
+				continue
+			}
+
+			switch outcome {
+			case models.ReadingNew:
+				summary.New++
+			case models.ReadingUpdated:
+				summary.Updated++
+			case models.ReadingUnchanged:
+				summary.Unchanged++
+			}
+			readings = append(readings, &models.IngestedReading{
+				Reading:            entity,
+				Location:           location,
+				Outcome:            outcome,
+				PreviousDanger:     previousDanger[location.ID],
+				RiseWindowMinutes:  s.cfg.RiseRate.WindowMinutes,
+				RiseLimitCmPerHour: riseLimit,
+				RapidRise:          riseLimit > 0 && entity.RiseRateCmPerHour.Valid && entity.RiseRateCmPerHour.Float64 > riseLimit,
+			})
+		}
+	}
+
+	log.Printf("water level ingest: provinces=%d stations=%d new=%d updated=%d unchanged=%d missing=%d failed=%d",
+		summary.Provinces, summary.Stations, summary.New, summary.Updated, summary.Unchanged, summary.Missing, summary.Failed)
+
+	return readings, summary, nil
+}
+
+// riseRate returns how fast the level rose, in cm/hour, since the earliest reading of the location within the rise window
+func (s *waterLevelService) riseRate(ctx context.Context, reading *entities.WaterLevel) sql.NullFloat64 {
+
+	window := time.Duration(s.cfg.RiseRate.WindowMinutes) * time.Minute
+
+	base, err := s.repo.GetEarliestReading(ctx, reading.LocationID, reading.MeasuredAt.Add(-window), reading.MeasuredAt, SourceCamera)
+	if err != nil {
+		log.Printf("failed to get rise window for location %d: %v", reading.LocationID, err)
+		return sql.NullFloat64{}
+	}
+	if base == nil {
+		return sql.NullFloat64{}
+	}
+
+	span := reading.MeasuredAt.Sub(base.MeasuredAt)
+	if span < minRiseSpan {
+		return sql.NullFloat64{}
+	}
+
+	rate := (reading.LevelCm - base.LevelCm) / span.Hours()
+	return sql.NullFloat64{Float64: math.Round(rate*100) / 100, Valid: true}
+}
+
+// riseRateLimit returns the rapid rise limit of a location, falling back to the configured default. 0 means disabled.
+func (s *waterLevelService) riseRateLimit(threshold *entities.LocationThreshold) float64 {
+	if threshold != nil && threshold.RiseRateLimitCmPerHour.Valid {
+		return threshold.RiseRateLimitCmPerHour.Float64
+	}
+	return s.cfg.RiseRate.DefaultLimitCmPerHour
+}
+
+func (s *waterLevelService) fetchProvinceWaterLevel(provinceCode string) (*models.ThaiWaterAPIResponse, error) {
 
 	apiResponse := new(models.ThaiWaterAPIResponse)
 
-	if err := utils.Get("https://api-v3.thaiwater.net/api/v1/thaiwater30/provinces/waterlevel?province_code=13", apiResponse); err != nil {
+	url := fmt.Sprintf("%s/provinces/waterlevel?province_code=%s", strings.TrimSuffix(s.cfg.ThaiWater.BaseURL, "/"), provinceCode)
+
+	if err := utils.Get(url, apiResponse); err != nil {
 		return nil, err
 	}
 
@@ -147,44 +579,42 @@ func (s *waterLevelService) ScheduleGetWaterLevel(ctx context.Context) (*entitie
 		return nil, fmt.Errorf("API returned non-OK result: %s", apiResponse.Result)
 	}
 
-	stationName := apiResponse.Data[0].Station.TeleStationName.TH
-
-	entity := &entities.WaterLevel{
-		LocationID: 28,
-		LevelCm:    utils.ConvertStringToFloat64(apiResponse.Data[0].WaterlevelMSL) * 100,
-		// Image:      fileName,
-		Image: "",
-		Danger: func() string {
-			if utils.ConvertStringToFloat64(apiResponse.Data[0].WaterlevelMSL) < 1 {
-				return "SAFE"
-			} else if utils.ConvertStringToFloat64(apiResponse.Data[0].WaterlevelMSL) < 1.29 {
-				return "WATCH"
-			} else {
-				return "DANGER"
-			}
-		}(),
-		IsFlooded: func() bool {
-			if utils.ConvertStringToFloat64(apiResponse.Data[0].WaterlevelMSL) < 1.29 {
-				return false
-			} else {
-				return true
-			}
-		}(),
-		Source:     sql.NullString{String: stationName, Valid: true},
-		MeasuredAt: utils.ConvertStringToTime(apiResponse.Data[0].WaterlevelDatetime),
-		Note:       "get value of waterLevel from cctv of water",
-	}
+	return apiResponse, nil
+}
 
-	if err := s.repo.CreateWaterLevel(ctx, entity); err != nil {
-		log.Println("failed to create water level in database:", err)
-		filePath := s.cfg.App.UploadDir + "/images/" + fileName
-		if deleteErr := utils.DeleteFile(filePath); deleteErr != nil {
-			log.Printf("failed to cleanup file %s after DB insert error: %v", fileName, deleteErr)
-		}
+func (s *waterLevelService) getThresholds(ctx context.Context) (map[int64]*entities.LocationThreshold, error) {
+
+	thresholds, err := s.thresholdRepo.GetAll(ctx)
+	if err != nil {
 		return nil, err
 	}
 
-	return entity, nil
+	result := make(map[int64]*entities.LocationThreshold, len(thresholds))
+	for _, threshold := range thresholds {
+		result[threshold.LocationID] = threshold
+	}
+
+	return result, nil
+}
+
+// SourceThaiWater is the water_levels.source of readings the cron ingests from ThaiWater. It is a
+// constant rather than the station name so a renamed station keeps upserting the same readings.
+const SourceThaiWater = "thaiwater"
+
+func buildWaterLevel(location *entities.Location, data *models.ThaiWaterResponse, threshold *entities.LocationThreshold) *entities.WaterLevel {
+
+	levelCm := utils.ConvertStringToFloat64(data.WaterlevelMSL) * 100
+	danger, isFlooded := ClassifyWaterLevel(levelCm, threshold)
+
+	return &entities.WaterLevel{
+		LocationID: location.ID,
+		LevelCm:    levelCm,
+		Image:      "",
+		Danger:     danger,
+		IsFlooded:  isFlooded,
+		Source:     sql.NullString{String: SourceThaiWater, Valid: true},
+		MeasuredAt: utils.ConvertStringToTime(data.WaterlevelDatetime),
+	}
 }
 
 func (s *waterLevelService) ScheduleDeleteWaterLevel(ctx context.Context, fileName string, locationID int) error {
@@ -198,9 +628,7 @@ func (s *waterLevelService) ScheduleDeleteWaterLevel(ctx context.Context, fileNa
 		return loc
 	}())
 
-	covertLocationID := int64(28)
-
-	if err := s.repo.MarkForDeletion(ctx, covertLocationID, scheduleAt); err != nil {
+	if err := s.repo.MarkForDeletion(ctx, int64(locationID), scheduleAt); err != nil {
 		log.Println("failed to mark for deletion", err)
 		return err
 	}
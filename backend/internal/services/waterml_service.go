@@ -0,0 +1,260 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/utils"
+)
+
+const (
+	WaterMLUnitCm = "cm"
+	WaterMLUnitM  = "m"
+)
+
+const waterMLQualityVocabulary = "http://www.opengis.net/def/waterml/2.0/quality/"
+
+// waterMLQuality flags a reading: ThaiWater telemetry, live or backfilled, is good while manual
+// entries without a source are estimates. Camera predictions are not exported at all.
+func waterMLQuality(row *entities.ExportRow) string {
+	if !row.Source.Valid {
+		return "estimate"
+	}
+	return "good"
+}
+
+type waterMLService struct {
+	exportRepo repositories.ExportRepositoryInterface
+	repo       repositories.WaterLevelRepositoryInterface
+	cfg        *config.Config
+}
+
+type WaterMLServiceInterface interface {
+	// WriteWaterML streams the series as a WaterML 2.0 MeasurementTimeseries. Nothing is written
+	// when the query is invalid or the location does not exist.
+	WriteWaterML(ctx context.Context, w io.Writer, query *models.WaterMLQuery) error
+}
+
+func NewWaterMLService(exportRepo repositories.ExportRepositoryInterface, repo repositories.WaterLevelRepositoryInterface, cfg *config.Config) WaterMLServiceInterface {
+	return &waterMLService{
+		exportRepo: exportRepo,
+		repo:       repo,
+		cfg:        cfg,
+	}
+}
+
+func (s *waterMLService) WriteWaterML(ctx context.Context, w io.Writer, query *models.WaterMLQuery) error {
+	divisor := 1.0
+	switch query.Unit {
+	case WaterMLUnitCm:
+	case WaterMLUnitM:
+		divisor = 100
+	default:
+		return fmt.Errorf("%w: unit must be cm or m", utils.ErrInvalidInput)
+	}
+
+	if !query.From.Before(query.To) {
+		return fmt.Errorf("%w: from must be before to", utils.ErrInvalidInput)
+	}
+
+	var (
+		location *entities.Location
+		err      error
+	)
+	if query.LocationID > 0 {
+		location, err = s.repo.GetLocationByID(ctx, query.LocationID)
+	} else {
+		location, err = s.repo.GetLocationByStationID(ctx, query.StationID)
+	}
+	if err != nil {
+		return err
+	}
+	if location == nil {
+		return ErrLocationNotFound
+	}
+
+	out := bufio.NewWriter(w)
+	doc := &waterMLWriter{w: out, loc: bangkok()}
+
+	doc.header(location, query, s.cfg.App.BaseURL)
+
+	err = s.exportRepo.StreamReadings(ctx, &repositories.ExportFilter{
+		LocationIDs:   []int64{location.ID},
+		From:          query.From,
+		To:            query.To,
+		ExcludeSource: SourceCamera,
+	}, func(row *entities.ExportRow) error {
+		doc.point(row, divisor)
+		return doc.err
+	})
+	if err != nil {
+		return err
+	}
+
+	doc.footer()
+	if doc.err != nil {
+		return doc.err
+	}
+
+	return out.Flush()
+}
+
+// waterMLWriter writes the document by hand so points are streamed rather than built up in memory,
+// the first write error sticks and ends the document
+type waterMLWriter struct {
+	w    *bufio.Writer
+	loc  *time.Location
+	err  error
+	last time.Time
+}
+
+func (d *waterMLWriter) raw(format string, args ...any) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = fmt.Fprintf(d.w, format, args...)
+}
+
+func (d *waterMLWriter) text(value string) {
+	if d.err != nil {
+		return
+	}
+	d.err = xml.EscapeText(d.w, []byte(value))
+}
+
+func (d *waterMLWriter) time(t time.Time) string {
+	return t.In(d.loc).Format(time.RFC3339)
+}
+
+func (d *waterMLWriter) header(location *entities.Location, query *models.WaterMLQuery, baseURL string) {
+	id := location.ID
+
+	d.raw(`<?xml version="1.0" encoding="UTF-8"?>
+<wml2:Collection xmlns:wml2="http://www.opengis.net/waterml/2.0" xmlns:gml="http://www.opengis.net/gml/3.2" xmlns:om="http://www.opengis.net/om/2.0" xmlns:sa="http://www.opengis.net/sampling/2.0" xmlns:sams="http://www.opengis.net/samplingSpatial/2.0" xmlns:xlink="http://www.w3.org/1999/xlink" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.opengis.net/waterml/2.0 http://schemas.opengis.net/waterml/2.0/waterml2.xsd" gml:id="C.%d">
+  <wml2:metadata>
+    <wml2:DocumentMetadata gml:id="DM.%d">
+      <wml2:generationDate>%s</wml2:generationDate>
+      <wml2:generationSystem>self-boardcast</wml2:generationSystem>
+    </wml2:DocumentMetadata>
+  </wml2:metadata>
+  <wml2:observationMember>
+    <om:OM_Observation gml:id="OBS.%d">
+      <om:phenomenonTime>
+        <gml:TimePeriod gml:id="TP.%d">
+          <gml:beginPosition>%s</gml:beginPosition>
+          <gml:endPosition>%s</gml:endPosition>
+        </gml:TimePeriod>
+      </om:phenomenonTime>
+      <om:resultTime>
+        <gml:TimeInstant gml:id="RT.%d">
+          <gml:timePosition>%s</gml:timePosition>
+        </gml:TimeInstant>
+      </om:resultTime>
+      <om:procedure xlink:href="https://www.thaiwater.net" xlink:title="ThaiWater telemetry water level gauge"/>
+      <om:observedProperty xlink:href="https://en.wikipedia.org/wiki/Stage_(hydrology)" xlink:title="Water level"/>
+      <om:featureOfInterest>
+        <wml2:MonitoringPoint gml:id="MP.%d">
+          <gml:identifier codeSpace="%s/locations">%d</gml:identifier>
+          <gml:name>`,
+		id, id, d.time(time.Now()), id, id, d.time(query.From), d.time(query.To), id, d.time(time.Now()), id, baseURL, id)
+	d.text(location.Name)
+	d.raw(`</gml:name>
+          <sa:sampledFeature xlink:title="`)
+	d.text(location.Name)
+	d.raw(`"/>`)
+
+	if location.TeleStationID.Valid {
+		d.raw(`
+          <sa:parameter>
+            <om:NamedValue>
+              <om:name xlink:title="ThaiWater tele-station id"/>
+              <om:value>%d</om:value>
+            </om:NamedValue>
+          </sa:parameter>`, location.TeleStationID.Int64)
+	}
+	if location.BankLevel.Valid {
+		d.raw(`
+          <sa:parameter>
+            <om:NamedValue>
+              <om:name xlink:title="Bank level (m MSL)"/>
+              <om:value>%s</om:value>
+            </om:NamedValue>
+          </sa:parameter>`, strconv.FormatFloat(location.BankLevel.Float64, 'f', -1, 64))
+	}
+
+	d.raw(`
+          <sams:shape>
+            <gml:Point gml:id="P.%d" srsName="urn:ogc:def:crs:EPSG::4326">
+              <gml:pos>%s %s</gml:pos>
+            </gml:Point>
+          </sams:shape>
+          <wml2:verticalDatum xlink:href="urn:ogc:def:datum:EPSG::5100" xlink:title="Mean Sea Level"/>
+          <wml2:timeZone>
+            <wml2:TimeZone>
+              <wml2:zoneOffset>+07:00</wml2:zoneOffset>
+              <wml2:zoneAbbreviation>ICT</wml2:zoneAbbreviation>
+            </wml2:TimeZone>
+          </wml2:timeZone>
+        </wml2:MonitoringPoint>
+      </om:featureOfInterest>
+      <om:result>
+        <wml2:MeasurementTimeseries gml:id="TS.%d">
+          <wml2:defaultPointMetadata>
+            <wml2:DefaultTVPMeasurementMetadata>
+              <wml2:quality xlink:href="%sgood" xlink:title="good"/>
+              <wml2:uom code="%s"/>
+              <wml2:interpolationType xlink:href="http://www.opengis.net/def/waterml/2.0/interpolationType/Continuous" xlink:title="Instantaneous"/>
+            </wml2:DefaultTVPMeasurementMetadata>
+          </wml2:defaultPointMetadata>`,
+		id,
+		strconv.FormatFloat(location.Latitude, 'f', -1, 64), strconv.FormatFloat(location.Longitude, 'f', -1, 64),
+		id, waterMLQualityVocabulary, query.Unit)
+}
+
+func (d *waterMLWriter) point(row *entities.ExportRow, divisor float64) {
+	// a time series holds one value per time, rows come in time order with telemetry before manual entries
+	if row.MeasuredAt.Equal(d.last) {
+		return
+	}
+	d.last = row.MeasuredAt
+
+	d.raw(`
+          <wml2:point>
+            <wml2:MeasurementTVP>
+              <wml2:time>%s</wml2:time>
+              <wml2:value>%s</wml2:value>`,
+		d.time(row.MeasuredAt), strconv.FormatFloat(row.LevelCm/divisor, 'f', -1, 64))
+
+	// only readings that differ from the default quality carry their own metadata
+	if quality := waterMLQuality(row); quality != "good" {
+		d.raw(`
+              <wml2:metadata>
+                <wml2:TVPMeasurementMetadata>
+                  <wml2:quality xlink:href="%s%s" xlink:title="%s"/>
+                </wml2:TVPMeasurementMetadata>
+              </wml2:metadata>`, waterMLQualityVocabulary, quality, quality)
+	}
+
+	d.raw(`
+            </wml2:MeasurementTVP>
+          </wml2:point>`)
+}
+
+func (d *waterMLWriter) footer() {
+	d.raw(`
+        </wml2:MeasurementTimeseries>
+      </om:result>
+    </om:OM_Observation>
+  </wml2:observationMember>
+</wml2:Collection>
+`)
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/utils"
+)
+
+var ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+
+type webhookService struct {
+	repo repositories.NotificationRepositoryInterface
+}
+
+type WebhookServiceInterface interface {
+	// ListFailedDeliveries returns the deliveries that gave up, one row per delivery with its last attempt
+	ListFailedDeliveries(ctx context.Context, limit int) ([]*models.WebhookDeliveryRes, error)
+	GetDelivery(ctx context.Context, id int64) (*models.WebhookDeliveryRes, error)
+}
+
+func NewWebhookService(repo repositories.NotificationRepositoryInterface) WebhookServiceInterface {
+	return &webhookService{
+		repo: repo,
+	}
+}
+
+func (s *webhookService) ListFailedDeliveries(ctx context.Context, limit int) ([]*models.WebhookDeliveryRes, error) {
+	deliveries, err := s.repo.ListFailedWebhookDeliveries(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*models.WebhookDeliveryRes, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		result = append(result, toWebhookDeliveryRes(delivery))
+	}
+
+	return result, nil
+}
+
+func (s *webhookService) GetDelivery(ctx context.Context, id int64) (*models.WebhookDeliveryRes, error) {
+	delivery, err := s.repo.GetWebhookDelivery(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+
+	return toWebhookDeliveryRes(delivery), nil
+}
+
+func toWebhookDeliveryRes(delivery *entities.WebhookDelivery) *models.WebhookDeliveryRes {
+	res := &models.WebhookDeliveryRes{
+		ID:           delivery.ID,
+		DeliveryID:   delivery.DeliveryID,
+		Channel:      delivery.Channel,
+		Event:        delivery.Event,
+		URL:          delivery.URL,
+		Notification: json.RawMessage(delivery.Notification),
+		Attempt:      delivery.Attempt,
+		LatencyMs:    delivery.LatencyMs,
+		Error:        utils.NullStringToPtr(delivery.Error),
+		Succeeded:    delivery.Succeeded,
+		ReplayOf:     utils.NullInt64ToPtr(delivery.ReplayOf),
+		CreatedAt:    utils.FormatTime(delivery.CreatedAt),
+	}
+
+	if delivery.StatusCode.Valid {
+		statusCode := int(delivery.StatusCode.Int32)
+		res.StatusCode = &statusCode
+	}
+
+	return res
+}
@@ -0,0 +1,442 @@
+package sta
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/guatom999/self-boardcast/internal/utils"
+)
+
+// Expr is a node of a parsed $filter
+type Expr interface{}
+
+// Binary is a comparison (eq, ne, gt, ge, lt, le) or a logical and/or
+type Binary struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+type Not struct {
+	Expr Expr
+}
+
+// Call is one of the supported string functions: substringof, startswith, endswith
+type Call struct {
+	Name string
+	Args []Expr
+}
+
+type Property struct {
+	Name string
+}
+
+// Literal holds a string, int64, float64, bool, time.Time or nil
+type Literal struct {
+	Value any
+}
+
+var comparisonOperators = map[string]string{
+	"eq": "=",
+	"ne": "<>",
+	"gt": ">",
+	"ge": ">=",
+	"lt": "<",
+	"le": "<=",
+}
+
+var stringFunctions = map[string]bool{
+	"substringof": true,
+	"startswith":  true,
+	"endswith":    true,
+}
+
+type token struct {
+	kind  string // "(", ")", ",", "string", "word", "value"
+	text  string
+	value any
+}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+// ParseFilter parses a $filter expression made of comparisons, and/or/not, parentheses and
+// the substringof, startswith and endswith functions
+func ParseFilter(raw string) (Expr, error) {
+	tokens, err := tokenize(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q in $filter", utils.ErrInvalidInput, p.tokens[p.pos].text)
+	}
+
+	return expr, nil
+}
+
+func (p *filterParser) peek() *token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *filterParser) keyword(word string) bool {
+	t := p.peek()
+	if t != nil && t.kind == "word" && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(kind string) error {
+	t := p.peek()
+	if t == nil || t.kind != kind {
+		return fmt.Errorf("%w: expected %q in $filter", utils.ErrInvalidInput, kind)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *filterParser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (Expr, error) {
+	if p.keyword("not") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: expr}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (Expr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t != nil && t.kind == "word" {
+		op := strings.ToLower(t.text)
+		if _, ok := comparisonOperators[op]; ok {
+			p.pos++
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return &Binary{Op: op, Left: left, Right: right}, nil
+		}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseOperand() (Expr, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("%w: unexpected end of $filter", utils.ErrInvalidInput)
+	}
+	p.pos++
+
+	switch t.kind {
+	case "(":
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	case "string", "value":
+		return &Literal{Value: t.value}, nil
+	case "word":
+		switch strings.ToLower(t.text) {
+		case "true":
+			return &Literal{Value: true}, nil
+		case "false":
+			return &Literal{Value: false}, nil
+		case "null":
+			return &Literal{Value: nil}, nil
+		}
+
+		if next := p.peek(); next != nil && next.kind == "(" {
+			return p.parseCall(strings.ToLower(t.text))
+		}
+
+		return &Property{Name: normalizeProperty(t.text)}, nil
+	}
+
+	return nil, fmt.Errorf("%w: unexpected %q in $filter", utils.ErrInvalidInput, t.text)
+}
+
+func (p *filterParser) parseCall(name string) (Expr, error) {
+	if !stringFunctions[name] {
+		return nil, fmt.Errorf("%w: unsupported function %s in $filter", utils.ErrInvalidInput, name)
+	}
+	p.pos++ // (
+
+	call := &Call{Name: name}
+	for {
+		arg, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+
+		if t := p.peek(); t != nil && t.kind == "," {
+			p.pos++
+			continue
+		}
+		break
+	}
+
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if len(call.Args) != 2 {
+		return nil, fmt.Errorf("%w: %s takes two arguments", utils.ErrInvalidInput, name)
+	}
+
+	return call, nil
+}
+
+func tokenize(raw string) ([]token, error) {
+	tokens := make([]token, 0)
+
+	for i := 0; i < len(raw); {
+		c := raw[i]
+
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, token{kind: string(c), text: string(c)})
+			i++
+		case c == '\'':
+			// strings escape a quote by doubling it
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(raw) {
+					return nil, fmt.Errorf("%w: unterminated string in $filter", utils.ErrInvalidInput)
+				}
+				if raw[i] == '\'' {
+					if i+1 < len(raw) && raw[i+1] == '\'' {
+						b.WriteByte('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteByte(raw[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: "string", text: b.String(), value: b.String()})
+		case c == '-' || unicode.IsDigit(rune(c)):
+			start := i
+			for i < len(raw) && !strings.ContainsRune(" \t(),", rune(raw[i])) {
+				i++
+			}
+			text := raw[start:i]
+			value, err := parseValue(text)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: "value", text: text, value: value})
+		case c == '@' || c == '_' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(raw) && (raw[i] == '@' || raw[i] == '_' || raw[i] == '/' || raw[i] == '.' ||
+				unicode.IsLetter(rune(raw[i])) || unicode.IsDigit(rune(raw[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: "word", text: raw[start:i]})
+		default:
+			return nil, fmt.Errorf("%w: unexpected character %q in $filter", utils.ErrInvalidInput, c)
+		}
+	}
+
+	return tokens, nil
+}
+
+// parseValue reads an unquoted number or ISO 8601 timestamp
+func parseValue(text string) (any, error) {
+	if t, err := time.Parse(time.RFC3339, text); err == nil {
+		return t, nil
+	}
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("%w: invalid value %q in $filter", utils.ErrInvalidInput, text)
+}
+
+// Compiler turns a filter into SQL. Columns maps the filterable properties of an entity set to
+// SQL expressions, values become placeholders appended to Args.
+type Compiler struct {
+	Columns map[string]string
+	Args    []any
+}
+
+func (c *Compiler) placeholder(value any) string {
+	c.Args = append(c.Args, value)
+	return fmt.Sprintf("$%d", len(c.Args))
+}
+
+// Column returns the SQL expression of a property
+func (c *Compiler) Column(name string) (string, error) {
+	column, ok := c.Columns[name]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown property %q", utils.ErrInvalidInput, name)
+	}
+	return column, nil
+}
+
+// Compile returns a boolean SQL condition for the filter
+func (c *Compiler) Compile(expr Expr) (string, error) {
+	switch e := expr.(type) {
+	case *Binary:
+		if e.Op == "and" || e.Op == "or" {
+			left, err := c.Compile(e.Left)
+			if err != nil {
+				return "", err
+			}
+			right, err := c.Compile(e.Right)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("(%s %s %s)", left, strings.ToUpper(e.Op), right), nil
+		}
+		return c.compileComparison(e)
+	case *Not:
+		inner, err := c.Compile(e.Expr)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(NOT %s)", inner), nil
+	case *Call:
+		return c.compileCall(e)
+	}
+
+	return "", fmt.Errorf("%w: $filter must be a condition", utils.ErrInvalidInput)
+}
+
+func (c *Compiler) compileComparison(e *Binary) (string, error) {
+	// comparing with null becomes IS NULL / IS NOT NULL
+	for _, pair := range [][2]Expr{{e.Left, e.Right}, {e.Right, e.Left}} {
+		literal, ok := pair[1].(*Literal)
+		if !ok || literal.Value != nil {
+			continue
+		}
+		if e.Op != "eq" && e.Op != "ne" {
+			return "", fmt.Errorf("%w: null can only be compared with eq or ne", utils.ErrInvalidInput)
+		}
+		operand, err := c.operand(pair[0])
+		if err != nil {
+			return "", err
+		}
+		if e.Op == "eq" {
+			return fmt.Sprintf("%s IS NULL", operand), nil
+		}
+		return fmt.Sprintf("%s IS NOT NULL", operand), nil
+	}
+
+	left, err := c.operand(e.Left)
+	if err != nil {
+		return "", err
+	}
+	right, err := c.operand(e.Right)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s %s %s", left, comparisonOperators[e.Op], right), nil
+}
+
+func (c *Compiler) compileCall(e *Call) (string, error) {
+	// substringof takes the needle first, the others take it second
+	haystack, needle := e.Args[0], e.Args[1]
+	if e.Name == "substringof" {
+		haystack, needle = needle, haystack
+	}
+
+	literal, ok := needle.(*Literal)
+	value, isString := "", false
+	if ok {
+		value, isString = literal.Value.(string)
+	}
+	if !isString {
+		return "", fmt.Errorf("%w: %s needs a string literal", utils.ErrInvalidInput, e.Name)
+	}
+
+	column, err := c.operand(haystack)
+	if err != nil {
+		return "", err
+	}
+
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+	switch e.Name {
+	case "substringof":
+		pattern = "%" + pattern + "%"
+	case "startswith":
+		pattern = pattern + "%"
+	case "endswith":
+		pattern = "%" + pattern
+	}
+
+	return fmt.Sprintf("%s::TEXT LIKE %s", column, c.placeholder(pattern)), nil
+}
+
+func (c *Compiler) operand(expr Expr) (string, error) {
+	switch e := expr.(type) {
+	case *Property:
+		return c.Column(e.Name)
+	case *Literal:
+		return c.placeholder(e.Value), nil
+	}
+	return "", fmt.Errorf("%w: comparisons take a property or a value", utils.ErrInvalidInput)
+}
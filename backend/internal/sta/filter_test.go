@@ -0,0 +1,190 @@
+package sta
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/utils"
+)
+
+var testColumns = map[string]string{
+	"id":              "wl.id",
+	"result":          "wl.level_cm",
+	"phenomenonTime":  "wl.measured_at",
+	"name":            "l.name",
+	"Datastream/name": "l.name",
+}
+
+func TestParseFilterCompile(t *testing.T) {
+	measuredAt := time.Date(2026, 10, 1, 7, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		filter string
+		sql    string
+		args   []any
+	}{
+		{
+			name:   "comparison with an integer",
+			filter: "result gt 120",
+			sql:    "wl.level_cm > $1",
+			args:   []any{int64(120)},
+		},
+		{
+			name:   "operators are case insensitive",
+			filter: "result GE 1.5",
+			sql:    "wl.level_cm >= $1",
+			args:   []any{1.5},
+		},
+		{
+			name:   "iot.id is the id",
+			filter: "@iot.id eq 3",
+			sql:    "wl.id = $1",
+			args:   []any{int64(3)},
+		},
+		{
+			name:   "timestamp literal",
+			filter: "phenomenonTime lt 2026-10-01T07:00:00Z",
+			sql:    "wl.measured_at < $1",
+			args:   []any{measuredAt},
+		},
+		{
+			name:   "and binds tighter than or",
+			filter: "result gt 1 or result lt 2 and id ne 3",
+			sql:    "(wl.level_cm > $1 OR (wl.level_cm < $2 AND wl.id <> $3))",
+			args:   []any{int64(1), int64(2), int64(3)},
+		},
+		{
+			name:   "parentheses and not",
+			filter: "not (result gt 1 or result lt -2)",
+			sql:    "(NOT (wl.level_cm > $1 OR wl.level_cm < $2))",
+			args:   []any{int64(1), int64(-2)},
+		},
+		{
+			name:   "eq null",
+			filter: "name eq null",
+			sql:    "l.name IS NULL",
+		},
+		{
+			name:   "null on the left with ne",
+			filter: "null ne name",
+			sql:    "l.name IS NOT NULL",
+		},
+		{
+			name:   "doubled quote in a string",
+			filter: "name eq 'O''Brien'",
+			sql:    "l.name = $1",
+			args:   []any{"O'Brien"},
+		},
+		{
+			name:   "substringof takes the needle first",
+			filter: "substringof('ping', name)",
+			sql:    "l.name::TEXT LIKE $1",
+			args:   []any{"%ping%"},
+		},
+		{
+			name:   "startswith escapes LIKE wildcards",
+			filter: "startswith(Datastream/name, '50%_')",
+			sql:    "l.name::TEXT LIKE $1",
+			args:   []any{`50\%\_%`},
+		},
+		{
+			name:   "endswith",
+			filter: "endswith(name, 'river')",
+			sql:    "l.name::TEXT LIKE $1",
+			args:   []any{"%river"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("ParseFilter(%q) error = %v", tt.filter, err)
+			}
+
+			compiler := &Compiler{Columns: testColumns}
+			sql, err := compiler.Compile(expr)
+			if err != nil {
+				t.Fatalf("Compile(%q) error = %v", tt.filter, err)
+			}
+			if sql != tt.sql {
+				t.Errorf("Compile(%q) = %q, want %q", tt.filter, sql, tt.sql)
+			}
+			if len(compiler.Args) != len(tt.args) || (len(tt.args) > 0 && !reflect.DeepEqual(compiler.Args, tt.args)) {
+				t.Errorf("Compile(%q) args = %#v, want %#v", tt.filter, compiler.Args, tt.args)
+			}
+		})
+	}
+}
+
+func TestParseFilterMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+	}{
+		{name: "empty", filter: ""},
+		{name: "only spaces", filter: "   "},
+		{name: "unterminated string", filter: "name eq 'abc"},
+		{name: "missing right operand", filter: "result gt"},
+		{name: "dangling and", filter: "result gt 1 and"},
+		{name: "unbalanced open parenthesis", filter: "(result gt 1"},
+		{name: "unbalanced close parenthesis", filter: "result gt 1)"},
+		{name: "two comparisons without a logical operator", filter: "result gt 1 result lt 2"},
+		{name: "unknown function", filter: "tolower(name) eq 'a'"},
+		{name: "function with one argument", filter: "startswith(name)"},
+		{name: "function with three arguments", filter: "endswith(name, 'a', 'b')"},
+		{name: "unclosed function call", filter: "startswith(name, 'a'"},
+		{name: "invalid number", filter: "result gt 12abc"},
+		{name: "lone minus", filter: "result gt -"},
+		{name: "unexpected character", filter: "result > 1"},
+		{name: "comma outside a call", filter: "result gt 1, 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := ParseFilter(tt.filter)
+			if err == nil {
+				t.Fatalf("ParseFilter(%q) = %#v, want an error", tt.filter, expr)
+			}
+			if !errors.Is(err, utils.ErrInvalidInput) {
+				t.Errorf("ParseFilter(%q) error = %v, want ErrInvalidInput", tt.filter, err)
+			}
+		})
+	}
+}
+
+func TestCompileRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+	}{
+		{name: "unknown property", filter: "color eq 'red'"},
+		{name: "bare property", filter: "name"},
+		{name: "bare literal", filter: "true"},
+		{name: "null with an ordering operator", filter: "result gt null"},
+		{name: "string function with a property needle", filter: "startswith(name, name)"},
+		{name: "string function with a number needle", filter: "endswith(name, 5)"},
+		{name: "comparison of a condition", filter: "(result gt 1) eq true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("ParseFilter(%q) error = %v", tt.filter, err)
+			}
+
+			compiler := &Compiler{Columns: testColumns}
+			sql, err := compiler.Compile(expr)
+			if err == nil {
+				t.Fatalf("Compile(%q) = %q, want an error", tt.filter, sql)
+			}
+			if !errors.Is(err, utils.ErrInvalidInput) {
+				t.Errorf("Compile(%q) error = %v, want ErrInvalidInput", tt.filter, err)
+			}
+		})
+	}
+}
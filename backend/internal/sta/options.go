@@ -0,0 +1,243 @@
+// Package sta parses the OGC SensorThings API query options ($filter, $orderby, $top, $skip,
+// $count and $expand) and compiles them into SQL fragments over whitelisted columns.
+package sta
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/guatom999/self-boardcast/internal/utils"
+)
+
+const (
+	DefaultTop = 100
+	MaxTop     = 1000
+)
+
+type Options struct {
+	Top     int
+	Skip    int
+	Count   bool
+	OrderBy []OrderBy
+	Filter  Expr
+	Expand  []*Expand
+}
+
+type OrderBy struct {
+	Property string
+	Desc     bool
+}
+
+// Expand is one navigation property of $expand with its own nested options
+type Expand struct {
+	Name    string
+	Options *Options
+}
+
+// ParseQuery splits a raw query string on & only. url.ParseQuery rejects the semicolons that
+// separate the nested options of $expand, e.g. $expand=Observations($top=1;$orderby=id desc).
+func ParseQuery(rawQuery string) (url.Values, error) {
+	values := url.Values{}
+
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+
+		key, err := url.QueryUnescape(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid query string", utils.ErrInvalidInput)
+		}
+		value, err = url.QueryUnescape(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid query string", utils.ErrInvalidInput)
+		}
+		values.Add(key, value)
+	}
+
+	return values, nil
+}
+
+// ParseOptions reads the query options of a request
+func ParseOptions(values url.Values) (*Options, error) {
+	raw := make(map[string]string)
+	for key := range values {
+		raw[key] = values.Get(key)
+	}
+	return parseOptions(raw)
+}
+
+func parseOptions(raw map[string]string) (*Options, error) {
+	opts := &Options{Top: DefaultTop}
+
+	if value, ok := raw["$top"]; ok {
+		top, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || top < 0 {
+			return nil, fmt.Errorf("%w: $top must be a non-negative integer", utils.ErrInvalidInput)
+		}
+		opts.Top = min(top, MaxTop)
+	}
+
+	if value, ok := raw["$skip"]; ok {
+		skip, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || skip < 0 {
+			return nil, fmt.Errorf("%w: $skip must be a non-negative integer", utils.ErrInvalidInput)
+		}
+		opts.Skip = skip
+	}
+
+	if value, ok := raw["$count"]; ok {
+		switch strings.TrimSpace(value) {
+		case "true":
+			opts.Count = true
+		case "false":
+		default:
+			return nil, fmt.Errorf("%w: $count must be true or false", utils.ErrInvalidInput)
+		}
+	}
+
+	if value, ok := raw["$orderby"]; ok {
+		orderBy, err := parseOrderBy(value)
+		if err != nil {
+			return nil, err
+		}
+		opts.OrderBy = orderBy
+	}
+
+	if value, ok := raw["$filter"]; ok && strings.TrimSpace(value) != "" {
+		filter, err := ParseFilter(value)
+		if err != nil {
+			return nil, err
+		}
+		opts.Filter = filter
+	}
+
+	if value, ok := raw["$expand"]; ok && strings.TrimSpace(value) != "" {
+		expand, err := parseExpand(value)
+		if err != nil {
+			return nil, err
+		}
+		opts.Expand = expand
+	}
+
+	return opts, nil
+}
+
+func parseOrderBy(raw string) ([]OrderBy, error) {
+	result := make([]OrderBy, 0)
+
+	for _, part := range strings.Split(raw, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("%w: invalid $orderby %q", utils.ErrInvalidInput, part)
+		}
+
+		order := OrderBy{Property: normalizeProperty(fields[0])}
+		if len(fields) == 2 {
+			switch strings.ToLower(fields[1]) {
+			case "asc":
+			case "desc":
+				order.Desc = true
+			default:
+				return nil, fmt.Errorf("%w: $orderby direction must be asc or desc", utils.ErrInvalidInput)
+			}
+		}
+		result = append(result, order)
+	}
+
+	return result, nil
+}
+
+// parseExpand reads "Datastreams($top=1;$expand=Observations),Locations" and the path form "Datastreams/Observations"
+func parseExpand(raw string) ([]*Expand, error) {
+	result := make([]*Expand, 0)
+
+	for _, item := range splitTopLevel(raw, ',') {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return nil, fmt.Errorf("%w: empty $expand item", utils.ErrInvalidInput)
+		}
+
+		expand, err := parseExpandItem(item)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, expand)
+	}
+
+	return result, nil
+}
+
+func parseExpandItem(item string) (*Expand, error) {
+	name := item
+	nested := ""
+
+	// a path splits at the first slash outside parentheses
+	if parts := splitTopLevel(item, '/'); len(parts) > 1 {
+		name = parts[0]
+		nested = strings.Join(parts[1:], "/")
+	}
+
+	raw := make(map[string]string)
+	if open := strings.IndexByte(name, '('); open >= 0 {
+		if !strings.HasSuffix(name, ")") {
+			return nil, fmt.Errorf("%w: unbalanced parentheses in $expand", utils.ErrInvalidInput)
+		}
+		for _, option := range splitTopLevel(name[open+1:len(name)-1], ';') {
+			key, value, ok := strings.Cut(option, "=")
+			if !ok {
+				return nil, fmt.Errorf("%w: invalid $expand option %q", utils.ErrInvalidInput, option)
+			}
+			raw[strings.TrimSpace(key)] = value
+		}
+		name = name[:open]
+	}
+
+	if nested != "" {
+		if existing, ok := raw["$expand"]; ok {
+			raw["$expand"] = existing + "," + nested
+		} else {
+			raw["$expand"] = nested
+		}
+	}
+
+	opts, err := parseOptions(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Expand{Name: strings.TrimSpace(name), Options: opts}, nil
+}
+
+// splitTopLevel splits on sep outside parentheses and quoted strings
+func splitTopLevel(raw string, sep byte) []string {
+	parts := make([]string, 0)
+	depth := 0
+	quoted := false
+	start := 0
+
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, raw[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, raw[start:])
+}
+
+// normalizeProperty accepts "@iot.id" wherever "id" is meant
+func normalizeProperty(name string) string {
+	return strings.ReplaceAll(name, "@iot.id", "id")
+}
@@ -2,11 +2,20 @@ package tasks
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
 	"time"
 
 	"github.com/hibiken/asynq"
 )
 
+const (
+	deliveryMaxRetry  = 8
+	deliveryBaseDelay = 30 * time.Second
+	deliveryMaxDelay  = time.Hour
+)
+
 type NotificationProducer struct {
 	client *asynq.Client
 }
@@ -35,3 +44,183 @@ func (p *NotificationProducer) EnqueueWaterAlert(payload WaterAlertPayload) erro
 	_, err = p.client.Enqueue(task)
 	return err
 }
+
+// EnqueueRapidRise queues at most one rapid rise alert per location and rise window, a rise
+// that lasts several ingest runs is not alerted again until the next window
+func (p *NotificationProducer) EnqueueRapidRise(payload RapidRisePayload, window time.Duration) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	bucket := time.Now().Truncate(window).Unix()
+	task := asynq.NewTask(TypeRapidRise, data,
+		asynq.MaxRetry(3),
+		asynq.Queue("notifications"),
+		asynq.Timeout(30*time.Second),
+		asynq.TaskID(fmt.Sprintf("rapid_rise:%d:%d", payload.LocationID, bucket)),
+		asynq.Retention(window),
+	)
+
+	_, err = p.client.Enqueue(task)
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		return nil
+	}
+	return err
+}
+
+// EnqueueNotificationDelivery sends a notification to one channel again
+func (p *NotificationProducer) EnqueueNotificationDelivery(payload NotificationDeliveryPayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.client.Enqueue(asynq.NewTask(TypeNotificationDelivery, data, deliveryOptions()...))
+	return err
+}
+
+// EnqueueDigest queues the digest of one subscription. The task id holds the period and its end
+// date, a digest run that is repeated the same day does not send it twice.
+func (p *NotificationProducer) EnqueueDigest(subscriptionID int64, notification *Notification, period string, date string) error {
+	channel := subscriptionChannel(subscriptionID)
+
+	data, err := json.Marshal(NotificationDeliveryPayload{Channel: channel, Notification: notification})
+	if err != nil {
+		return err
+	}
+
+	opts := append(deliveryOptions(), asynq.TaskID(fmt.Sprintf("digest:%s:%s:%s", period, date, channel)))
+
+	_, err = p.client.Enqueue(asynq.NewTask(TypeNotificationDelivery, data, opts...))
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		return nil
+	}
+	return err
+}
+
+// deliveryOptions are shared by every delivery task, the delay between retries is DeliveryRetryDelay
+func deliveryOptions() []asynq.Option {
+	return []asynq.Option{
+		asynq.MaxRetry(deliveryMaxRetry),
+		asynq.Queue("notifications"),
+		asynq.Timeout(30 * time.Second),
+		asynq.Retention(24 * time.Hour),
+	}
+}
+
+// DeliveryRetryDelay backs off exponentially from 30 seconds up to an hour, with up to 20% jitter
+// so receivers coming back up are not hit by every pending retry at once
+func DeliveryRetryDelay(n int) time.Duration {
+	delay := deliveryMaxDelay
+	if n < 8 {
+		delay = min(deliveryBaseDelay<<n, deliveryMaxDelay)
+	}
+	return delay + time.Duration(rand.Int64N(int64(delay/5)+1))
+}
+
+type ExportProducer struct {
+	client *asynq.Client
+}
+
+func NewExportProducer(redisAddr string) *ExportProducer {
+	client := asynq.NewClient(asynq.RedisClientOpt{Addr: redisAddr})
+	return &ExportProducer{client: client}
+}
+
+func (p *ExportProducer) Close() error {
+	return p.client.Close()
+}
+
+func (p *ExportProducer) EnqueueReadingsExport(payload ReadingsExportPayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	task := asynq.NewTask(TypeReadingsExport, data,
+		asynq.MaxRetry(2),
+		asynq.Queue("exports"),
+		asynq.Timeout(30*time.Minute),
+	)
+
+	_, err = p.client.Enqueue(task)
+	return err
+}
+
+type ImageProducer struct {
+	client *asynq.Client
+}
+
+func NewImageProducer(redisAddr string) *ImageProducer {
+	client := asynq.NewClient(asynq.RedisClientOpt{Addr: redisAddr})
+	return &ImageProducer{client: client}
+}
+
+func (p *ImageProducer) Close() error {
+	return p.client.Close()
+}
+
+// EnqueueCapture queues at most one capture per location and interval, a capture still waiting
+// when the next cron run fires is not queued twice
+func (p *ImageProducer) EnqueueCapture(payload ImageCapturePayload, interval time.Duration) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	bucket := time.Now().Truncate(interval).Unix()
+	task := asynq.NewTask(TypeImageCapture, data,
+		asynq.MaxRetry(2),
+		asynq.Queue("images"),
+		asynq.Timeout(60*time.Second),
+		asynq.TaskID(fmt.Sprintf("capture:%d:%d", payload.LocationID, bucket)),
+		asynq.Retention(interval),
+	)
+
+	_, err = p.client.Enqueue(task)
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		return nil
+	}
+	return err
+}
+
+// EnqueuePredict queues the prediction of a pending reading, once per pending reading
+func (p *ImageProducer) EnqueuePredict(payload ImagePredictPayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	task := asynq.NewTask(TypeImagePredict, data,
+		asynq.MaxRetry(3),
+		asynq.Queue("images"),
+		asynq.Timeout(90*time.Second),
+		asynq.TaskID(fmt.Sprintf("predict:%d", payload.PendingReadingID)),
+	)
+
+	_, err = p.client.Enqueue(task)
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		return nil
+	}
+	return err
+}
+
+// EnqueuePredictBatch queues a batch prediction, the task id is the report name so a request that
+// is sent twice writes one report
+func (p *ImageProducer) EnqueuePredictBatch(payload ImagePredictBatchPayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	task := asynq.NewTask(TypeImagePredictBatch, data,
+		asynq.MaxRetry(1),
+		asynq.Queue("images"),
+		asynq.Timeout(2*time.Hour),
+		asynq.TaskID(payload.Name),
+	)
+
+	_, err = p.client.Enqueue(task)
+	return err
+}
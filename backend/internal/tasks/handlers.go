@@ -2,15 +2,47 @@ package tasks
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/guatom999/self-boardcast/internal/models"
+	"github.com/guatom999/self-boardcast/internal/repositories"
+	"github.com/guatom999/self-boardcast/internal/services"
 	"github.com/guatom999/self-boardcast/internal/utils"
 	"github.com/hibiken/asynq"
 )
 
-func HandleWaterAlert(ctx context.Context, t *asynq.Task) error {
+// NotificationTaskHandler fans every alert out to the configured channels. Each channel gets its
+// own delivery task, so a channel that is down retries without resending to the others.
+type NotificationTaskHandler struct {
+	repo             repositories.NotificationRepositoryInterface
+	subscriptionRepo repositories.SubscriptionRepositoryInterface
+	cfg              *config.Config
+	client           *asynq.Client
+}
+
+func NewNotificationTaskHandler(repo repositories.NotificationRepositoryInterface, subscriptionRepo repositories.SubscriptionRepositoryInterface, cfg *config.Config) *NotificationTaskHandler {
+	return &NotificationTaskHandler{
+		repo:             repo,
+		subscriptionRepo: subscriptionRepo,
+		cfg:              cfg,
+		client:           asynq.NewClient(asynq.RedisClientOpt{Addr: cfg.Redis.Addr}),
+	}
+}
+
+func (h *NotificationTaskHandler) Close() error {
+	return h.client.Close()
+}
+
+func (h *NotificationTaskHandler) HandleWaterAlert(ctx context.Context, t *asynq.Task) error {
 	var payload WaterAlertPayload
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
 		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
@@ -18,10 +50,380 @@ func HandleWaterAlert(ctx context.Context, t *asynq.Task) error {
 
 	log.Printf("[WORKER] Processing alert for %s (LocationID: %d)", payload.LocationName, payload.LocationID)
 
-	if err := utils.HttpPostJSON("http://badzboss-n8n.duckdns.org:5678/webhook-test/da1f7e4e-9927-4b87-b2bb-8295604937b8", payload); err != nil {
-		return fmt.Errorf("failed to post JSON: %v: %w", err, asynq.SkipRetry)
+	// a resolved alert reaches the subscribers of the danger it resolved from
+	danger := payload.Danger
+	if payload.AlertEvent == "RESOLVED" && payload.PreviousDanger != "" {
+		danger = payload.PreviousDanger
 	}
 
-	log.Printf("[WORKER] Notification sent successfully for %s", payload.LocationName)
+	return h.fanOut(ctx, int64(payload.LocationID), danger, &Notification{
+		Event: TypeWaterAlert,
+		Title: fmt.Sprintf("[%s] %s", payload.Danger, payload.LocationName),
+		Text:  waterAlertText(&payload),
+		Data:  t.Payload(),
+	})
+}
+
+func (h *NotificationTaskHandler) HandleRapidRise(ctx context.Context, t *asynq.Task) error {
+	var payload RapidRisePayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	log.Printf("[WORKER] Processing rapid rise for %s (LocationID: %d, %.2f cm/h)", payload.LocationName, payload.LocationID, payload.RiseRateCmPerHour)
+
+	// a rapid rise usually starts while the level is SAFE, subscribers see it as a WATCH
+	danger := payload.Danger
+	if danger == "" || danger == "SAFE" {
+		danger = "WATCH"
+	}
+
+	return h.fanOut(ctx, payload.LocationID, danger, &Notification{
+		Event: TypeRapidRise,
+		Title: fmt.Sprintf("[RAPID RISE] %s", payload.LocationName),
+		Text:  rapidRiseText(&payload),
+		Data:  t.Payload(),
+	})
+}
+
+// fanOut enqueues one delivery per channel and per subscriber of the location at that danger.
+// The delivery ids derive from the alert task id, so when the fan-out itself is retried the
+// recipients already enqueued are not sent twice.
+func (h *NotificationTaskHandler) fanOut(ctx context.Context, locationID int64, danger string, notification *Notification) error {
+	channels, err := h.channels(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load notification channels: %w", err)
+	}
+
+	recipients := make([]string, 0, len(channels))
+	for name := range channels {
+		recipients = append(recipients, name)
+	}
+
+	subscribers, err := h.subscriptionRepo.FindSubscribers(ctx, locationID, danger)
+	if err != nil {
+		return fmt.Errorf("failed to find subscribers: %w", err)
+	}
+
+	now := time.Now().In(bangkok)
+	for _, subscription := range subscribers {
+		// critical alerts wake people up
+		if danger != "CRITICAL" && inQuietHours(subscription, now) {
+			continue
+		}
+		recipients = append(recipients, subscriptionChannel(subscription.ID))
+	}
+
+	if len(recipients) == 0 {
+		log.Printf("[WORKER] No channel or subscriber for %s at location %d", notification.Event, locationID)
+		return nil
+	}
+
+	parentID, _ := asynq.GetTaskID(ctx)
+
+	var failed error
+	for _, name := range recipients {
+		data, err := json.Marshal(NotificationDeliveryPayload{Channel: name, Notification: notification})
+		if err != nil {
+			return err
+		}
+
+		opts := deliveryOptions()
+		if parentID != "" {
+			opts = append(opts, asynq.TaskID(parentID+":"+name))
+		}
+
+		if _, err := h.client.EnqueueContext(ctx, asynq.NewTask(TypeNotificationDelivery, data, opts...)); err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+			log.Printf("[WORKER] Failed to enqueue delivery to %s: %v", name, err)
+			failed = err
+		}
+	}
+
+	return failed
+}
+
+func (h *NotificationTaskHandler) HandleDelivery(ctx context.Context, t *asynq.Task) error {
+	var payload NotificationDeliveryPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	notifier, err := h.notifier(ctx, payload.Channel)
+	if err != nil {
+		return err
+	}
+
+	if webhook, ok := notifier.(*WebhookNotifier); ok {
+		return h.deliverWebhook(ctx, webhook, &payload)
+	}
+
+	if err := notifier.Notify(ctx, payload.Notification); err != nil {
+		return fmt.Errorf("failed to notify %s: %w", payload.Channel, err)
+	}
+
+	log.Printf("[WORKER] %s sent to %s", payload.Notification.Event, payload.Channel)
+	return nil
+}
+
+// deliverWebhook sends a webhook and logs the attempt in webhook_deliveries. The last attempt of a
+// delivery is marked final, failed final attempts are listed for replay.
+func (h *NotificationTaskHandler) deliverWebhook(ctx context.Context, webhook *WebhookNotifier, payload *NotificationDeliveryPayload) error {
+	deliveryID, _ := asynq.GetTaskID(ctx)
+	retry, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+
+	code, latency, sendErr := webhook.Deliver(ctx, payload.Notification, deliveryID)
+
+	notification, err := json.Marshal(payload.Notification)
+	if err != nil {
+		return err
+	}
+
+	delivery := &entities.WebhookDelivery{
+		DeliveryID:   deliveryID,
+		Channel:      payload.Channel,
+		Event:        payload.Notification.Event,
+		URL:          webhook.URL,
+		Notification: notification,
+		Attempt:      retry + 1,
+		StatusCode:   sql.NullInt32{Int32: int32(code), Valid: code != 0},
+		LatencyMs:    int(latency.Milliseconds()),
+		Succeeded:    sendErr == nil,
+		Final:        sendErr == nil || errors.Is(sendErr, asynq.SkipRetry) || retry >= maxRetry,
+		ReplayOf:     sql.NullInt64{Int64: payload.ReplayOf, Valid: payload.ReplayOf != 0},
+	}
+	if sendErr != nil {
+		delivery.Error = sql.NullString{String: sendErr.Error(), Valid: true}
+	}
+
+	// the log is best effort, it must not make a delivered webhook retry
+	if err := h.repo.CreateWebhookDelivery(ctx, delivery); err != nil {
+		log.Printf("[WORKER] Failed to log webhook delivery %s: %v", deliveryID, err)
+	}
+
+	if sendErr != nil {
+		return fmt.Errorf("failed to notify %s: %w", payload.Channel, sendErr)
+	}
+
+	log.Printf("[WORKER] %s sent to %s (%d, %s)", payload.Notification.Event, payload.Channel, code, latency)
+	return nil
+}
+
+// notifier resolves the recipient of a delivery, a recipient that is gone is not retried
+func (h *NotificationTaskHandler) notifier(ctx context.Context, name string) (Notifier, error) {
+	if raw, ok := strings.CutPrefix(name, subscriptionChannelPrefix); ok {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %s: %w", name, asynq.SkipRetry)
+		}
+
+		subscription, err := h.subscriptionRepo.GetByID(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load subscription %d: %w", id, err)
+		}
+		if subscription == nil || !subscription.IsActive {
+			return nil, fmt.Errorf("subscription %d is gone: %w", id, asynq.SkipRetry)
+		}
+
+		notifier, err := NewSubscriptionNotifier(subscription, h.cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+		}
+		return notifier, nil
+	}
+
+	channels, err := h.channels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load notification channels: %w", err)
+	}
+
+	notifier, ok := channels[name]
+	if !ok {
+		return nil, fmt.Errorf("notification channel %s is gone: %w", name, asynq.SkipRetry)
+	}
+	return notifier, nil
+}
+
+// channels returns the configured and the active stored channels. Stored channels with a broken
+// config are skipped, they would never succeed.
+func (h *NotificationTaskHandler) channels(ctx context.Context) (map[string]Notifier, error) {
+	result := ConfigNotifiers(h.cfg)
+
+	stored, err := h.repo.GetActiveChannels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, channel := range stored {
+		notifier, err := NewNotifier(channel, h.cfg)
+		if err != nil {
+			log.Printf("[WORKER] Skipping notification channel: %v", err)
+			continue
+		}
+		result[channel.Name] = notifier
+	}
+
+	return result, nil
+}
+
+func waterAlertText(p *WaterAlertPayload) string {
+	var b strings.Builder
+
+	switch p.AlertEvent {
+	case "RESOLVED":
+		fmt.Fprintf(&b, "Back to normal, water level %.2f cm", p.WaterLevel)
+	case "ESCALATED", "DEESCALATED":
+		fmt.Fprintf(&b, "%s → %s, water level %.2f cm", p.PreviousDanger, p.Danger, p.WaterLevel)
+	default:
+		fmt.Fprintf(&b, "%s, water level %.2f cm", p.Danger, p.WaterLevel)
+	}
+	fmt.Fprintf(&b, " at %s", p.MeasuredAt)
+
+	if p.Forecast != nil && p.Forecast.HoursToBankLevel != nil {
+		fmt.Fprintf(&b, "\nBank level expected in %.1f hours", *p.Forecast.HoursToBankLevel)
+	}
+
+	return b.String()
+}
+
+func rapidRiseText(p *RapidRisePayload) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Rising %.2f cm/h over the last %d minutes (limit %.2f cm/h)", p.RiseRateCmPerHour, p.WindowMinutes, p.RiseLimitCmPerHour)
+	fmt.Fprintf(&b, "\n%s, water level %.2f cm at %s", p.Danger, p.WaterLevel, p.MeasuredAt)
+
+	if p.Forecast != nil && p.Forecast.HoursToBankLevel != nil {
+		fmt.Fprintf(&b, "\nBank level expected in %.1f hours", *p.Forecast.HoursToBankLevel)
+	}
+
+	return b.String()
+}
+
+type ExportTaskHandler struct {
+	service services.ExportServiceInterface
+}
+
+func NewExportTaskHandler(service services.ExportServiceInterface) *ExportTaskHandler {
+	return &ExportTaskHandler{service: service}
+}
+
+func (h *ExportTaskHandler) HandleReadingsExport(ctx context.Context, t *asynq.Task) error {
+	var payload ReadingsExportPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	log.Printf("[WORKER] Processing readings export %d", payload.ExportID)
+
+	if err := h.service.RunExport(ctx, payload.ExportID); err != nil {
+		if errors.Is(err, services.ErrExportNotFound) {
+			return fmt.Errorf("export %d: %v: %w", payload.ExportID, err, asynq.SkipRetry)
+		}
+		return fmt.Errorf("failed to run export %d: %w", payload.ExportID, err)
+	}
+
+	log.Printf("[WORKER] Readings export %d done", payload.ExportID)
+	return nil
+}
+
+type ImageTaskHandler struct {
+	service  services.PredictionServiceInterface
+	producer *ImageProducer
+}
+
+func NewImageTaskHandler(service services.PredictionServiceInterface, producer *ImageProducer) *ImageTaskHandler {
+	return &ImageTaskHandler{service: service, producer: producer}
+}
+
+func (h *ImageTaskHandler) HandleCapture(ctx context.Context, t *asynq.Task) error {
+	var payload ImageCapturePayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	log.Printf("[WORKER] Capturing image of location %d", payload.LocationID)
+
+	pendingID, err := h.service.CaptureImage(ctx, payload.LocationID)
+	if err != nil {
+		if errors.Is(err, services.ErrLocationNotFound) {
+			return fmt.Errorf("location %d: %v: %w", payload.LocationID, err, asynq.SkipRetry)
+		}
+		return fmt.Errorf("failed to capture image of location %d: %w", payload.LocationID, err)
+	}
+
+	// the capture is stored, a failed enqueue must not take a second picture
+	if err := h.producer.EnqueuePredict(ImagePredictPayload{PendingReadingID: pendingID}); err != nil {
+		log.Printf("[WORKER] Failed to enqueue prediction of pending reading %d: %v", pendingID, err)
+	}
+
+	return nil
+}
+
+func (h *ImageTaskHandler) HandlePredict(ctx context.Context, t *asynq.Task) error {
+	var payload ImagePredictPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	result, err := h.service.PredictReading(ctx, payload.PendingReadingID)
+	if err != nil {
+		if errors.Is(err, services.ErrPendingReadingNotFound) {
+			return fmt.Errorf("pending reading %d: %v: %w", payload.PendingReadingID, err, asynq.SkipRetry)
+		}
+
+		retry, _ := asynq.GetRetryCount(ctx)
+		maxRetry, _ := asynq.GetMaxRetry(ctx)
+		if retry >= maxRetry {
+			if failErr := h.service.FailPendingReading(ctx, payload.PendingReadingID, err.Error()); failErr != nil {
+				log.Printf("[WORKER] Failed to mark pending reading %d as failed: %v", payload.PendingReadingID, failErr)
+			}
+		}
+		return fmt.Errorf("failed to predict pending reading %d: %w", payload.PendingReadingID, err)
+	}
+
+	if result == nil {
+		log.Printf("[WORKER] Pending reading %d was already processed", payload.PendingReadingID)
+		return nil
+	}
+
+	log.Printf("[WORKER] Pending reading %d: %s is %.2f cm", payload.PendingReadingID, result.FileName, result.WaterLevel)
+	return nil
+}
+
+type BatchPredictionTaskHandler struct {
+	service services.BatchPredictionServiceInterface
+}
+
+func NewBatchPredictionTaskHandler(service services.BatchPredictionServiceInterface) *BatchPredictionTaskHandler {
+	return &BatchPredictionTaskHandler{service: service}
+}
+
+func (h *BatchPredictionTaskHandler) HandlePredictBatch(ctx context.Context, t *asynq.Task) error {
+	var payload ImagePredictBatchPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	log.Printf("[WORKER] Processing batch prediction %s of %q", payload.Name, payload.Dir)
+
+	report, err := h.service.RunBatchJob(ctx, &models.BatchPredictionJobReq{
+		Dir:           payload.Dir,
+		LocationID:    payload.LocationID,
+		MaxGapMinutes: payload.MaxGapMinutes,
+		Concurrency:   payload.Concurrency,
+	}, payload.Name)
+	if err != nil {
+		if errors.Is(err, utils.ErrInvalidInput) {
+			return fmt.Errorf("batch prediction %s: %v: %w", payload.Name, err, asynq.SkipRetry)
+		}
+		return fmt.Errorf("failed to run batch prediction %s: %w", payload.Name, err)
+	}
+
+	log.Printf("[WORKER] Batch prediction %s done: images=%d compared=%d failed=%d skipped=%d",
+		payload.Name, report.Images, report.Compared, report.Failed, report.Skipped)
+	for _, stat := range report.Locations {
+		log.Printf("[WORKER] Batch prediction %s location %d: compared=%d mae=%.3f rmse=%.3f",
+			payload.Name, stat.LocationID, stat.Compared, stat.MAE, stat.RMSE)
+	}
 	return nil
 }
@@ -0,0 +1,464 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/config"
+	"github.com/guatom999/self-boardcast/internal/entities"
+	"github.com/guatom999/self-boardcast/internal/utils"
+	"github.com/hibiken/asynq"
+)
+
+// Channel types, also the values of notification_channels.type
+const (
+	ChannelWebhook  = "webhook"
+	ChannelEmail    = "email"
+	ChannelLine     = "line"
+	ChannelTelegram = "telegram"
+	ChannelSlack    = "slack"
+)
+
+const notifierTimeout = 15 * time.Second
+
+// publicClient posts to the URLs subscribers chose, which must not reach the internal network.
+// Channels configured by admins may point to internal receivers and use http.DefaultClient.
+var publicClient = utils.PublicHTTPClient(notifierTimeout)
+
+// bangkok is the zone quiet hours are written in
+var bangkok = func() *time.Location {
+	loc, err := time.LoadLocation("Asia/Bangkok")
+	if err != nil {
+		return time.FixedZone("ICT", 7*60*60)
+	}
+	return loc
+}()
+
+// Notification is one message fanned out to every channel. Webhooks receive Data, the original
+// task payload, chat and email channels receive Title and Text. Email also carries HTML when set.
+type Notification struct {
+	Event string          `json:"event"`
+	Title string          `json:"title"`
+	Text  string          `json:"text"`
+	HTML  string          `json:"html,omitempty"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Notifier delivers a notification to one channel. An error makes the delivery task retry.
+type Notifier interface {
+	Notify(ctx context.Context, n *Notification) error
+}
+
+// NewNotifier builds the notifier of a channel stored in notification_channels. Email channels
+// use the SMTP server of the configuration.
+func NewNotifier(channel *entities.NotificationChannel, cfg *config.Config) (Notifier, error) {
+	decode := func(v any) error {
+		if err := json.Unmarshal(channel.Config, v); err != nil {
+			return fmt.Errorf("invalid config of channel %s: %w", channel.Name, err)
+		}
+		return nil
+	}
+
+	switch channel.Type {
+	case ChannelWebhook:
+		n := &WebhookNotifier{}
+		if err := decode(n); err != nil {
+			return nil, err
+		}
+		if n.URL == "" {
+			return nil, fmt.Errorf("channel %s: url is required", channel.Name)
+		}
+		if n.Secret == "" {
+			n.Secret = cfg.Notify.WebhookSecret
+		}
+		return n, nil
+	case ChannelEmail:
+		var c struct {
+			To []string `json:"to"`
+		}
+		if err := decode(&c); err != nil {
+			return nil, err
+		}
+		if cfg.Notify.SMTPHost == "" || len(c.To) == 0 {
+			return nil, fmt.Errorf("channel %s: SMTP_HOST and to are required", channel.Name)
+		}
+		return newEmailNotifier(cfg, c.To), nil
+	case ChannelLine:
+		n := &LineNotifier{}
+		if err := decode(n); err != nil {
+			return nil, err
+		}
+		if n.Token == "" || n.To == "" {
+			return nil, fmt.Errorf("channel %s: token and to are required", channel.Name)
+		}
+		return n, nil
+	case ChannelTelegram:
+		n := &TelegramNotifier{}
+		if err := decode(n); err != nil {
+			return nil, err
+		}
+		if n.Token == "" || n.ChatID == "" {
+			return nil, fmt.Errorf("channel %s: token and chat_id are required", channel.Name)
+		}
+		return n, nil
+	case ChannelSlack:
+		n := &SlackNotifier{}
+		if err := decode(n); err != nil {
+			return nil, err
+		}
+		if n.URL == "" {
+			return nil, fmt.Errorf("channel %s: url is required", channel.Name)
+		}
+		return n, nil
+	}
+
+	return nil, fmt.Errorf("channel %s: unknown type %q", channel.Name, channel.Type)
+}
+
+// ConfigNotifiers returns the channels enabled in the configuration, keyed by channel name
+func ConfigNotifiers(cfg *config.Config) map[string]Notifier {
+	result := make(map[string]Notifier)
+	c := cfg.Notify
+
+	if c.WebhookURL != "" {
+		result["config:"+ChannelWebhook] = &WebhookNotifier{URL: c.WebhookURL, Secret: c.WebhookSecret}
+	}
+	if c.SMTPHost != "" && len(c.EmailTo) > 0 {
+		result["config:"+ChannelEmail] = newEmailNotifier(cfg, c.EmailTo)
+	}
+	if c.LineToken != "" && c.LineTo != "" {
+		result["config:"+ChannelLine] = &LineNotifier{Token: c.LineToken, To: c.LineTo}
+	}
+	if c.TelegramBotToken != "" && c.TelegramChatID != "" {
+		result["config:"+ChannelTelegram] = &TelegramNotifier{Token: c.TelegramBotToken, ChatID: c.TelegramChatID}
+	}
+	if c.SlackWebhookURL != "" {
+		result["config:"+ChannelSlack] = &SlackNotifier{URL: c.SlackWebhookURL}
+	}
+
+	return result
+}
+
+const subscriptionChannelPrefix = "subscription:"
+
+func subscriptionChannel(id int64) string {
+	return subscriptionChannelPrefix + strconv.FormatInt(id, 10)
+}
+
+// NewSubscriptionNotifier reaches a subscriber on their channel. The subscription holds the
+// recipient, the bot tokens and SMTP server come from the configuration. Webhooks are signed with
+// the secret of the subscription and, like Slack URLs, only reach public addresses.
+func NewSubscriptionNotifier(subscription *entities.Subscription, cfg *config.Config) (Notifier, error) {
+	c := cfg.Notify
+
+	switch subscription.Channel {
+	case ChannelWebhook:
+		return &WebhookNotifier{URL: subscription.Target, Secret: subscription.Secret.String, client: publicClient}, nil
+	case ChannelSlack:
+		return &SlackNotifier{URL: subscription.Target, client: publicClient}, nil
+	case ChannelEmail:
+		if c.SMTPHost == "" {
+			return nil, fmt.Errorf("subscription %d: SMTP_HOST is not configured", subscription.ID)
+		}
+		return newEmailNotifier(cfg, []string{subscription.Target}), nil
+	case ChannelLine:
+		if c.LineToken == "" {
+			return nil, fmt.Errorf("subscription %d: LINE_CHANNEL_TOKEN is not configured", subscription.ID)
+		}
+		return &LineNotifier{Token: c.LineToken, To: subscription.Target}, nil
+	case ChannelTelegram:
+		if c.TelegramBotToken == "" {
+			return nil, fmt.Errorf("subscription %d: TELEGRAM_BOT_TOKEN is not configured", subscription.ID)
+		}
+		return &TelegramNotifier{Token: c.TelegramBotToken, ChatID: subscription.Target}, nil
+	}
+
+	return nil, fmt.Errorf("subscription %d: unknown channel %q", subscription.ID, subscription.Channel)
+}
+
+// inQuietHours reports whether now, in Asia/Bangkok, falls in the quiet hours of a subscription.
+// A range whose end is before its start wraps midnight.
+func inQuietHours(subscription *entities.Subscription, now time.Time) bool {
+	if !subscription.QuietStart.Valid || !subscription.QuietEnd.Valid {
+		return false
+	}
+
+	start, okStart := minuteOfDay(subscription.QuietStart.String)
+	end, okEnd := minuteOfDay(subscription.QuietEnd.String)
+	if !okStart || !okEnd || start == end {
+		return false
+	}
+
+	current := now.Hour()*60 + now.Minute()
+	if start < end {
+		return current >= start && current < end
+	}
+	return current >= start || current < end
+}
+
+// minuteOfDay reads "HH:MM" or the "HH:MM:SS" Postgres returns for TIME
+func minuteOfDay(value string) (int, bool) {
+	if len(value) > 5 {
+		value = value[:5]
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// WebhookNotifier posts the task payload as JSON. With a secret the body is signed, receivers
+// check X-Signature against hex(HMAC-SHA256(secret, X-Timestamp + "." + body)) and should reject
+// timestamps too far from their clock. X-Delivery-ID stays the same across the retries of a
+// delivery, receivers can use it to drop duplicates.
+type WebhookNotifier struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+	client *http.Client
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, notification *Notification) error {
+	deliveryID, _ := asynq.GetTaskID(ctx)
+	_, _, err := n.Deliver(ctx, notification, deliveryID)
+	return err
+}
+
+// Deliver posts the notification and reports the response status, 0 when none was received, and
+// how long the receiver took
+func (n *WebhookNotifier) Deliver(ctx context.Context, notification *Notification, deliveryID string) (int, time.Duration, error) {
+	headers := map[string]string{"X-Notification-Event": notification.Event}
+	if deliveryID != "" {
+		headers["X-Delivery-ID"] = deliveryID
+	}
+
+	if n.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		headers["X-Timestamp"] = timestamp
+		headers["X-Signature"] = "sha256=" + sign(n.Secret, timestamp, notification.Data)
+	}
+
+	start := time.Now()
+	code, err := post(ctx, n.client, n.URL, notification.Data, headers)
+	return code, time.Since(start), err
+}
+
+// sign returns the hex HMAC-SHA256 of timestamp + "." + body, the X-Signature of a webhook
+func sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type EmailNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+}
+
+func newEmailNotifier(cfg *config.Config, to []string) *EmailNotifier {
+	c := cfg.Notify
+
+	var auth smtp.Auth
+	if c.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", c.SMTPUsername, c.SMTPPassword, c.SMTPHost)
+	}
+
+	from := c.SMTPFrom
+	if from == "" {
+		from = c.SMTPUsername
+	}
+
+	return &EmailNotifier{
+		addr: fmt.Sprintf("%s:%d", c.SMTPHost, c.SMTPPort),
+		auth: auth,
+		from: from,
+		to:   to,
+	}
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, notification *Notification) error {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.to, ", "))
+	// location names are Thai, headers must be encoded
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", notification.Title))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+
+	if notification.HTML == "" {
+		msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+		msg.WriteString(notification.Text)
+	} else {
+		// mail clients show the last part they can render, plain text comes first
+		body := multipart.NewWriter(&msg)
+		fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", body.Boundary())
+
+		for _, part := range []struct{ contentType, content string }{
+			{"text/plain; charset=UTF-8", notification.Text},
+			{"text/html; charset=UTF-8", notification.HTML},
+		} {
+			w, err := body.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+			if err != nil {
+				return err
+			}
+			io.WriteString(w, part.content)
+		}
+		if err := body.Close(); err != nil {
+			return err
+		}
+	}
+
+	// net/smtp has no context, run it aside so the task timeout still applies
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(n.addr, n.auth, n.from, n.to, []byte(msg.String()))
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LineNotifier pushes a text message with the LINE Messaging API
+type LineNotifier struct {
+	Token string `json:"token"`
+	To    string `json:"to"`
+}
+
+func (n *LineNotifier) Notify(ctx context.Context, notification *Notification) error {
+	body, err := json.Marshal(map[string]any{
+		"to": n.To,
+		"messages": []map[string]string{
+			{"type": "text", "text": notification.Title + "\n" + notification.Text},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return postJSON(ctx, "https://api.line.me/v2/bot/message/push", body, map[string]string{
+		"Authorization": "Bearer " + n.Token,
+	})
+}
+
+type TelegramNotifier struct {
+	Token  string `json:"token"`
+	ChatID string `json:"chat_id"`
+}
+
+func (n *TelegramNotifier) Notify(ctx context.Context, notification *Notification) error {
+	body, err := json.Marshal(map[string]any{
+		"chat_id": n.ChatID,
+		"text":    notification.Title + "\n" + notification.Text,
+	})
+	if err != nil {
+		return err
+	}
+
+	return postJSON(ctx, "https://api.telegram.org/bot"+n.Token+"/sendMessage", body, nil)
+}
+
+// SlackNotifier posts to a Slack incoming webhook, or any service that accepts the same {"text": ...} body
+type SlackNotifier struct {
+	URL    string `json:"url"`
+	client *http.Client
+}
+
+func (n *SlackNotifier) Notify(ctx context.Context, notification *Notification) error {
+	body, err := json.Marshal(map[string]string{
+		"text": "*" + notification.Title + "*\n" + notification.Text,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = post(ctx, n.client, n.URL, body, nil)
+	return err
+}
+
+// StatusError is a non-2xx response of a receiver
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.Code)
+}
+
+// retryableStatus reports whether a later attempt may succeed. Other 4xx responses mean the
+// request itself is wrong, sending it again would get the same answer.
+func retryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+}
+
+func postJSON(ctx context.Context, url string, body []byte, headers map[string]string) error {
+	_, err := post(ctx, nil, url, body, headers)
+	return err
+}
+
+// post sends a JSON body with client, http.DefaultClient when nil, and returns the response status.
+// Network errors, timeouts and retryable statuses are returned as is so the task retries, the other
+// failures skip the retries.
+func post(ctx context.Context, client *http.Client, url string, body []byte, headers map[string]string) (int, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, notifierTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %v: %w", err, asynq.SkipRetry)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	response, err := client.Do(req)
+	if err != nil {
+		// the url of some channels holds their token, keep it out of the logs
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		if errors.Is(err, utils.ErrNonPublicAddress) {
+			return 0, fmt.Errorf("failed to post request: %v: %w", err, asynq.SkipRetry)
+		}
+		return 0, fmt.Errorf("failed to post request: %w", err)
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		statusErr := &StatusError{Code: response.StatusCode}
+		if !retryableStatus(response.StatusCode) {
+			return response.StatusCode, fmt.Errorf("%w: %w", statusErr, asynq.SkipRetry)
+		}
+		return response.StatusCode, statusErr
+	}
+
+	return response.StatusCode, nil
+}
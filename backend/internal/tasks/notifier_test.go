@@ -0,0 +1,135 @@
+package tasks
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSign(t *testing.T) {
+	// expected values computed with: printf '%s' "<timestamp>.<body>" | openssl dgst -sha256 -hmac "<secret>"
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+		want      string
+	}{
+		{
+			name:      "json body",
+			secret:    "s3cret",
+			timestamp: "1760000000",
+			body:      []byte(`{"a":1}`),
+			want:      "8d0df74a348347224686e9880f7ad2c93fc5f8a3423fdd9790f1265c1b89025d",
+		},
+		{
+			name:      "empty body",
+			secret:    "s3cret",
+			timestamp: "1760000000",
+			body:      nil,
+			want:      "66f579a1117f936821e40d39dd644353a5a3fe6a4bc1be1e5dbcf9088af254cf",
+		},
+		{
+			name:      "other timestamp",
+			secret:    "s3cret",
+			timestamp: "0",
+			body:      []byte("hello"),
+			want:      "00f15e3c5011a95d1e3279a737f9c8bd54e9d27cbdf869c0e982cedd62ecc73a",
+		},
+		{
+			name:      "empty secret",
+			secret:    "",
+			timestamp: "1760000000",
+			body:      []byte(`{"a":1}`),
+			want:      "b234d6b7a4913d1c9f50ec43f3a5a42b72e01303d8209484f60b6a82edcdd803",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sign(tt.secret, tt.timestamp, tt.body); got != tt.want {
+				t.Errorf("sign() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignDependsOnEveryInput(t *testing.T) {
+	base := sign("s3cret", "1760000000", []byte(`{"a":1}`))
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+	}{
+		{name: "secret", secret: "other", timestamp: "1760000000", body: `{"a":1}`},
+		{name: "timestamp", secret: "s3cret", timestamp: "1760000001", body: `{"a":1}`},
+		{name: "body", secret: "s3cret", timestamp: "1760000000", body: `{"a":2}`},
+		// the dot keeps the timestamp and body apart
+		{name: "boundary", secret: "s3cret", timestamp: "176000000", body: `0{"a":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if sign(tt.secret, tt.timestamp, []byte(tt.body)) == base {
+				t.Errorf("changing the %s kept the signature", tt.name)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifierSignsBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		secret     string
+		wantSigned bool
+	}{
+		{name: "with a secret", secret: "s3cret", wantSigned: true},
+		{name: "without a secret", secret: "", wantSigned: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header http.Header
+			var body []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header.Clone()
+				body, _ = io.ReadAll(r.Body)
+			}))
+			defer server.Close()
+
+			// the test server listens on loopback, which the public client refuses
+			notifier := &WebhookNotifier{URL: server.URL, Secret: tt.secret, client: server.Client()}
+			notification := &Notification{Event: "alert", Data: json.RawMessage(`{"location_id":1}`)}
+
+			code, _, err := notifier.Deliver(context.Background(), notification, "delivery-1")
+			if err != nil {
+				t.Fatalf("Deliver() error = %v", err)
+			}
+			if code != http.StatusOK {
+				t.Fatalf("Deliver() status = %d, want %d", code, http.StatusOK)
+			}
+			if got := header.Get("X-Delivery-ID"); got != "delivery-1" {
+				t.Errorf("X-Delivery-ID = %q, want delivery-1", got)
+			}
+
+			signature := header.Get("X-Signature")
+			if !tt.wantSigned {
+				if signature != "" || header.Get("X-Timestamp") != "" {
+					t.Errorf("unsigned delivery sent X-Signature %q and X-Timestamp %q", signature, header.Get("X-Timestamp"))
+				}
+				return
+			}
+
+			want := "sha256=" + sign(tt.secret, header.Get("X-Timestamp"), body)
+			if !hmac.Equal([]byte(signature), []byte(want)) {
+				t.Errorf("X-Signature = %q, want %q", signature, want)
+			}
+		})
+	}
+}
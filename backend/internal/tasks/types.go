@@ -1,14 +1,81 @@
 package tasks
 
 const (
-	TypeWaterAlert = "notification:water_alert"
+	TypeWaterAlert           = "notification:water_alert"
+	TypeRapidRise            = "notification:rapid_rise"
+	TypeNotificationDelivery = "notification:deliver"
+	TypeReadingsExport       = "export:readings"
+	TypeImageCapture         = "image:capture"
+	TypeImagePredict         = "image:predict"
+	TypeImagePredictBatch    = "image:predict_batch"
 )
 
+// EventDigest is the event of digests, the cron renders them and enqueues the deliveries directly
+const EventDigest = "digest"
+
 type WaterAlertPayload struct {
-	LocationID   int     `json:"location_id"`
-	LocationName string  `json:"location_name"`
-	ShoreLevel   float64 `json:"shore_level"`
-	WaterLevel   float64 `json:"water_level"`
-	Description  string  `json:"description"`
-	MeasuredAt   string  `json:"measured_at"`
+	LocationID     int              `json:"location_id"`
+	LocationName   string           `json:"location_name"`
+	ShoreLevel     *float64         `json:"shore_level,omitempty"`
+	WaterLevel     float64          `json:"water_level"`
+	Description    string           `json:"description"`
+	MeasuredAt     string           `json:"measured_at"`
+	Forecast       *ForecastPayload `json:"forecast,omitempty"`
+	AlertID        int64            `json:"alert_id"`
+	AlertState     string           `json:"alert_state"`
+	AlertEvent     string           `json:"alert_event"` // OPENED, ESCALATED, DEESCALATED, RENOTIFIED or RESOLVED
+	Danger         string           `json:"danger"`
+	PreviousDanger string           `json:"previous_danger,omitempty"`
+}
+
+type RapidRisePayload struct {
+	LocationID         int64            `json:"location_id"`
+	LocationName       string           `json:"location_name"`
+	RiseRateCmPerHour  float64          `json:"rise_rate_cm_per_hour"`
+	RiseLimitCmPerHour float64          `json:"rise_limit_cm_per_hour"`
+	WindowMinutes      int              `json:"window_minutes"`
+	WaterLevel         float64          `json:"water_level"`
+	Danger             string           `json:"danger"`
+	MeasuredAt         string           `json:"measured_at"`
+	Forecast           *ForecastPayload `json:"forecast,omitempty"`
+}
+
+// ForecastPayload summarises the level forecast of the location at the time of the alert
+type ForecastPayload struct {
+	HorizonHours     int      `json:"horizon_hours"`
+	LevelCm          float64  `json:"level_cm"`
+	LowerCm          float64  `json:"lower_cm"`
+	UpperCm          float64  `json:"upper_cm"`
+	BankLevelCm      *float64 `json:"bank_level_cm"`
+	BankLevelAt      *string  `json:"bank_level_at"`
+	HoursToBankLevel *float64 `json:"hours_to_bank_level"`
+}
+
+// NotificationDeliveryPayload sends one notification to one channel. ReplayOf is the webhook
+// delivery an admin replays.
+type NotificationDeliveryPayload struct {
+	Channel      string        `json:"channel"`
+	Notification *Notification `json:"notification"`
+	ReplayOf     int64         `json:"replay_of,omitempty"`
+}
+
+type ReadingsExportPayload struct {
+	ExportID int64 `json:"export_id"`
+}
+
+type ImageCapturePayload struct {
+	LocationID int64 `json:"location_id"`
+}
+
+type ImagePredictPayload struct {
+	PendingReadingID int64 `json:"pending_reading_id"`
+}
+
+// ImagePredictBatchPayload writes the reports <Name>.csv and <Name>_summary.csv to the export directory
+type ImagePredictBatchPayload struct {
+	Name          string `json:"name"`
+	Dir           string `json:"dir"`
+	LocationID    int64  `json:"location_id"`
+	MaxGapMinutes int    `json:"max_gap_minutes"`
+	Concurrency   int    `json:"concurrency"`
 }
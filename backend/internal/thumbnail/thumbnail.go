@@ -0,0 +1,283 @@
+// Package thumbnail resizes and re-encodes images and keeps the results in a size-bounded on-disk
+// cache, the least recently used variants are evicted first.
+package thumbnail
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+// Output formats. x/image has no WebP encoder, variants are re-encoded as JPEG instead.
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+)
+
+const jpegQuality = 80
+
+// MaxPixels bounds the decoded size of a source image, the header is checked before decoding so
+// a small file claiming huge dimensions is rejected without allocating them
+const MaxPixels = 50_000_000
+
+// maxBuilds bounds the variants decoded at the same time
+const maxBuilds = 4
+
+// Widths are the variant widths served, a fixed set keeps the cache from filling with one-off sizes
+var Widths = []int{160, 320, 640, 800, 1280}
+
+var ErrInvalidOptions = errors.New("invalid variant options")
+
+var ErrImageTooLarge = errors.New("image dimensions exceed the decode budget")
+
+// Options select a variant. A zero Width keeps the original size.
+type Options struct {
+	Width  int
+	Format string
+}
+
+func (o Options) Validate() error {
+	if o.Format != FormatJPEG && o.Format != FormatPNG {
+		return fmt.Errorf("%w: format must be %s or %s", ErrInvalidOptions, FormatJPEG, FormatPNG)
+	}
+	if o.Width == 0 {
+		return nil
+	}
+	for _, width := range Widths {
+		if o.Width == width {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: w must be one of %v", ErrInvalidOptions, Widths)
+}
+
+// ETag identifies a variant of a source file. It changes whenever the source is replaced, so it
+// can be checked against If-None-Match without building the variant.
+func ETag(source os.FileInfo, opts Options) string {
+	return `"` + key(source, opts) + `"`
+}
+
+func key(source os.FileInfo, opts Options) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d|%d|%s", source.Name(), source.Size(), source.ModTime().UnixNano(), opts.Width, opts.Format)))
+	return hex.EncodeToString(sum[:16])
+}
+
+type Cache struct {
+	dir      string
+	maxBytes int64
+	slots    chan struct{}
+
+	mu       sync.Mutex
+	building map[string]*build
+}
+
+// build is a variant being built, requests for the same variant wait on done
+type build struct {
+	done chan struct{}
+	err  error
+}
+
+func NewCache(dir string, maxBytes int64) *Cache {
+	return &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		slots:    make(chan struct{}, maxBuilds),
+		building: make(map[string]*build),
+	}
+}
+
+// Get returns the path of the variant of source, building it on the first request
+func (c *Cache) Get(source string, opts Options) (string, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(c.dir, key(info, opts)+"."+extension(opts.Format))
+
+	// a hit only refreshes the access time used for eviction
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err == nil {
+		return path, nil
+	}
+
+	c.mu.Lock()
+	if b, ok := c.building[path]; ok {
+		c.mu.Unlock()
+		<-b.done
+		if b.err != nil {
+			return "", b.err
+		}
+		return path, nil
+	}
+	b := &build{done: make(chan struct{})}
+	c.building[path] = b
+	c.mu.Unlock()
+
+	c.slots <- struct{}{}
+	// another request may have built it before this one registered
+	if _, err := os.Stat(path); err != nil {
+		b.err = c.build(source, path, opts)
+	}
+	<-c.slots
+
+	c.mu.Lock()
+	if b.err == nil {
+		c.evict(path)
+	}
+	delete(c.building, path)
+	c.mu.Unlock()
+	close(b.done)
+
+	if b.err != nil {
+		return "", b.err
+	}
+	return path, nil
+}
+
+func (c *Cache) build(source string, path string, opts Options) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > MaxPixels {
+		return fmt.Errorf("%w: %dx%d", ErrImageTooLarge, config.Width, config.Height)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	img := Resize(src, opts.Width)
+
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(c.dir, ".variant-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	switch opts.Format {
+	case FormatPNG:
+		err = png.Encode(tmp, img)
+	default:
+		err = jpeg.Encode(tmp, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode image: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Resize scales img down to width keeping its aspect ratio. Images already narrower are returned
+// as they are, variants are never upscaled.
+func Resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if width <= 0 || bounds.Dx() <= width {
+		return img
+	}
+
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+
+	return dst
+}
+
+// evict removes the least recently used variants until the cache fits in maxBytes, keep is the
+// variant just built. Temporary files of builds still running are left alone.
+func (c *Cache) evict(keep string) {
+	if c.maxBytes <= 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+
+	type variant struct {
+		path   string
+		size   int64
+		usedAt time.Time
+	}
+
+	variants := make([]variant, 0, len(entries))
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		variants = append(variants, variant{filepath.Join(c.dir, entry.Name()), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+
+	sort.Slice(variants, func(i, j int) bool { return variants[i].usedAt.Before(variants[j].usedAt) })
+
+	for _, v := range variants {
+		if total <= c.maxBytes {
+			break
+		}
+		if v.path == keep {
+			continue
+		}
+		if err := os.Remove(v.path); err == nil {
+			total -= v.size
+		}
+	}
+}
+
+func extension(format string) string {
+	if format == FormatPNG {
+		return "png"
+	}
+	return "jpg"
+}
+
+// ParseWidth reads the w query parameter, empty means the original width
+func ParseWidth(raw string) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	width, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%w: w must be one of %v", ErrInvalidOptions, Widths)
+	}
+	return width, nil
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"database/sql"
 	"strconv"
 	"time"
 )
@@ -24,3 +25,38 @@ func ConvertStringToTime(value string) time.Time {
 
 	return parsedTime
 }
+
+func NullFloat64ToPtr(value sql.NullFloat64) *float64 {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Float64
+}
+
+func NullStringToPtr(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
+	}
+	return &value.String
+}
+
+func NullInt64ToPtr(value sql.NullInt64) *int64 {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Int64
+}
+
+func PtrToNullFloat64(value *float64) sql.NullFloat64 {
+	if value == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *value, Valid: true}
+}
+
+func PtrToString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"math"
+
+	"github.com/guatom999/self-boardcast/internal/entities"
+)
+
+// LTTB downsamples a time-ordered series to at most threshold points using
+// Largest-Triangle-Three-Buckets, which keeps the visual shape of the series.
+// The first and last points are always kept.
+func LTTB(points []*entities.SeriesPoint, threshold int) []*entities.SeriesPoint {
+	if threshold >= len(points) || threshold <= 0 {
+		return points
+	}
+	if threshold < 3 {
+		threshold = 3
+		if threshold >= len(points) {
+			return points
+		}
+	}
+
+	sampled := make([]*entities.SeriesPoint, 0, threshold)
+	sampled = append(sampled, points[0])
+
+	// every bucket except the first and last point
+	bucketSize := float64(len(points)-2) / float64(threshold-2)
+	selected := 0
+
+	for i := 0; i < threshold-2; i++ {
+		// average of the next bucket is the third vertex of the triangle
+		nextStart := int(math.Floor(float64(i+1)*bucketSize)) + 1
+		nextEnd := int(math.Floor(float64(i+2)*bucketSize)) + 1
+		if nextEnd > len(points) {
+			nextEnd = len(points)
+		}
+
+		var avgX, avgY float64
+		for _, p := range points[nextStart:nextEnd] {
+			avgX += seriesX(p)
+			avgY += p.LevelCm
+		}
+		count := float64(nextEnd - nextStart)
+		avgX /= count
+		avgY /= count
+
+		start := int(math.Floor(float64(i)*bucketSize)) + 1
+		end := int(math.Floor(float64(i+1)*bucketSize)) + 1
+
+		ax := seriesX(points[selected])
+		ay := points[selected].LevelCm
+
+		maxArea := -1.0
+		next := start
+		for j := start; j < end; j++ {
+			area := math.Abs((ax-avgX)*(points[j].LevelCm-ay)-(ax-seriesX(points[j]))*(avgY-ay)) / 2
+			if area > maxArea {
+				maxArea = area
+				next = j
+			}
+		}
+
+		sampled = append(sampled, points[next])
+		selected = next
+	}
+
+	return append(sampled, points[len(points)-1])
+}
+
+func seriesX(p *entities.SeriesPoint) float64 {
+	return float64(p.MeasuredAt.Unix())
+}
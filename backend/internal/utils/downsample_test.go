@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/guatom999/self-boardcast/internal/entities"
+)
+
+var seriesStart = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+// series returns one point per minute with the given levels
+func series(levels ...float64) []*entities.SeriesPoint {
+	points := make([]*entities.SeriesPoint, len(levels))
+	for i, level := range levels {
+		points[i] = &entities.SeriesPoint{MeasuredAt: seriesStart.Add(time.Duration(i) * time.Minute), LevelCm: level}
+	}
+	return points
+}
+
+func levels(points []*entities.SeriesPoint) []float64 {
+	result := make([]float64, len(points))
+	for i, p := range points {
+		result[i] = p.LevelCm
+	}
+	return result
+}
+
+func TestLTTB(t *testing.T) {
+	tests := []struct {
+		name      string
+		points    []*entities.SeriesPoint
+		threshold int
+		want      []float64
+	}{
+		{
+			name:      "empty series",
+			points:    series(),
+			threshold: 10,
+			want:      []float64{},
+		},
+		{
+			name:      "threshold above the length keeps every point",
+			points:    series(1, 2, 3),
+			threshold: 10,
+			want:      []float64{1, 2, 3},
+		},
+		{
+			name:      "threshold equal to the length keeps every point",
+			points:    series(1, 2, 3, 4),
+			threshold: 4,
+			want:      []float64{1, 2, 3, 4},
+		},
+		{
+			name:      "zero threshold keeps every point",
+			points:    series(1, 2, 3, 4),
+			threshold: 0,
+			want:      []float64{1, 2, 3, 4},
+		},
+		{
+			name:      "negative threshold keeps every point",
+			points:    series(1, 2, 3, 4),
+			threshold: -5,
+			want:      []float64{1, 2, 3, 4},
+		},
+		{
+			name:      "threshold below three is raised to three",
+			points:    series(0, 1, 9, 1, 0),
+			threshold: 1,
+			want:      []float64{0, 9, 0},
+		},
+		{
+			name:      "threshold raised to three on a short series",
+			points:    series(5, 6, 7),
+			threshold: 2,
+			want:      []float64{5, 6, 7},
+		},
+		{
+			name:      "peak is kept",
+			points:    series(0, 0, 0, 0, 50, 0, 0, 0, 0, 0),
+			threshold: 4,
+			want:      []float64{0, 50, 0, 0},
+		},
+		{
+			name:      "peak and trough are kept",
+			points:    series(10, 11, 30, 11, 10, 9, -10, 9, 10, 10),
+			threshold: 4,
+			want:      []float64{10, 30, -10, 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := levels(LTTB(tt.points, tt.threshold))
+			if len(got) != len(tt.want) {
+				t.Fatalf("LTTB() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("LTTB() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLTTBShape(t *testing.T) {
+	points := make([]*entities.SeriesPoint, 1000)
+	for i := range points {
+		points[i] = &entities.SeriesPoint{
+			MeasuredAt: seriesStart.Add(time.Duration(i) * time.Minute),
+			LevelCm:    100 + 50*math.Sin(float64(i)/50),
+		}
+	}
+
+	for _, threshold := range []int{3, 10, 100, 999} {
+		sampled := LTTB(points, threshold)
+
+		if len(sampled) != threshold {
+			t.Errorf("LTTB(%d) returned %d points", threshold, len(sampled))
+			continue
+		}
+		if sampled[0] != points[0] || sampled[len(sampled)-1] != points[len(points)-1] {
+			t.Errorf("LTTB(%d) dropped the first or last point", threshold)
+		}
+		for i := 1; i < len(sampled); i++ {
+			if !sampled[i].MeasuredAt.After(sampled[i-1].MeasuredAt) {
+				t.Errorf("LTTB(%d) is not in time order at %d", threshold, i)
+				break
+			}
+		}
+	}
+}
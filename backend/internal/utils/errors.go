@@ -7,4 +7,5 @@ var (
 	ErrNotFound      = errors.New("resource not found")
 	ErrInvalidInput  = errors.New("invalid input")
 	ErrInternalError = errors.New("internal server error")
+	ErrFileTooLarge  = errors.New("file too large")
 )
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+)
+
+// gpsIFDTag is the IFD0 tag pointing to the GPS IFD
+const gpsIFDTag = 0x8825
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+
+// tiffTypeSizes is the size in bytes of each TIFF field type
+var tiffTypeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// StripGPS clears the GPS position from the EXIF data of a JPEG or PNG file and keeps the rest of
+// the metadata. The GPS values are zeroed in place, so no offset in the file moves. It reports
+// whether a position was found.
+func StripGPS(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	var found bool
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		found = stripJPEGGPS(data)
+	case bytes.HasPrefix(data, pngSignature):
+		found = stripPNGGPS(data)
+	}
+
+	if !found {
+		return false, nil
+	}
+	return true, os.WriteFile(path, data, 0o644)
+}
+
+// stripJPEGGPS walks the segments before the image data looking for the APP1 Exif segment
+func stripJPEGGPS(data []byte) bool {
+	found := false
+
+	for i := 2; i+4 <= len(data) && data[i] == 0xff; {
+		marker := data[i+1]
+		if marker == 0xda || marker == 0xd9 {
+			break
+		}
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			i += 2
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+
+		segment := data[i+4 : end]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) && clearGPS(segment[6:]) {
+			found = true
+		}
+		i = end
+	}
+
+	return found
+}
+
+// stripPNGGPS clears the eXIf chunk and fixes its CRC
+func stripPNGGPS(data []byte) bool {
+	found := false
+
+	for i := len(pngSignature); i+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if end > len(data) {
+			break
+		}
+
+		if string(data[i+4:i+8]) == "eXIf" && clearGPS(data[i+8:i+8+length]) {
+			binary.BigEndian.PutUint32(data[i+8+length:], crc32.ChecksumIEEE(data[i+4:i+8+length]))
+			found = true
+		}
+		i = end
+	}
+
+	return found
+}
+
+// clearGPS empties the GPS IFD of a TIFF structure: the values it points to are zeroed and its
+// entry count set to 0, which readers see as no position
+func clearGPS(tiff []byte) bool {
+	if len(tiff) < 8 {
+		return false
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return false
+	}
+
+	ifd0 := int(order.Uint32(tiff[4:]))
+	if ifd0+2 > len(tiff) {
+		return false
+	}
+
+	entries := int(order.Uint16(tiff[ifd0:]))
+	for k := 0; k < entries; k++ {
+		entry := ifd0 + 2 + 12*k
+		if entry+12 > len(tiff) {
+			return false
+		}
+		if order.Uint16(tiff[entry:]) != gpsIFDTag {
+			continue
+		}
+
+		gps := int(order.Uint32(tiff[entry+8:]))
+		if gps+2 > len(tiff) {
+			return false
+		}
+
+		count := int(order.Uint16(tiff[gps:]))
+		for g := 0; g < count; g++ {
+			field := gps + 2 + 12*g
+			if field+12 > len(tiff) {
+				break
+			}
+
+			size := tiffTypeSizes[order.Uint16(tiff[field+2:])] * order.Uint32(tiff[field+4:])
+			if size > 4 {
+				offset := order.Uint32(tiff[field+8:])
+				if uint64(offset)+uint64(size) <= uint64(len(tiff)) {
+					clear(tiff[offset : offset+size])
+				}
+			}
+			clear(tiff[field : field+12])
+		}
+		order.PutUint16(tiff[gps:], 0)
+
+		return true
+	}
+
+	return false
+}
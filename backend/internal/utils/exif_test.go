@@ -0,0 +1,323 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Offsets in the TIFF structure built by testTIFF
+const (
+	testGPSIFD      = 26
+	testGPSRational = 56
+)
+
+// testTIFF builds an EXIF TIFF structure whose IFD0 points to a GPS IFD holding GPSLatitudeRef
+// "N" inline and a GPSLatitude of three rationals stored at testGPSRational
+func testTIFF(order binary.ByteOrder) []byte {
+	tiff := make([]byte, testGPSRational+24)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+
+	// IFD0: one LONG entry pointing to the GPS IFD
+	order.PutUint16(tiff[8:], 1)
+	putEntry(order, tiff[10:], gpsIFDTag, 4, 1, testGPSIFD)
+
+	// GPS IFD: GPSLatitudeRef and GPSLatitude
+	order.PutUint16(tiff[testGPSIFD:], 2)
+	putEntry(order, tiff[testGPSIFD+2:], 1, 2, 2, 0)
+	copy(tiff[testGPSIFD+2+8:], "N\x00")
+	putEntry(order, tiff[testGPSIFD+14:], 2, 5, 3, testGPSRational)
+	for i := 0; i < 6; i++ {
+		order.PutUint32(tiff[testGPSRational+4*i:], uint32(13+i))
+	}
+
+	return tiff
+}
+
+func putEntry(order binary.ByteOrder, b []byte, tag uint16, fieldType uint16, count uint32, value uint32) {
+	order.PutUint16(b, tag)
+	order.PutUint16(b[2:], fieldType)
+	order.PutUint32(b[4:], count)
+	order.PutUint32(b[8:], value)
+}
+
+// testJPEG wraps a TIFF structure in the APP1 segment of a minimal JPEG
+func testJPEG(tiff []byte) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0xff, 0xd8})
+	// an APP0 segment before the Exif one
+	b.Write([]byte{0xff, 0xe0, 0x00, 0x04, 0x00, 0x00})
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	b.Write([]byte{0xff, 0xe1})
+	binary.Write(&b, binary.BigEndian, uint16(len(payload)+2))
+	b.Write(payload)
+
+	b.Write([]byte{0xff, 0xda, 0x00, 0x02, 0x01, 0x02, 0xff, 0xd9})
+	return b.Bytes()
+}
+
+// testPNG puts a TIFF structure in the eXIf chunk of a minimal PNG
+func testPNG(tiff []byte) []byte {
+	var b bytes.Buffer
+	b.Write(pngSignature)
+	binary.Write(&b, binary.BigEndian, uint32(len(tiff)))
+	chunk := append([]byte("eXIf"), tiff...)
+	b.Write(chunk)
+	binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	b.Write([]byte{0, 0, 0, 0, 'I', 'E', 'N', 'D', 0xae, 0x42, 0x60, 0x82})
+	return b.Bytes()
+}
+
+// gpsCleared reports whether the GPS IFD of a TIFF built by testTIFF was emptied
+func gpsCleared(tiff []byte) bool {
+	gps := tiff[testGPSIFD:]
+	return bytes.Equal(gps, make([]byte, len(gps)))
+}
+
+func TestStripJPEGGPS(t *testing.T) {
+	tests := []struct {
+		name  string
+		order binary.ByteOrder
+	}{
+		{name: "little endian", order: binary.LittleEndian},
+		{name: "big endian", order: binary.BigEndian},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testJPEG(testTIFF(tt.order))
+			size := len(data)
+
+			if !stripJPEGGPS(data) {
+				t.Fatal("stripJPEGGPS() = false, want true")
+			}
+			if len(data) != size {
+				t.Fatalf("stripJPEGGPS() changed the size from %d to %d", size, len(data))
+			}
+
+			tiff := data[bytes.Index(data, []byte("Exif\x00\x00"))+6:]
+			if !gpsCleared(tiff[:testGPSRational+24]) {
+				t.Error("GPS IFD still holds values")
+			}
+			// IFD0 and its pointer to the GPS IFD are kept
+			if tt.order.Uint16(tiff[10:]) != gpsIFDTag || tt.order.Uint32(tiff[18:]) != testGPSIFD {
+				t.Error("IFD0 was modified")
+			}
+			if !bytes.HasSuffix(data, []byte{0xff, 0xda, 0x00, 0x02, 0x01, 0x02, 0xff, 0xd9}) {
+				t.Error("image data was modified")
+			}
+		})
+	}
+}
+
+func TestStripJPEGGPSWithoutGPS(t *testing.T) {
+	tiff := testTIFF(binary.LittleEndian)
+	// retag the GPS pointer as another IFD0 entry
+	binary.LittleEndian.PutUint16(tiff[10:], 0x0110)
+
+	data := testJPEG(tiff)
+	original := bytes.Clone(data)
+
+	if stripJPEGGPS(data) {
+		t.Error("stripJPEGGPS() = true, want false")
+	}
+	if !bytes.Equal(data, original) {
+		t.Error("stripJPEGGPS() modified an image without GPS")
+	}
+}
+
+func TestStripPNGGPS(t *testing.T) {
+	data := testPNG(testTIFF(binary.BigEndian))
+
+	if !stripPNGGPS(data) {
+		t.Fatal("stripPNGGPS() = false, want true")
+	}
+
+	start := len(pngSignature) + 8
+	length := int(binary.BigEndian.Uint32(data[len(pngSignature):]))
+	if !gpsCleared(data[start : start+length]) {
+		t.Error("GPS IFD still holds values")
+	}
+	if got, want := binary.BigEndian.Uint32(data[start+length:]), crc32.ChecksumIEEE(data[start-4:start+length]); got != want {
+		t.Errorf("eXIf CRC = %08x, want %08x", got, want)
+	}
+}
+
+func TestStripGPSMalformed(t *testing.T) {
+	le := binary.LittleEndian
+
+	tests := []struct {
+		name string
+		data func() []byte
+		want bool
+	}{
+		{
+			name: "zero length segment",
+			data: func() []byte { return []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x00} },
+		},
+		{
+			name: "segment length of one",
+			data: func() []byte { return []byte{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x01, 'E', 'x'} },
+		},
+		{
+			name: "segment longer than the file",
+			data: func() []byte { return []byte{0xff, 0xd8, 0xff, 0xe1, 0xff, 0xff, 'E', 'x', 'i', 'f'} },
+		},
+		{
+			name: "truncated marker",
+			data: func() []byte { return []byte{0xff, 0xd8, 0xff} },
+		},
+		{
+			name: "only the start of image",
+			data: func() []byte { return []byte{0xff, 0xd8} },
+		},
+		{
+			name: "Exif segment cut short",
+			data: func() []byte {
+				data := testJPEG(testTIFF(le))
+				return data[:bytes.Index(data, []byte("Exif"))+20]
+			},
+		},
+		{
+			name: "unknown byte order",
+			data: func() []byte {
+				tiff := testTIFF(le)
+				copy(tiff, "XX")
+				return testJPEG(tiff)
+			},
+		},
+		{
+			name: "TIFF header shorter than 8 bytes",
+			data: func() []byte { return testJPEG([]byte("II*\x00")) },
+		},
+		{
+			name: "IFD0 offset past the end",
+			data: func() []byte {
+				tiff := testTIFF(le)
+				le.PutUint32(tiff[4:], 0xffffff00)
+				return testJPEG(tiff)
+			},
+		},
+		{
+			name: "IFD0 entry count past the end",
+			data: func() []byte {
+				tiff := testTIFF(le)
+				le.PutUint16(tiff[8:], 0xffff)
+				// move the GPS pointer out of the first entry so the walk runs off the end
+				le.PutUint16(tiff[10:], 0x0110)
+				return testJPEG(tiff)
+			},
+		},
+		{
+			name: "GPS IFD offset past the end",
+			data: func() []byte {
+				tiff := testTIFF(le)
+				le.PutUint32(tiff[18:], 0xfffffff0)
+				return testJPEG(tiff)
+			},
+		},
+		{
+			name: "GPS entry count past the end",
+			data: func() []byte {
+				tiff := testTIFF(le)
+				le.PutUint16(tiff[testGPSIFD:], 0xffff)
+				return testJPEG(tiff)
+			},
+			want: true,
+		},
+		{
+			name: "GPS value offset past the end",
+			data: func() []byte {
+				tiff := testTIFF(le)
+				le.PutUint32(tiff[testGPSIFD+14+8:], 0xfffffff0)
+				return testJPEG(tiff)
+			},
+			want: true,
+		},
+		{
+			name: "GPS value size overflowing 32 bits",
+			data: func() []byte {
+				tiff := testTIFF(le)
+				le.PutUint32(tiff[testGPSIFD+14+4:], 0x40000000)
+				return testJPEG(tiff)
+			},
+			want: true,
+		},
+		{
+			name: "PNG chunk longer than the file",
+			data: func() []byte {
+				data := testPNG(testTIFF(le))
+				binary.BigEndian.PutUint32(data[len(pngSignature):], 0xfffffff0)
+				return data
+			},
+		},
+		{
+			name: "PNG cut inside the eXIf chunk",
+			data: func() []byte { return testPNG(testTIFF(le))[:len(pngSignature)+20] },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "image")
+			if err := os.WriteFile(path, tt.data(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := StripGPS(path)
+			if err != nil {
+				t.Fatalf("StripGPS() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("StripGPS() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripGPSRewritesOnlyWhenFound(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{name: "jpeg with GPS", data: testJPEG(testTIFF(binary.LittleEndian)), want: true},
+		{name: "png with GPS", data: testPNG(testTIFF(binary.LittleEndian)), want: true},
+		{name: "not an image", data: []byte("GIF89a"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "image")
+			if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := StripGPS(path)
+			if err != nil {
+				t.Fatalf("StripGPS() error = %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("StripGPS() = %v, want %v", got, tt.want)
+			}
+
+			written, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed := !bytes.Equal(written, tt.data); changed != tt.want {
+				t.Errorf("file changed = %v, want %v", changed, tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,58 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"time"
 )
 
+var (
+	imageNamePattern  = regexp.MustCompile(`^loc(\d+)_(\d{8}_\d{6})_[0-9a-f]+\.[A-Za-z]+$`)
+	legacyNamePattern = regexp.MustCompile(`^pathum_snap_(\d{4}-\d{2}-\d{2}_\d{6})\.[A-Za-z]+$`)
+)
+
 func GenerateFileName() string {
 	return fmt.Sprintf("pathum_snap_%s.png", time.Now().Format("2006-01-02_150405"))
 }
+
+// GenerateImageName names an image of a location as loc<id>_<YYYYMMDD_HHMMSS>_<random>.<ext>, the
+// time in UTC whatever the zone of takenAt. The random part keeps two snapshots of the same second apart.
+func GenerateImageName(locationID int64, takenAt time.Time, ext string) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("loc%d_%s_%s.%s", locationID, takenAt.UTC().Format("20060102_150405"), hex.EncodeToString(suffix), ext)
+}
+
+// ParseImageName reads the location and capture time back from a name of GenerateImageName or of
+// the older GenerateFileName, whose names have no location and return 0. Names of GenerateImageName
+// are in UTC, the older ones hold the wall clock of the host that took the snapshot and loc is its
+// time zone.
+func ParseImageName(name string, loc *time.Location) (int64, time.Time, error) {
+	name = filepath.Base(name)
+
+	if m := imageNamePattern.FindStringSubmatch(name); m != nil {
+		locationID, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return 0, time.Time{}, fmt.Errorf("%w: %s: %v", ErrInvalidInput, name, err)
+		}
+		takenAt, err := time.ParseInLocation("20060102_150405", m[2], time.UTC)
+		if err != nil {
+			return 0, time.Time{}, fmt.Errorf("%w: %s: %v", ErrInvalidInput, name, err)
+		}
+		return locationID, takenAt, nil
+	}
+
+	if m := legacyNamePattern.FindStringSubmatch(name); m != nil {
+		takenAt, err := time.ParseInLocation("2006-01-02_150405", m[1], loc)
+		if err != nil {
+			return 0, time.Time{}, fmt.Errorf("%w: %s: %v", ErrInvalidInput, name, err)
+		}
+		return 0, takenAt, nil
+	}
+
+	return 0, time.Time{}, fmt.Errorf("%w: %s is not a snapshot name", ErrInvalidInput, name)
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseImageName(t *testing.T) {
+	bangkok := time.FixedZone("ICT", 7*60*60)
+	takenAt := time.Date(2026, 10, 1, 7, 30, 15, 0, bangkok)
+
+	tests := []struct {
+		name         string
+		file         string
+		loc          *time.Location
+		wantLocation int64
+		want         time.Time
+	}{
+		{
+			name:         "generated from a Bangkok time",
+			file:         GenerateImageName(28, takenAt, "png"),
+			loc:          time.UTC,
+			wantLocation: 28,
+			want:         takenAt,
+		},
+		{
+			name:         "generated from the same instant in UTC",
+			file:         GenerateImageName(28, takenAt.UTC(), "jpg"),
+			loc:          bangkok,
+			wantLocation: 28,
+			want:         takenAt,
+		},
+		{
+			name: "legacy name in the given zone",
+			file: "/archive/pathum_snap_2026-10-01_073015.png",
+			loc:  bangkok,
+			want: takenAt,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locationID, got, err := ParseImageName(tt.file, tt.loc)
+			if err != nil {
+				t.Fatalf("ParseImageName(%q) error = %v", tt.file, err)
+			}
+			if locationID != tt.wantLocation {
+				t.Errorf("ParseImageName(%q) location = %d, want %d", tt.file, locationID, tt.wantLocation)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseImageName(%q) = %v, want %v", tt.file, got, tt.want)
+			}
+		})
+	}
+}
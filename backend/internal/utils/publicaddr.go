@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrNonPublicAddress is returned for hosts that resolve to loopback, private, link-local or other
+// addresses that are not reachable on the internet
+var ErrNonPublicAddress = errors.New("address is not public")
+
+// reservedNets are the ranges the net.IP predicates do not cover
+var reservedNets = func() []*net.IPNet {
+	cidrs := []string{
+		"0.0.0.0/8",       // this network
+		"100.64.0.0/10",   // carrier grade NAT
+		"192.0.0.0/24",    // IETF protocol assignments
+		"192.0.2.0/24",    // documentation
+		"198.18.0.0/15",   // benchmarking
+		"198.51.100.0/24", // documentation
+		"203.0.113.0/24",  // documentation
+		"240.0.0.0/4",     // reserved, and broadcast
+		"64:ff9b::/96",    // NAT64, maps onto IPv4 addresses
+		"2001:db8::/32",   // documentation
+	}
+
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// IsPublicIP reports whether ip is a unicast address reachable on the internet
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range reservedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValidatePublicURL checks that raw is an http or https URL whose host resolves to public addresses
+// only. The check is repeated by PublicHTTPClient when connecting, DNS may answer differently then.
+func ValidatePublicURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("%w: target must be an http or https URL", ErrInvalidInput)
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !IsPublicIP(ip) {
+			return fmt.Errorf("%w: %s: %w", ErrInvalidInput, host, ErrNonPublicAddress)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("%w: host %s cannot be resolved", ErrInvalidInput, host)
+	}
+	for _, addr := range addrs {
+		if !IsPublicIP(addr.IP) {
+			return fmt.Errorf("%w: %s: %w", ErrInvalidInput, host, ErrNonPublicAddress)
+		}
+	}
+
+	return nil
+}
+
+// PublicHTTPClient returns a client that only connects to public addresses. The address is checked
+// on the socket after resolution, so a host that is rebound to an internal address after
+// ValidatePublicURL, or a redirect to one, is refused too. Proxies are not used, they would connect
+// on its behalf.
+func PublicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !IsPublicIP(net.ParseIP(host)) {
+				return fmt.Errorf("%s: %w", host, ErrNonPublicAddress)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
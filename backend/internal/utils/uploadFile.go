@@ -1 +1,97 @@
 package utils
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var imageExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// UploadedImage is an image stored by SaveUploadedImage
+type UploadedImage struct {
+	FileName    string
+	ContentType string
+	Size        int64
+	GPSStripped bool
+}
+
+// SaveUploadedImage stores an uploaded image of a location in uploadDir. The upload is written to a
+// temporary file first and only renamed once it is within maxBytes and sniffed as an image, so a
+// rejected upload never shows up under /images.
+func SaveUploadedImage(src io.Reader, uploadDir string, locationID int64, takenAt time.Time, maxBytes int64, stripGPS bool) (*UploadedImage, error) {
+	if err := os.MkdirAll(uploadDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(uploadDir, ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	size, err := io.Copy(tmp, io.LimitReader(src, maxBytes+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write file: %w", err)
+	}
+	if size > maxBytes {
+		return nil, fmt.Errorf("%w: at most %d bytes", ErrFileTooLarge, maxBytes)
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("%w: file is empty", ErrInvalidInput)
+	}
+
+	if err := ValidateImageType(tmpPath); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	contentType, err := detectContentType(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &UploadedImage{
+		ContentType: contentType,
+		Size:        size,
+	}
+
+	if stripGPS {
+		if result.GPSStripped, err = StripGPS(tmpPath); err != nil {
+			return nil, fmt.Errorf("failed to strip GPS: %w", err)
+		}
+	}
+
+	result.FileName = GenerateImageName(locationID, takenAt, imageExtensions[contentType])
+	if err := os.Rename(tmpPath, filepath.Join(uploadDir, result.FileName)); err != nil {
+		return nil, fmt.Errorf("failed to store file: %w", err)
+	}
+
+	return result, nil
+}
+
+func detectContentType(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	buffer := make([]byte, 512)
+	n, err := io.ReadFull(file, buffer)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return http.DetectContentType(buffer[:n]), nil
+}